@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/export"
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchOutput    string
+	batchFormat    string
+	batchWorkers   int
+	batchRecursive bool
+	batchQuiet     bool
+	batchFilter    string
+	batchWhere     string
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <replay.rec|directory>...",
+	Short: "Parse many replays concurrently into combined JSONL or CSV output",
+	Long: `Parse every replay given, or found in the given directories, with a bounded
+worker pool that shares one copy of the game data. Files that fail to parse are
+reported without stopping the batch.
+
+JSON output has one line per replay; CSV output has one row per build command
+with a leading file column.`,
+	Example: `  coh3-build-order batch ~/replays -o season.jsonl
+  coh3-build-order batch -r --format csv --filter all ~/replays > season.csv
+  coh3-build-order batch --workers 4 game1.rec game2.rec`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runBatch,
+}
+
+func init() {
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "output file (default: stdout)")
+	batchCmd.Flags().StringVarP(&batchFormat, "format", "f", "json", "output format: json (one line per replay) or csv")
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "w", 0, "number of replays to parse concurrently (default: number of CPUs)")
+	batchCmd.Flags().BoolVarP(&batchRecursive, "recursive", "r", false, "search directories recursively")
+	batchCmd.Flags().BoolVarP(&batchQuiet, "quiet", "q", false, "do not report progress")
+	batchCmd.Flags().StringVar(&batchFilter, "filter", "", "filter preset name (see the presets command)")
+	batchCmd.Flags().StringVar(&batchWhere, "where", "", "filter expression, e.g. 'type = build_squad and time < 5m'")
+	rootCmd.AddCommand(batchCmd)
+}
+
+func runBatch(cmd *cobra.Command, args []string) error {
+	format, err := export.ParseFormat(batchFormat)
+	if err != nil {
+		return err
+	}
+	config, err := filterConfig(batchFilter, batchWhere)
+	if err != nil {
+		return err
+	}
+
+	paths, err := findReplays(args, batchRecursive)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no .rec files found in %s", strings.Join(args, ", "))
+	}
+
+	var out io.Writer = cmd.OutOrStdout()
+	if batchOutput != "" {
+		file, err := os.Create(batchOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	writer, err := export.NewBatchWriter(out, format)
+	if err != nil {
+		return err
+	}
+
+	// The cache loads the game data itself, and only if a replay is not cached
+	var cache *vault.ParseCache
+	var resolver *lookup.DataResolver
+	if !noCache {
+		if cache, err = openParseCache(); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: parse cache disabled: %v\n", err)
+		}
+	}
+	if cache == nil {
+		if resolver, err = lookup.NewDataResolver(dataDir); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: game data not loaded, names will not be resolved: %v\n", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	filter := config.ToVaultFilter()
+	var failed int
+	var writeErr error
+	vault.ParseReplays(ctx, paths, vault.ParseOptions{
+		Filter:   &filter,
+		Resolver: resolver,
+		Cache:    cache,
+		Workers:  batchWorkers,
+		Progress: func(done, total int, result vault.ParseResult) {
+			status := "ok"
+			if result.Err != nil {
+				failed++
+				status = "error: " + result.Err.Error()
+			} else {
+				result.Data = config.Apply(result.Data)
+			}
+			if !batchQuiet {
+				fmt.Fprintf(cmd.ErrOrStderr(), "[%d/%d] %s: %s\n", done, total, result.Path, status)
+			}
+			if writeErr == nil {
+				writeErr = writer.Write(result)
+			}
+		},
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d replays failed to parse", failed, len(paths))
+	}
+	return nil
+}
+
+// findReplays expands directories into the .rec files they contain
+func findReplays(args []string, recursive bool) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s does not exist", arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != arg && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.EqualFold(filepath.Ext(path), ".rec") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
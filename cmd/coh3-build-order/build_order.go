@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/export"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var (
+	buildOrderPlayer  string
+	buildOrderVerbose bool
+	buildOrderFilter  string
+	buildOrderWhere   string
+	buildOrderFormat  string
+)
+
+var buildOrderCmd = &cobra.Command{
+	Use:   "build-order <replay.rec>",
+	Short: "Extract build orders for all players or a single player",
+	Long: `Extract build orders with resolved unit, building, upgrade and battlegroup names.
+Players can be referenced by name (case-insensitive) or by ID.`,
+	Example: `  coh3-build-order build-order replay.rec
+  coh3-build-order build-order -p Tomsch replay.rec
+  coh3-build-order build-order -p 0 replay.rec
+  coh3-build-order build-order --filter combat replay.rec
+  coh3-build-order build-order --where 'time < 5m and name ~ "Panzer"' replay.rec
+  coh3-build-order build-order --format csv replay.rec > build_orders.csv`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBuildOrder,
+}
+
+func init() {
+	buildOrderCmd.Flags().StringVarP(&buildOrderPlayer, "player", "p", "", "player name or ID (default: all players)")
+	buildOrderCmd.Flags().BoolVarP(&buildOrderVerbose, "verbose", "v", false, "show parsing details")
+	buildOrderCmd.Flags().StringVar(&buildOrderFilter, "filter", "", "filter preset name (see the presets command)")
+	buildOrderCmd.Flags().StringVar(&buildOrderWhere, "where", "", "filter expression, e.g. 'type = build_squad and time < 5m'")
+	buildOrderCmd.Flags().StringVarP(&buildOrderFormat, "format", "f", "text", "output format: text, json, csv, markdown or yaml")
+	rootCmd.AddCommand(buildOrderCmd)
+}
+
+func runBuildOrder(cmd *cobra.Command, args []string) error {
+	replayFile := args[0]
+	if err := checkReplayFile(replayFile); err != nil {
+		return err
+	}
+
+	config, err := filterConfig(buildOrderFilter, buildOrderWhere)
+	if err != nil {
+		return err
+	}
+	format, err := export.ParseFormat(buildOrderFormat)
+	if err != nil {
+		return err
+	}
+
+	// Keep machine-readable output clean by sending verbose details to stderr
+	log := cmd.OutOrStdout()
+	if format != export.Text {
+		log = cmd.ErrOrStderr()
+	}
+	if buildOrderVerbose {
+		fmt.Fprintf(log, "Parsing replay file: %s\n", replayFile)
+	}
+
+	data, err := parseReplay(replayFile, config.ToVaultFilter())
+	if err != nil {
+		return fmt.Errorf("failed to parse replay: %w", err)
+	}
+	data = config.Apply(data)
+
+	if buildOrderVerbose {
+		fmt.Fprintf(log, "Found %d players\n", len(data.Players))
+	}
+
+	if buildOrderPlayer != "" {
+		data, err = selectPlayer(data, buildOrderPlayer)
+		if err != nil {
+			return err
+		}
+		if buildOrderVerbose {
+			fmt.Fprintf(log, "Extracting build order for player: %s\n", data.Players[0].PlayerName)
+		}
+	}
+	if buildOrderVerbose {
+		fmt.Fprintln(log)
+	}
+
+	return export.Write(cmd.OutOrStdout(), format, data)
+}
+
+func printBuildOrder(out io.Writer, player vault.Player) {
+	fmt.Fprintln(out, "Build Order:")
+	if len(player.BuildCommands) == 0 {
+		fmt.Fprintln(out, "  (no commands)")
+		return
+	}
+	for i, cmd := range player.BuildCommands {
+		fmt.Fprintf(out, "%3d. [%s] %s: %s\n", i+1, formatTimestamp(cmd.Timestamp), cmd.CommandType, commandName(cmd))
+	}
+}
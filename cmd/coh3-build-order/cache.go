@@ -0,0 +1,29 @@
+package main
+
+import "github.com/spf13/cobra"
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the parse cache",
+	Long: `Parsed replays are cached on disk, keyed by replay content and command filter,
+so reopening a replay skips the parser. Cached results are discarded
+automatically when the parser or the game data (metadata.json tag) changes.`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached parse results",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := openParseCache()
+		if err != nil {
+			return err
+		}
+		return cache.Clear()
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var fullCmd = &cobra.Command{
+	Use:     "full <replay.rec>",
+	Short:   "Show all replay data: metadata, teams, build orders and messages",
+	Example: `  coh3-build-order full replay.rec`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runFull,
+}
+
+func init() {
+	rootCmd.AddCommand(fullCmd)
+}
+
+func runFull(cmd *cobra.Command, args []string) error {
+	if err := checkReplayFile(args[0]); err != nil {
+		return err
+	}
+
+	data, err := parseReplay(args[0], vault.NewBuildOnlyFilter())
+	if err != nil {
+		return fmt.Errorf("failed to parse replay: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintln(out, "=== Comprehensive Replay Data ===")
+	fmt.Fprintf(out, "Map: %s\n", data.MapName)
+	if data.MapFilename != "" {
+		fmt.Fprintf(out, "Map File: %s\n", data.MapFilename)
+	}
+	fmt.Fprintf(out, "Duration: %s (%d ticks)\n", formatDuration(data.DurationSeconds), data.DurationTicks)
+	if data.GameVersion != nil {
+		fmt.Fprintf(out, "Game Version: %d\n", *data.GameVersion)
+	}
+	if data.GameType != nil {
+		fmt.Fprintf(out, "Game Type: %s\n", *data.GameType)
+	}
+	if data.Timestamp != nil {
+		fmt.Fprintf(out, "Played: %s\n", *data.Timestamp)
+	}
+	if data.MatchHistoryID != nil {
+		fmt.Fprintf(out, "Match History ID: %s\n", *data.MatchHistoryID)
+	}
+	fmt.Fprintf(out, "Winning Team: %s\n", formatWinningTeam(data.WinningTeam))
+	fmt.Fprintln(out)
+
+	printTeams(out, data)
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "=== All Players with Build Orders ===")
+	for _, player := range data.Players {
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "=== Player %d: %s (Team %d) ===\n", player.PlayerID, player.PlayerName, player.TeamID)
+		if player.Faction != nil {
+			fmt.Fprintf(out, "Faction: %s\n", *player.Faction)
+		}
+		if player.SteamID != nil {
+			fmt.Fprintf(out, "Steam ID: %s\n", *player.SteamID)
+		}
+		if player.ProfileID != nil {
+			fmt.Fprintf(out, "Profile ID: %s\n", *player.ProfileID)
+		}
+		fmt.Fprintf(out, "Total Commands: %d\n", len(player.Commands))
+		printBuildOrder(out, player)
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "=== Messages ===")
+	if len(data.Messages) == 0 {
+		fmt.Fprintln(out, "No messages")
+	}
+	for _, message := range data.Messages {
+		sender := "System"
+		if message.PlayerID != nil {
+			sender = fmt.Sprintf("Player %d", *message.PlayerID)
+		}
+		fmt.Fprintf(out, "[%s] %s: %s\n", formatTimestamp(message.Timestamp), sender, message.Content)
+	}
+	return nil
+}
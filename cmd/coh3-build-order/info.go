@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var infoCmd = &cobra.Command{
+	Use:     "info <replay.rec>",
+	Short:   "Show high-level replay information",
+	Long:    "Show the map, duration, winning team and team line-ups of a replay.",
+	Example: `  coh3-build-order info replay.rec`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runInfo,
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+}
+
+func runInfo(cmd *cobra.Command, args []string) error {
+	if err := checkReplayFile(args[0]); err != nil {
+		return err
+	}
+
+	data, err := vault.ParseReplayFull(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse replay: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintln(out, "=== Replay Information ===")
+	fmt.Fprintf(out, "Map: %s\n", data.MapName)
+	fmt.Fprintf(out, "Duration: %s\n", formatDuration(data.DurationSeconds))
+	fmt.Fprintf(out, "Winning Team: %s\n", formatWinningTeam(data.WinningTeam))
+	fmt.Fprintln(out)
+	printTeams(out, data)
+	return nil
+}
+
+func printTeams(out io.Writer, data *vault.ReplayData) {
+	fmt.Fprintln(out, "=== Teams ===")
+	for i, team := range data.Teams {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "Team %d:\n", team.TeamID)
+		for _, player := range team.Players {
+			fmt.Fprintf(out, "  ID %d: %s\n", player.PlayerID, player.PlayerName)
+		}
+	}
+}
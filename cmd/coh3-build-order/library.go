@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/export"
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var libraryCmd = &cobra.Command{
+	Use:   "library",
+	Short: "List, search, import and reopen replays in the local library",
+	Long: `The local library stores every imported replay once, keyed by its match
+history ID (or file content when there is none), and indexes players,
+factions, map, duration, game version and date.`,
+}
+
+// queryFlags are the library search flags shared by commands that select stored replays
+type queryFlags struct {
+	player, faction, mapName, version, teamSize string
+	minDuration, maxDuration, since, until      string
+}
+
+func (f *queryFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.player, "player", "", "player name, profile ID or Steam ID")
+	cmd.Flags().StringVar(&f.faction, "faction", "", "faction played by any player, e.g. Wehrmacht")
+	cmd.Flags().StringVar(&f.mapName, "map", "", "map name (substring)")
+	cmd.Flags().StringVar(&f.version, "version", "", "game version")
+	cmd.Flags().StringVar(&f.teamSize, "team-size", "", "players per team, e.g. 1 or 2v2")
+	cmd.Flags().StringVar(&f.minDuration, "min-duration", "", "minimum game length, e.g. 10m")
+	cmd.Flags().StringVar(&f.maxDuration, "max-duration", "", "maximum game length, e.g. 45m")
+	cmd.Flags().StringVar(&f.since, "since", "", "games played on or after this date (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&f.until, "until", "", "games played before this date (YYYY-MM-DD)")
+}
+
+func (f *queryFlags) query(text string) (library.Query, error) {
+	values := url.Values{}
+	for key, value := range map[string]string{
+		"q":            text,
+		"player":       f.player,
+		"faction":      f.faction,
+		"map":          f.mapName,
+		"version":      f.version,
+		"team_size":    f.teamSize,
+		"min_duration": f.minDuration,
+		"max_duration": f.maxDuration,
+		"since":        f.since,
+		"until":        f.until,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	return library.QueryFromValues(values)
+}
+
+var listFlags queryFlags
+
+var libraryListCmd = &cobra.Command{
+	Use:   "list [text]",
+	Short: "List stored replays, optionally filtered",
+	Example: `  coh3-build-order library list
+  coh3-build-order library list --player Tomsch --faction Wehrmacht
+  coh3-build-order library list --map rails --since 2025-06-01 panzer`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLibraryList,
+}
+
+var (
+	showPlayer string
+	showFormat string
+	showFilter string
+	showWhere  string
+)
+
+var libraryShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show the build orders of a stored replay",
+	Example: `  coh3-build-order library show m-123456
+  coh3-build-order library show m-123456 -p Tomsch --format markdown`,
+	Args: cobra.ExactArgs(1),
+	RunE: runLibraryShow,
+}
+
+var libraryImportCmd = &cobra.Command{
+	Use:   "import <replay.rec|directory>...",
+	Short: "Parse replays and add them to the library",
+	Example: `  coh3-build-order library import game.rec
+  coh3-build-order library import ~/replays`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runLibraryImport,
+}
+
+var libraryReindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the library index from the stored replays",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lib, err := openLibrary()
+		if err != nil {
+			return err
+		}
+		return lib.Reindex()
+	},
+}
+
+func init() {
+	listFlags.register(libraryListCmd)
+
+	libraryShowCmd.Flags().StringVarP(&showPlayer, "player", "p", "", "player name or ID (default: all players)")
+	libraryShowCmd.Flags().StringVarP(&showFormat, "format", "f", "text", "output format: text, json, csv, markdown or yaml")
+	libraryShowCmd.Flags().StringVar(&showFilter, "filter", "", "filter preset name (see the presets command)")
+	libraryShowCmd.Flags().StringVar(&showWhere, "where", "", "filter expression, e.g. 'type = build_squad and time < 5m'")
+
+	libraryCmd.AddCommand(libraryListCmd, libraryShowCmd, libraryImportCmd, libraryReindexCmd)
+	rootCmd.AddCommand(libraryCmd)
+}
+
+func runLibraryList(cmd *cobra.Command, args []string) error {
+	var text string
+	if len(args) > 0 {
+		text = args[0]
+	}
+	query, err := listFlags.query(text)
+	if err != nil {
+		return err
+	}
+
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	entries, err := lib.Search(query)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No replays found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDate\tMap\tDuration\tPlayers")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.ID, entry.Date().Format("2006-01-02 15:04"),
+			shortMapName(entry.MapName), formatDuration(entry.DurationSeconds), describePlayers(entry))
+	}
+	return w.Flush()
+}
+
+func runLibraryShow(cmd *cobra.Command, args []string) error {
+	config, err := filterConfig(showFilter, showWhere)
+	if err != nil {
+		return err
+	}
+	format, err := export.ParseFormat(showFormat)
+	if err != nil {
+		return err
+	}
+
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	_, data, err := lib.Get(args[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	data = config.Apply(data)
+	if showPlayer != "" {
+		if data, err = selectPlayer(data, showPlayer); err != nil {
+			return err
+		}
+	}
+	return export.Write(cmd.OutOrStdout(), format, data)
+}
+
+func runLibraryImport(cmd *cobra.Command, args []string) error {
+	paths, err := findReplays(args, true)
+	if err != nil {
+		return err
+	}
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	resolver, err := lookup.NewDataResolver(dataDir)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: game data not loaded, names will not be resolved: %v\n", err)
+	}
+
+	out := cmd.OutOrStdout()
+	var failed int
+	for _, path := range paths {
+		data, err := vault.ParseReplayWithResolver(path, resolver, vault.NewBuildOnlyFilter())
+		if err == nil {
+			var entry library.Entry
+			var added bool
+			if entry, added, err = lib.Add(path, data); err == nil {
+				status := "imported as"
+				if !added {
+					status = "already in library as"
+				}
+				fmt.Fprintf(out, "%s: %s %s\n", path, status, entry.ID)
+				continue
+			}
+		}
+		failed++
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", path, err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d replays could not be imported", failed, len(paths))
+	}
+	return nil
+}
+
+// shortMapName strips the scenario path from a map name
+func shortMapName(name string) string {
+	return path.Base(strings.ReplaceAll(name, "\\", "/"))
+}
+
+// describePlayers lists an entry's players grouped by team, e.g. "A (Wehrmacht) vs B (Americans)"
+func describePlayers(entry library.Entry) string {
+	var teamOrder []uint32
+	teams := make(map[uint32][]string)
+	for _, player := range entry.Players {
+		name := player.PlayerName
+		if player.Faction != "" {
+			name += " (" + player.Faction + ")"
+		}
+		if _, seen := teams[player.TeamID]; !seen {
+			teamOrder = append(teamOrder, player.TeamID)
+		}
+		teams[player.TeamID] = append(teams[player.TeamID], name)
+	}
+
+	parts := make([]string, 0, len(teamOrder))
+	for _, team := range teamOrder {
+		parts = append(parts, strings.Join(teams[team], ", "))
+	}
+	return strings.Join(parts, " vs ")
+}
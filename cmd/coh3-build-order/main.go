@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultDataDir = "./data/coh3-data"
+
+var (
+	dataDir    string
+	libraryDir string
+	cacheDir   string
+	noCache    bool
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "coh3-build-order",
+	Short: "Extract build orders from Company of Heroes 3 replays",
+	Long: `coh3-build-order parses Company of Heroes 3 replay files (*.rec) and
+shows replay information and per-player build orders with resolved
+unit, building, upgrade and battlegroup names.`,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", defaultDataDir, "directory containing the coh3-data game data")
+	rootCmd.PersistentFlags().StringVar(&libraryDir, "library", "", "replay library directory (default: $COH3_LIBRARY_DIR or the user config directory)")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "parse cache directory (default: $COH3_CACHE_DIR or the user cache directory)")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "always re-parse replays instead of using the parse cache")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/export"
+	"github.com/scharissis/coh3-replay-analyser/pkg/stats"
+	"github.com/spf13/cobra"
+)
+
+var (
+	metaFlags         queryFlags
+	metaFormat        string
+	metaOpeningLength int
+	metaTop           int
+)
+
+var metaCmd = &cobra.Command{
+	Use:   "meta",
+	Short: "Report faction, battlegroup, opening and unit statistics across the library",
+	Long: `Aggregate the library replays into a meta report: faction and matchup win
+rates, battlegroup pick and win rates per faction, the most common openings per
+matchup and unit popularity by game version. The library search flags select the
+games, e.g. one map, team size or patch window.`,
+	Example: `  coh3-build-order meta
+  coh3-build-order meta --team-size 1v1 --since 2025-06-01
+  coh3-build-order meta --map rails --format csv > meta.csv`,
+	Args: cobra.NoArgs,
+	RunE: runMeta,
+}
+
+func init() {
+	metaFlags.register(metaCmd)
+	metaCmd.Flags().StringVarP(&metaFormat, "format", "f", "text", "output format: text, json or csv")
+	metaCmd.Flags().IntVar(&metaOpeningLength, "opening-length", stats.DefaultOpeningLength, "build commands per opening")
+	metaCmd.Flags().IntVar(&metaTop, "top", 5, "openings per matchup and units per game version to list (0 for all)")
+	rootCmd.AddCommand(metaCmd)
+}
+
+func runMeta(cmd *cobra.Command, args []string) error {
+	format, err := export.ParseFormat(metaFormat)
+	if err != nil {
+		return err
+	}
+	if format != export.Text && format != export.JSON && format != export.CSV {
+		return fmt.Errorf("unsupported meta format %q (use text, json or csv)", metaFormat)
+	}
+	query, err := metaFlags.query("")
+	if err != nil {
+		return err
+	}
+
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	games, err := stats.LoadGames(lib, query)
+	if err != nil {
+		return err
+	}
+	report := stats.BuildMetaReport(games, stats.MetaOptions{
+		OpeningLength: metaOpeningLength,
+		TopOpenings:   metaTop,
+		TopUnits:      metaTop,
+	})
+
+	out := cmd.OutOrStdout()
+	switch format {
+	case export.JSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case export.CSV:
+		return stats.WriteMetaCSV(out, report)
+	default:
+		return stats.WriteMetaReport(out, report)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/pkg/milestones"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+// milestonesConfig is the milestone configuration file given with --milestones-config
+var milestonesConfig string
+
+var milestonesCmd = &cobra.Command{
+	Use:   "milestones <replay.rec>",
+	Short: "Show key timing milestones for each player",
+	Long: `Show when each player reached the key timing milestones: first unit after
+the starting units, first building, first tech unlock, battlegroup selection,
+first vehicle and first battlegroup ability.
+
+Tech unlocks and starting units are configured per faction; pass a JSON or
+YAML file with --milestones-config to override the defaults for a faction.`,
+	Example: `  coh3-build-order milestones replay.rec
+  coh3-build-order milestones --milestones-config milestones.yaml replay.rec`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runMilestones,
+}
+
+func init() {
+	registerMilestonesConfig(milestonesCmd)
+	rootCmd.AddCommand(milestonesCmd)
+}
+
+// registerMilestonesConfig adds the --milestones-config flag to a command
+func registerMilestonesConfig(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&milestonesConfig, "milestones-config", "", "JSON or YAML file overriding the per-faction milestone configuration")
+}
+
+// newMilestoneExtractor creates a milestone extractor with the configuration
+// from --milestones-config, or the defaults
+func newMilestoneExtractor(resolver *lookup.DataResolver) (*milestones.Extractor, error) {
+	config := milestones.DefaultConfig()
+	if milestonesConfig != "" {
+		var err error
+		if config, err = milestones.LoadConfig(milestonesConfig); err != nil {
+			return nil, fmt.Errorf("failed to load the milestone configuration: %w", err)
+		}
+	}
+	return milestones.NewExtractor(config, resolver), nil
+}
+
+func runMilestones(cmd *cobra.Command, args []string) error {
+	if err := checkReplayFile(args[0]); err != nil {
+		return err
+	}
+	// Without game data vehicles cannot be detected, but the other milestones still can
+	resolver, _ := lookup.NewDataResolver(dataDir)
+	extractor, err := newMilestoneExtractor(resolver)
+	if err != nil {
+		return err
+	}
+
+	data, err := parseReplay(args[0], vault.NewBuildOnlyFilter())
+	if err != nil {
+		return fmt.Errorf("failed to parse replay: %w", err)
+	}
+
+	return milestones.WriteTable(cmd.OutOrStdout(), extractor.Extract(data))
+}
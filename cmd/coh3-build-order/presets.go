@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var presetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "List the filter presets available to --filter",
+	Long: `List the built-in filter presets and the user presets loaded from the
+preset directory ($COH3_PRESET_DIR or coh3-replay-analyser/presets in the
+user config directory).`,
+	Args: cobra.NoArgs,
+	RunE: runPresets,
+}
+
+func init() {
+	rootCmd.AddCommand(presetsCmd)
+}
+
+func runPresets(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	for _, preset := range loadPresets().List() {
+		fmt.Fprintf(out, "%s: %s\n", preset.Name, preset.Description)
+		var types []string
+		for _, cmdType := range preset.Include {
+			types = append(types, string(cmdType))
+		}
+		fmt.Fprintf(out, "  include: %s\n", strings.Join(types, ", "))
+		if preset.Where != "" {
+			fmt.Fprintf(out, "  where: %s\n", preset.Where)
+		}
+	}
+	return nil
+}
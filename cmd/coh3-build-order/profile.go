@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/export"
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/pkg/stats"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileFlags  queryFlags
+	profileFormat string
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile <player>",
+	Short: "Show a player's record, habits and trends across the library",
+	Long: `Aggregate every library replay of a player into a profile: win/loss by
+faction, map and matchup, average milestone timings, favourite battlegroups,
+most-built units and a monthly trend. The player can be referenced by name
+(case-insensitive), profile ID or Steam ID; games are matched by profile ID,
+so renamed players keep their history.`,
+	Example: `  coh3-build-order profile Tomsch
+  coh3-build-order profile 12345 --since 2025-01-01
+  coh3-build-order profile Tomsch --map rails --format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runProfile,
+}
+
+func init() {
+	profileFlags.register(profileCmd)
+	profileCmd.Flags().StringVarP(&profileFormat, "format", "f", "text", "output format: text or json")
+	registerMilestonesConfig(profileCmd)
+	rootCmd.AddCommand(profileCmd)
+}
+
+func runProfile(cmd *cobra.Command, args []string) error {
+	format, err := export.ParseFormat(profileFormat)
+	if err != nil {
+		return err
+	}
+	if format != export.Text && format != export.JSON {
+		return fmt.Errorf("unsupported profile format %q (use text or json)", profileFormat)
+	}
+	query, err := profileFlags.query("")
+	if err != nil {
+		return err
+	}
+	// Without game data vehicles cannot be detected, but the other milestones still can
+	resolver, _ := lookup.NewDataResolver(dataDir)
+	extractor, err := newMilestoneExtractor(resolver)
+	if err != nil {
+		return err
+	}
+
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	games, err := stats.LoadGames(lib, query)
+	if err != nil {
+		return err
+	}
+
+	profile, err := stats.BuildProfile(games, args[0], extractor)
+	if err != nil {
+		return err
+	}
+
+	if format == export.JSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(profile)
+	}
+	return stats.WriteProfile(cmd.OutOrStdout(), profile)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// checkReplayFile returns a readable error if the replay file is missing
+func checkReplayFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("replay file %s does not exist", path)
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, not a replay file", path)
+	}
+	return nil
+}
+
+// loadPresets returns the built-in presets and any user presets
+func loadPresets() *commands.PresetCatalog {
+	presetDir, err := commands.DefaultPresetDir()
+	if err != nil {
+		return commands.NewPresetCatalog(commands.BuiltinPresets()...)
+	}
+	catalog, err := commands.LoadPresetCatalog(presetDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load filter presets from %s: %v\n", presetDir, err)
+	}
+	return catalog
+}
+
+// openParseCache opens the parse cache selected with --cache-dir
+func openParseCache() (*vault.ParseCache, error) {
+	dir := cacheDir
+	if dir == "" {
+		var err error
+		if dir, err = vault.DefaultCacheDir(); err != nil {
+			return nil, err
+		}
+	}
+	return vault.OpenParseCache(dir, dataDir)
+}
+
+// parseReplay parses and enriches a replay, reusing the cached result of an
+// earlier run unless --no-cache is set. If the cache is unavailable the replay
+// is parsed directly.
+func parseReplay(path string, filter vault.CommandFilter) (*vault.ReplayData, error) {
+	if !noCache {
+		cache, err := openParseCache()
+		if err == nil {
+			return cache.ParseReplayWithFilter(path, filter)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: parse cache disabled: %v\n", err)
+	}
+	return vault.ParseReplayWithFilter(path, dataDir, filter)
+}
+
+// openLibrary opens the replay library selected with --library
+func openLibrary() (*library.Library, error) {
+	dir := libraryDir
+	if dir == "" {
+		var err error
+		if dir, err = library.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return library.Open(dir)
+}
+
+// filterConfig builds a filter configuration from a preset name and a where expression
+func filterConfig(presetName, where string) (*commands.FilterConfig, error) {
+	config := commands.NewFilterConfig()
+	if presetName != "" {
+		catalog := loadPresets()
+		preset, ok := catalog.Get(presetName)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter preset %q; available presets: %s",
+				presetName, strings.Join(catalog.Names(), ", "))
+		}
+		if _, err := config.WithPreset(preset); err != nil {
+			return nil, fmt.Errorf("filter preset %q: %w", preset.Name, describeExprError(err))
+		}
+	}
+	if where != "" {
+		if _, err := config.WithExpression(where); err != nil {
+			return nil, describeExprError(err)
+		}
+	}
+	return config, nil
+}
+
+// describeExprError adds the expression context to a *commands.ExprError
+func describeExprError(err error) error {
+	if exprErr, ok := err.(*commands.ExprError); ok {
+		return fmt.Errorf("%v\n  %s", exprErr, strings.ReplaceAll(exprErr.Context(), "\n", "\n  "))
+	}
+	return err
+}
+
+// findPlayer finds a player by name (case-insensitive) or by ID
+func findPlayer(data *vault.ReplayData, ref string) (*vault.Player, error) {
+	for i := range data.Players {
+		if strings.EqualFold(data.Players[i].PlayerName, ref) {
+			return &data.Players[i], nil
+		}
+	}
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		for i := range data.Players {
+			if data.Players[i].PlayerID == uint32(id) {
+				return &data.Players[i], nil
+			}
+		}
+	}
+
+	var available []string
+	for _, player := range data.Players {
+		available = append(available, fmt.Sprintf("%d (%s)", player.PlayerID, player.PlayerName))
+	}
+	return nil, fmt.Errorf("player %q not found; available players: %s", ref, strings.Join(available, ", "))
+}
+
+// selectPlayer returns a copy of the replay containing only the referenced player
+func selectPlayer(data *vault.ReplayData, ref string) (*vault.ReplayData, error) {
+	player, err := findPlayer(data, ref)
+	if err != nil {
+		return nil, err
+	}
+	selected := *data
+	selected.Players = []vault.Player{*player}
+	return &selected, nil
+}
+
+// commandName returns the resolved unit or building name of a command, or its type
+func commandName(cmd vault.Command) string {
+	if cmd.UnitName != nil {
+		return *cmd.UnitName
+	}
+	if cmd.BuildingName != nil {
+		return *cmd.BuildingName
+	}
+	return cmd.CommandType
+}
+
+func formatTimestamp(ms uint32) string {
+	return formatDuration(ms / 1000)
+}
+
+func formatDuration(seconds uint32) string {
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+func formatWinningTeam(team *uint32) string {
+	if team == nil {
+		return "Unknown"
+	}
+	return strconv.FormatUint(uint64(*team), 10)
+}
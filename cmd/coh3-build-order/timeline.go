@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/pkg/timeline"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var (
+	timelineOutput  string
+	timelineFormat  string
+	timelinePlayers []string
+	timelineFrom    string
+	timelineTo      string
+	timelineTitle   string
+	timelineFilter  string
+	timelineWhere   string
+)
+
+var timelineCmd = &cobra.Command{
+	Use:   "timeline <replay.rec>",
+	Short: "Render the multi-player build order timeline as an SVG or PNG image",
+	Long: `Render the build orders of a replay side by side, one column per player, as
+an image for forum posts, chat messages and slides. Commands issued at the same
+time line up across players.
+
+The format is taken from the output file's extension unless --format is given.
+PNG images use a bitmap font without command icons.`,
+	Example: `  coh3-build-order timeline replay.rec -o build.svg
+  coh3-build-order timeline -p Tomsch -p Surgie --to 8m replay.rec -o opening.png
+  coh3-build-order timeline --filter all --from 5:00 --to 10:00 replay.rec > midgame.svg`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTimeline,
+}
+
+func init() {
+	timelineCmd.Flags().StringVarP(&timelineOutput, "output", "o", "", "output file (default: stdout)")
+	timelineCmd.Flags().StringVarP(&timelineFormat, "format", "f", "", "image format: svg or png (default: from the output file, else svg)")
+	timelineCmd.Flags().StringSliceVarP(&timelinePlayers, "player", "p", nil, "player names or IDs to show, in column order (default: all players)")
+	timelineCmd.Flags().StringVar(&timelineFrom, "from", "", "start of the time range, e.g. 90s, 5m or 5:00")
+	timelineCmd.Flags().StringVar(&timelineTo, "to", "", "end of the time range (default: end of the game)")
+	timelineCmd.Flags().StringVar(&timelineTitle, "title", "", "heading above the timeline (default: map and game length)")
+	timelineCmd.Flags().StringVar(&timelineFilter, "filter", "", "filter preset name (see the presets command)")
+	timelineCmd.Flags().StringVar(&timelineWhere, "where", "", "filter expression, e.g. 'type = build_squad and time < 5m'")
+	rootCmd.AddCommand(timelineCmd)
+}
+
+func runTimeline(cmd *cobra.Command, args []string) error {
+	replayFile := args[0]
+	if err := checkReplayFile(replayFile); err != nil {
+		return err
+	}
+
+	format := strings.ToLower(timelineFormat)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(timelineOutput)), ".")
+	}
+	var write func(io.Writer, *vault.ReplayData, timeline.Options) error
+	switch format {
+	case "", "svg":
+		write = timeline.WriteSVG
+	case "png":
+		write = timeline.WritePNG
+	default:
+		return fmt.Errorf("unknown image format %q; expected svg or png", format)
+	}
+
+	opts := timeline.Options{Title: timelineTitle, Players: timelinePlayers}
+	var err error
+	if timelineFrom != "" {
+		if opts.From, err = commands.ParseGameTime(timelineFrom); err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+	if timelineTo != "" {
+		if opts.To, err = commands.ParseGameTime(timelineTo); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+		if opts.To <= opts.From {
+			return fmt.Errorf("--to must be later than --from")
+		}
+	}
+
+	config, err := filterConfig(timelineFilter, timelineWhere)
+	if err != nil {
+		return err
+	}
+	data, err := parseReplay(replayFile, config.ToVaultFilter())
+	if err != nil {
+		return fmt.Errorf("failed to parse replay: %w", err)
+	}
+	data = config.Apply(data)
+
+	var out io.Writer = cmd.OutOrStdout()
+	if timelineOutput != "" {
+		file, err := os.Create(timelineOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	return write(out, data, opts)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/pkg/watch"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval time.Duration
+	watchSettle   time.Duration
+	watchExisting bool
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [directory]",
+	Short: "Import new replays into the library as the game saves them",
+	Long: `Watch a directory (by default the CoH3 playback folder) for new .rec files.
+Each file is parsed once the game has finished writing it and stored in the
+local replay library, where the web interface picks it up.`,
+	Example: `  coh3-build-order watch
+  coh3-build-order watch ~/replays --existing`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runWatch,
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 2*time.Second, "time between directory scans")
+	watchCmd.Flags().DurationVar(&watchSettle, "settle", 5*time.Second, "how long a file must stay unchanged before it is imported")
+	watchCmd.Flags().BoolVar(&watchExisting, "existing", false, "also import replays already in the directory")
+	rootCmd.AddCommand(watchCmd)
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	dir, err := watch.DefaultPlaybackDir()
+	if len(args) > 0 {
+		dir, err = args[0], nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("directory %s does not exist", dir)
+	}
+
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+
+	resolver, err := lookup.NewDataResolver(dataDir)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: game data not loaded, names will not be resolved: %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Watching %s for new replays (library: %s)\n", dir, lib.Dir())
+
+	watcher := watch.New(dir, watch.Options{
+		Interval:        watchInterval,
+		Settle:          watchSettle,
+		IncludeExisting: watchExisting,
+	})
+	return watcher.Run(ctx, func(path string) {
+		data, err := vault.ParseReplayContext(ctx, path, resolver, vault.NewBuildOnlyFilter())
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: failed to parse replay: %v\n", path, err)
+			return
+		}
+		entry, added, err := lib.Add(path, data)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: failed to store replay: %v\n", path, err)
+			return
+		}
+		if !added {
+			fmt.Fprintf(out, "%s: already in library as %s\n", path, entry.ID)
+			return
+		}
+		fmt.Fprintf(out, "%s: imported as %s (%s, %s)\n", path, entry.ID, entry.MapName, formatDuration(entry.DurationSeconds))
+	})
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/api"
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/milestones"
+	"github.com/scharissis/coh3-replay-analyser/pkg/stats"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// The versioned REST API. Replays are uploaded into the replay library and
+// addressed by their library ID:
+//
+//	GET  /api/v1/replays                 list stored replays (library query parameters)
+//	POST /api/v1/replays                 upload a replay (multipart field "replay")
+//	GET  /api/v1/replays/{id}            full match metadata
+//	GET  /api/v1/replays/{id}/players    players
+//	GET  /api/v1/replays/{id}/commands   commands, filtered by type, player, from, to and where
+//	GET  /api/v1/replays/{id}/analysis   milestones, battlegroups and command statistics
+//
+// Responses use the schemas in pkg/api, described by the OpenAPI document served
+// at /api/openapi.json; errors are returned as api.Error.
+
+func (s *WebServer) setupAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc(api.BasePath+"/replays", s.handleAPIReplays)
+	mux.HandleFunc(api.BasePath+"/replays/", s.handleAPIReplay)
+}
+
+// handleOpenAPI serves the OpenAPI document describing the server's JSON endpoints
+func (s *WebServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.OpenAPI)
+}
+
+// handleAPIReplays lists stored replays or uploads a new one
+func (s *WebServer) handleAPIReplays(w http.ResponseWriter, r *http.Request) {
+	if s.library == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "replay storage is unavailable")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		query, err := library.QueryFromValues(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		entries, err := s.library.Search(query)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "failed to read replay library")
+			return
+		}
+		list := api.ReplayList{Replays: make([]api.ReplaySummary, 0, len(entries))}
+		for _, entry := range entries {
+			list.Replays = append(list.Replays, replaySummary(entry))
+		}
+		writeJSON(w, http.StatusOK, list)
+
+	case "POST":
+		s.handleAPIUpload(w, r)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAPIUpload parses an uploaded replay and stores it in the library. It
+// responds 201 Created for a new replay and 200 OK if the replay was already stored.
+func (s *WebServer) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
+	if status, err := s.readUpload(w, r); err != nil {
+		writeAPIError(w, status, err.Error())
+		return
+	}
+	file, header, err := r.FormFile("replay")
+	if err != nil {
+		s.metrics.rejectUpload(failureInvalidUpload)
+		writeAPIError(w, http.StatusBadRequest, `missing replay file (multipart field "replay")`)
+		return
+	}
+	defer file.Close()
+	s.metrics.observeUpload(header.Size)
+
+	name := filepath.Base(header.Filename)
+	if !strings.HasSuffix(strings.ToLower(name), ".rec") {
+		s.metrics.rejectUpload(failureInvalidUpload)
+		writeAPIError(w, http.StatusBadRequest, "replay files must have a .rec extension")
+		return
+	}
+	if err := checkReplayHeader(file); err != nil {
+		s.metrics.rejectUpload(failureNotReplay)
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Keep the uploaded file name, which the library records as the replay's source
+	tempDir, err := os.MkdirTemp("", "replay-upload-")
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to store upload")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, name)
+	if err := saveUpload(path, file); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to store upload")
+		return
+	}
+
+	data, err := s.parseReplay(r.Context(), path, vault.NewBuildOnlyFilter())
+	if err != nil {
+		writeAPIError(w, parseErrorStatus(w, err, http.StatusUnprocessableEntity), "failed to parse replay: "+err.Error())
+		return
+	}
+	entry, added, err := s.library.Add(path, data)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to store replay: "+err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", api.BasePath+"/replays/"+entry.ID)
+	writeJSON(w, status, replayMetadata(entry, data))
+}
+
+func saveUpload(path string, upload io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, upload); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// handleAPIReplay serves a stored replay and its sub-resources
+func (s *WebServer) handleAPIReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.library == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "replay storage is unavailable")
+		return
+	}
+
+	id, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, api.BasePath+"/replays/"), "/")
+	entry, data, err := s.library.Get(id)
+	if errors.Is(err, library.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, "replay not found")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to read replay: "+err.Error())
+		return
+	}
+
+	switch resource {
+	case "":
+		writeJSON(w, http.StatusOK, replayMetadata(entry, data))
+	case "players":
+		writeJSON(w, http.StatusOK, api.PlayerList{Players: apiPlayers(data)})
+	case "commands":
+		list, err := queryCommands(data, r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	case "analysis":
+		writeJSON(w, http.StatusOK, s.analyse(entry.ID, data))
+	case "timeline.svg", "timeline.png":
+		image, err := s.renderTimeline(r, resource, data)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeTimelineImage(w, resource, image)
+	default:
+		writeAPIError(w, http.StatusNotFound, "unknown resource "+resource)
+	}
+}
+
+// queryCommands selects commands with the query parameters type (repeatable or
+// comma-separated), player (name or ID), from and to (game times such as 90s, 5m
+// or MM:SS; to is exclusive), where (a filter expression), offset and limit
+func queryCommands(data *vault.ReplayData, r *http.Request) (api.CommandList, error) {
+	values := r.URL.Query()
+	var predicates []commands.Predicate
+
+	var types []commands.CommandType
+	for _, value := range values["type"] {
+		for _, t := range strings.Split(value, ",") {
+			t = strings.TrimSpace(t)
+			if _, known := commands.CommandDefinitions[commands.CommandType(t)]; !known {
+				return api.CommandList{}, fmt.Errorf("unknown command type %q", t)
+			}
+			types = append(types, commands.CommandType(t))
+		}
+	}
+	if len(types) > 0 {
+		predicates = append(predicates, commands.ByType(types...))
+	}
+
+	if player := values.Get("player"); player != "" {
+		predicates = append(predicates, commands.ByPlayer(player))
+	}
+	if from, ok, err := gameTimeParam(values, "from"); err != nil {
+		return api.CommandList{}, err
+	} else if ok {
+		predicates = append(predicates, commands.After(from))
+	}
+	if to, ok, err := gameTimeParam(values, "to"); err != nil {
+		return api.CommandList{}, err
+	} else if ok {
+		predicates = append(predicates, commands.Before(to))
+	}
+
+	if where := values.Get("where"); where != "" {
+		expr, err := commands.ParseExpression(where)
+		if err != nil {
+			return api.CommandList{}, err
+		}
+		predicates = append(predicates, expr.Predicate())
+	}
+
+	offset, err := intParam(values.Get("offset"), 0)
+	if err != nil {
+		return api.CommandList{}, fmt.Errorf("invalid offset: %w", err)
+	}
+	limit, err := intParam(values.Get("limit"), 0)
+	if err != nil {
+		return api.CommandList{}, fmt.Errorf("invalid limit: %w", err)
+	}
+
+	// Commands are returned in game order across all players
+	matches := commands.Query(data, commands.And(predicates...))
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Command.Timestamp < matches[j].Command.Timestamp
+	})
+
+	list := api.CommandList{Total: len(matches), Commands: []api.Command{}}
+	if offset < len(matches) {
+		matches = matches[offset:]
+		if limit > 0 && limit < len(matches) {
+			matches = matches[:limit]
+		}
+		for _, m := range matches {
+			list.Commands = append(list.Commands, apiCommand(m.Player.PlayerID, *m.Command))
+		}
+	}
+	return list, nil
+}
+
+// gameTimeParam parses an optional game time query parameter
+func gameTimeParam(values url.Values, param string) (time.Duration, bool, error) {
+	value := values.Get(param)
+	if value == "" {
+		return 0, false, nil
+	}
+	t, err := commands.ParseGameTime(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s %q: use a duration like 90s or 5m, or MM:SS", param, value)
+	}
+	return t, true, nil
+}
+
+func intParam(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative integer", value)
+	}
+	return n, nil
+}
+
+// analyse computes per-player milestones, battlegroups and command statistics
+func (s *WebServer) analyse(id string, data *vault.ReplayData) api.Analysis {
+	extractor := s.milestoneExtractor()
+	minutes := float64(data.DurationSeconds) / 60
+
+	analysis := api.Analysis{ReplayID: id, Players: []api.PlayerAnalysis{}}
+	for i := range data.Players {
+		player := &data.Players[i]
+		result := api.PlayerAnalysis{
+			PlayerID:       player.PlayerID,
+			PlayerName:     player.PlayerName,
+			Faction:        stringValue(player.Faction),
+			Result:         api.ResultUnknown,
+			CommandCounts:  make(map[string]int),
+			CategoryCounts: make(map[string]int),
+			Milestones:     []api.Milestone{},
+		}
+		if data.WinningTeam != nil {
+			result.Result = api.ResultLoss
+			if *data.WinningTeam == player.TeamID {
+				result.Result = api.ResultWin
+			}
+		}
+		result.Battlegroup, _ = stats.Battlegroup(player)
+		if minutes > 0 {
+			result.CommandsPerMinute = float64(len(player.Commands)) / minutes
+		}
+		for _, cmd := range player.Commands {
+			result.CommandCounts[cmd.CommandType]++
+			result.CategoryCounts[commandCategory(cmd.CommandType)]++
+		}
+
+		timings := extractor.ExtractPlayer(player)
+		for _, m := range milestones.Milestones {
+			if timing, ok := timings.Get(m); ok {
+				result.Milestones = append(result.Milestones, api.Milestone{
+					Milestone: string(m),
+					Label:     m.Label(),
+					Timestamp: timing.Timestamp,
+					Time:      formatTimestamp(timing.Timestamp),
+					Name:      timing.Name,
+				})
+			}
+		}
+		analysis.Players = append(analysis.Players, result)
+	}
+	return analysis
+}
+
+func replaySummary(entry library.Entry) api.ReplaySummary {
+	summary := api.ReplaySummary{
+		ID:              entry.ID,
+		MatchHistoryID:  entry.MatchHistoryID,
+		Map:             entry.MapName,
+		DurationSeconds: entry.DurationSeconds,
+		GameVersion:     entry.GameVersion,
+		GameType:        entry.GameType,
+		PlayedAt:        entry.PlayedAt,
+		AddedAt:         entry.AddedAt,
+		WinningTeam:     entry.WinningTeam,
+		Players:         make([]api.PlayerSummary, 0, len(entry.Players)),
+	}
+	for _, player := range entry.Players {
+		summary.Players = append(summary.Players, api.PlayerSummary{
+			ID:        player.PlayerID,
+			Name:      player.PlayerName,
+			TeamID:    player.TeamID,
+			Faction:   player.Faction,
+			ProfileID: player.ProfileID,
+			SteamID:   player.SteamID,
+		})
+	}
+	return summary
+}
+
+func replayMetadata(entry library.Entry, data *vault.ReplayData) api.Replay {
+	replay := api.Replay{
+		ID:              entry.ID,
+		Source:          entry.Source,
+		MatchHistoryID:  entry.MatchHistoryID,
+		Map:             data.MapName,
+		MapFilename:     data.MapFilename,
+		DurationSeconds: data.DurationSeconds,
+		GameVersion:     entry.GameVersion,
+		GameType:        entry.GameType,
+		PlayedAt:        entry.PlayedAt,
+		AddedAt:         entry.AddedAt,
+		WinningTeam:     data.WinningTeam,
+		Teams:           []api.Team{},
+		Players:         apiPlayers(data),
+		Messages:        make([]api.Message, 0, len(data.Messages)),
+	}
+
+	teams := make(map[uint32]*api.Team)
+	for _, player := range data.Players {
+		team, exists := teams[player.TeamID]
+		if !exists {
+			team = &api.Team{ID: player.TeamID}
+			teams[player.TeamID] = team
+		}
+		team.PlayerIDs = append(team.PlayerIDs, player.PlayerID)
+	}
+	for _, team := range teams {
+		replay.Teams = append(replay.Teams, *team)
+	}
+	sort.Slice(replay.Teams, func(i, j int) bool { return replay.Teams[i].ID < replay.Teams[j].ID })
+
+	for _, msg := range data.Messages {
+		replay.Messages = append(replay.Messages, api.Message{
+			Timestamp: msg.Timestamp,
+			PlayerID:  msg.PlayerID,
+			Content:   msg.Content,
+			Type:      msg.MessageType,
+		})
+	}
+	return replay
+}
+
+func apiPlayers(data *vault.ReplayData) []api.Player {
+	players := make([]api.Player, 0, len(data.Players))
+	for i := range data.Players {
+		player := &data.Players[i]
+		battlegroup, _ := stats.Battlegroup(player)
+		players = append(players, api.Player{
+			ID:          player.PlayerID,
+			Name:        player.PlayerName,
+			TeamID:      player.TeamID,
+			Faction:     stringValue(player.Faction),
+			IsHuman:     player.IsHuman,
+			ProfileID:   stringValue(player.ProfileID),
+			SteamID:     stringValue(player.SteamID),
+			Battlegroup: battlegroup,
+			Commands:    len(player.Commands),
+		})
+	}
+	return players
+}
+
+func apiCommand(playerID uint32, cmd vault.Command) api.Command {
+	command := api.Command{
+		PlayerID:  playerID,
+		Timestamp: cmd.Timestamp,
+		Time:      formatTimestamp(cmd.Timestamp),
+		Type:      cmd.CommandType,
+		Category:  commandCategory(cmd.CommandType),
+		PBGID:     stringValue(cmd.PBGID),
+	}
+	switch {
+	case cmd.UnitName != nil:
+		command.Name = *cmd.UnitName
+	case cmd.BuildingName != nil:
+		command.Name = *cmd.BuildingName
+	}
+	return command
+}
+
+// commandCategory returns the registered category of a command type
+func commandCategory(commandType string) string {
+	if def, known := commands.CommandDefinitions[commands.CommandType(commandType)]; known {
+		return string(def.Category)
+	}
+	return string(commands.CategoryOther)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, api.Error{Error: message})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/api"
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func strPtr(s string) *string { return &s }
+
+func u32Ptr(n uint32) *uint32 { return &n }
+
+// newTestServer returns a server whose library holds one stored 1v1 replay
+func newTestServer(t *testing.T) (*WebServer, string) {
+	t.Helper()
+	lib, err := library.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := &vault.ReplayData{
+		Success:         true,
+		MapName:         "rails_and_sand_4p",
+		DurationSeconds: 600,
+		MatchHistoryID:  strPtr("123456"),
+		WinningTeam:     u32Ptr(1),
+		Players: []vault.Player{
+			{
+				PlayerID: 0, PlayerName: "Tomsch", TeamID: 1, Faction: strPtr("Wehrmacht"), IsHuman: true, ProfileID: strPtr("7001"),
+				Commands: []vault.Command{
+					{Timestamp: 2000, CommandType: "build_squad", PBGID: strPtr("198340"), UnitName: strPtr("Grenadier Squad")},
+					{Timestamp: 95000, CommandType: "select_battlegroup", UnitName: strPtr("Mechanized")},
+					{Timestamp: 400000, CommandType: "use_ability"},
+				},
+			},
+			{
+				PlayerID: 1, PlayerName: "Surgie", TeamID: 2, Faction: strPtr("Americans"), IsHuman: true,
+				Commands: []vault.Command{
+					{Timestamp: 5000, CommandType: "construct_entity", BuildingName: strPtr("Barracks")},
+				},
+			},
+		},
+		Messages: []vault.GameMessage{{Timestamp: 1000, PlayerID: u32Ptr(0), Content: "gl hf", MessageType: "chat"}},
+	}
+
+	path := filepath.Join(t.TempDir(), "game.rec")
+	if err := os.WriteFile(path, []byte("replay"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entry, _, err := lib.Add(path, replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WebServer{library: lib}, entry.ID
+}
+
+// get serves a GET request and decodes the JSON response into v
+func get(t *testing.T, handler http.HandlerFunc, url string, wantStatus int, v interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", url, nil))
+	if rec.Code != wantStatus {
+		t.Fatalf("GET %s = %d, want %d: %s", url, rec.Code, wantStatus, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: invalid JSON: %v", url, err)
+	}
+}
+
+func TestAPIReplayMetadata(t *testing.T) {
+	s, id := newTestServer(t)
+
+	var list api.ReplayList
+	get(t, s.handleAPIReplays, "/api/v1/replays?faction=wehrmacht", http.StatusOK, &list)
+	if len(list.Replays) != 1 || list.Replays[0].ID != id || len(list.Replays[0].Players) != 2 {
+		t.Errorf("Unexpected replay list: %+v", list)
+	}
+
+	var replay api.Replay
+	get(t, s.handleAPIReplay, "/api/v1/replays/"+id, http.StatusOK, &replay)
+	if replay.Map != "rails_and_sand_4p" || replay.MatchHistoryID != "123456" || replay.Source != "game.rec" ||
+		len(replay.Teams) != 2 || replay.Teams[0].PlayerIDs[0] != 0 || len(replay.Messages) != 1 {
+		t.Errorf("Unexpected replay: %+v", replay)
+	}
+
+	var players api.PlayerList
+	get(t, s.handleAPIReplay, "/api/v1/replays/"+id+"/players", http.StatusOK, &players)
+	if len(players.Players) != 2 || players.Players[0].Battlegroup != "Mechanized" || players.Players[0].Commands != 3 {
+		t.Errorf("Unexpected players: %+v", players)
+	}
+
+	var analysis api.Analysis
+	get(t, s.handleAPIReplay, "/api/v1/replays/"+id+"/analysis", http.StatusOK, &analysis)
+	if len(analysis.Players) != 2 {
+		t.Fatalf("Unexpected analysis: %+v", analysis)
+	}
+	tomsch := analysis.Players[0]
+	if tomsch.Result != api.ResultWin || analysis.Players[1].Result != api.ResultLoss ||
+		tomsch.CommandsPerMinute != 0.3 || tomsch.CategoryCounts["build"] != 2 || tomsch.CommandCounts["use_ability"] != 1 {
+		t.Errorf("Unexpected player analysis: %+v", tomsch)
+	}
+
+	var apiErr api.Error
+	get(t, s.handleAPIReplay, "/api/v1/replays/m-999", http.StatusNotFound, &apiErr)
+	get(t, s.handleAPIReplay, "/api/v1/replays/"+id+"/nope", http.StatusNotFound, &apiErr)
+	if apiErr.Error == "" {
+		t.Error("Expected an error message")
+	}
+}
+
+func TestAPICommands(t *testing.T) {
+	s, id := newTestServer(t)
+
+	tests := []struct {
+		query string
+		want  []string // Command names or types, in game order
+	}{
+		{"", []string{"Grenadier Squad", "Barracks", "Mechanized", "use_ability"}},
+		{"?type=build_squad,construct_entity", []string{"Grenadier Squad", "Barracks"}},
+		{"?type=build_squad&type=use_ability", []string{"Grenadier Squad", "use_ability"}},
+		{"?player=surgie", []string{"Barracks"}},
+		{"?player=0&from=1:00", []string{"Mechanized", "use_ability"}},
+		{"?to=5s", []string{"Grenadier Squad"}},
+		{"?where=" + "name%20~%20%22mech%22", []string{"Mechanized"}},
+		{"?offset=1&limit=2", []string{"Barracks", "Mechanized"}},
+	}
+	for _, tt := range tests {
+		var list api.CommandList
+		get(t, s.handleAPIReplay, "/api/v1/replays/"+id+"/commands"+tt.query, http.StatusOK, &list)
+
+		var got []string
+		for _, cmd := range list.Commands {
+			if cmd.Name != "" {
+				got = append(got, cmd.Name)
+			} else {
+				got = append(got, cmd.Type)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+
+	var list api.CommandList
+	get(t, s.handleAPIReplay, "/api/v1/replays/"+id+"/commands?limit=1", http.StatusOK, &list)
+	if list.Total != 4 || list.Commands[0].Time != "00:02" || list.Commands[0].Category != "build" || list.Commands[0].PBGID != "198340" {
+		t.Errorf("Unexpected command page: %+v", list)
+	}
+
+	var apiErr api.Error
+	for _, query := range []string{"?type=bogus", "?from=soon", "?from=1:30:00", "?to=1:75", "?to=-5m", "?limit=-1", "?where=time%20%3C"} {
+		get(t, s.handleAPIReplay, "/api/v1/replays/"+id+"/commands"+query, http.StatusBadRequest, &apiErr)
+	}
+}
+
+func TestAPIUploadRequiresReplay(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("replay", "notes.txt")
+	part.Write([]byte("not a replay"))
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/v1/replays", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	s.handleAPIReplays(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST with a non-.rec file = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleAPIReplays(rec, httptest.NewRequest("DELETE", "/api/v1/replays", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("DELETE = %d (Allow %q), want 405", rec.Code, rec.Header().Get("Allow"))
+	}
+}
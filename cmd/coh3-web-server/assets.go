@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// webFiles holds the web interface: page templates in web/templates and the
+// stylesheets and scripts they load in web/static
+//
+//go:embed web
+var webFiles embed.FS
+
+// embeddedAssets serves the web interface built into the binary
+var embeddedAssets = mustLoadEmbeddedAssets()
+
+// assets renders the web interface's page templates and serves its static files
+type assets struct {
+	files     fs.FS
+	dev       bool               // Re-read files on every request, for live editing
+	templates *template.Template // Parsed templates; nil in dev mode
+	etags     map[string]string  // ETags of static files by name; nil in dev mode
+}
+
+func mustLoadEmbeddedAssets() *assets {
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	a := &assets{files: files, etags: make(map[string]string)}
+	err = fs.WalkDir(files, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		a.etags[strings.TrimPrefix(name, "static/")] = contentETag(content)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	a.templates = template.Must(a.parse())
+	return a
+}
+
+// devAssets serves the web interface from dir, so edits show up on reload
+func devAssets(dir string) (*assets, error) {
+	a := &assets{files: os.DirFS(dir), dev: true}
+	if _, err := a.parse(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *assets) parse() (*template.Template, error) {
+	return template.New("").Funcs(template.FuncMap{"asset": a.url}).ParseFS(a.files, "templates/*.html")
+}
+
+// url returns the URL of a static file. Outside dev mode the URL carries the
+// file's content hash, so browsers can cache it until the file changes.
+func (a *assets) url(name string) string {
+	if etag, ok := a.etags[name]; ok {
+		return "/static/" + name + "?v=" + strings.Trim(etag, `"`)
+	}
+	return "/static/" + name
+}
+
+// render writes the page template name. Pages are revalidated on every visit
+// and answered with 304 Not Modified when unchanged.
+func (a *assets) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	templates := a.templates
+	if a.dev {
+		var err error
+		if templates, err = a.parse(); err != nil {
+			http.Error(w, "Failed to parse templates: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, "Failed to render page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", contentETag(buf.Bytes()))
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// serveStatic serves the files in web/static under /static/. Requests for the
+// versioned URLs returned by url may be cached indefinitely; others are
+// revalidated with their ETag.
+func (a *assets) serveStatic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if !fs.ValidPath(name) || name == "." {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := fs.ReadFile(a.files, path.Join("static", name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag, ok := a.etags[name]
+	if !ok {
+		etag = contentETag(content)
+	}
+	if !a.dev && r.URL.Query().Get("v") == strings.Trim(etag, `"`) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// contentETag returns a strong ETag derived from content
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
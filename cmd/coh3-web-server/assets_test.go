@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStaticAssets(t *testing.T) {
+	mux := (&WebServer{}).routes()
+	serve := func(url, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Pages link to versioned asset URLs, which may be cached for good
+	page := serve("/", "")
+	if page.Code != http.StatusOK || page.Header().Get("ETag") == "" {
+		t.Fatalf("GET / = %d, ETag %q", page.Code, page.Header().Get("ETag"))
+	}
+	for _, asset := range []string{"app.css", "app.js"} {
+		url := regexp.MustCompile(`/static/` + regexp.QuoteMeta(asset) + `\?v=[0-9a-f]+`).FindString(page.Body.String())
+		if url == "" {
+			t.Fatalf("Page does not link to a versioned %s", asset)
+		}
+		rec := serve(url, "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") {
+			t.Errorf("GET %s = %d, Cache-Control %q", url, rec.Code, rec.Header().Get("Cache-Control"))
+		}
+		if rec := serve("/static/"+asset, rec.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+			t.Errorf("Revalidating %s = %d, want 304", asset, rec.Code)
+		}
+	}
+	if rec := serve("/static/app.js", ""); !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") ||
+		rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Unversioned app.js: Content-Type %q, Cache-Control %q", rec.Header().Get("Content-Type"), rec.Header().Get("Cache-Control"))
+	}
+	if rec := serve("/", page.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("Revalidating / = %d, want 304", rec.Code)
+	}
+	if rec := serve("/profile", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/static/profile.js?v=") {
+		t.Errorf("GET /profile = %d", rec.Code)
+	}
+
+	for _, url := range []string{"/static/", "/static/missing.js", "/static/../templates/index.html"} {
+		if rec := serve(url, ""); rec.Code != http.StatusNotFound && rec.Code != http.StatusMovedPermanently {
+			t.Errorf("GET %s = %d, want 404", url, rec.Code)
+		}
+	}
+}
+
+func TestDevAssets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"templates/index.html", "static/app.js"} {
+		content, err := webFiles.ReadFile("web/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assets, err := devAssets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := (&WebServer{assets: assets}).routes()
+
+	// Edits show up without a restart, and assets are not versioned
+	os.WriteFile(filepath.Join(dir, "static", "app.js"), []byte("// edited"), 0644)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/static/app.js", nil))
+	if rec.Body.String() != "// edited" || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Dev app.js = %q, Cache-Control %q", rec.Body.String(), rec.Header().Get("Cache-Control"))
+	}
+
+	os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte(`<script src="{{asset "app.js"}}"></script>`), 0644)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Body.String() != `<script src="/static/app.js"></script>` {
+		t.Errorf("Dev page = %q", rec.Body.String())
+	}
+
+	if _, err := devAssets(t.TempDir()); err == nil {
+		t.Error("Expected an error for a directory without templates")
+	}
+}
+
+// Replays are shared with other people and presets are user-edited, so text
+// from them must never reach innerHTML unescaped
+func TestScriptsEscapeReplayText(t *testing.T) {
+	unescaped := regexp.MustCompile(`\+\s*(data|player|p|side|entry|preset)\.(name|faction|map_name|player_name|description)\s*\+`)
+	for _, name := range []string{"web/static/app.js", "web/static/profile.js"} {
+		script, err := webFiles.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range unescaped.FindAllString(string(script), -1) {
+			t.Errorf("%s inserts %q without escapeHTML", name, match)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/share"
+	"github.com/scharissis/coh3-replay-analyser/pkg/stats"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// maxComparedPlayers limits a comparison to one column per player color
+const maxComparedPlayers = 8
+
+// Values of TimelineEvent.Diff
+const (
+	diffCommon = "common" // Also in the reference build order, or for the reference in all others
+	diffUnique = "unique"
+)
+
+// handleCompare shows players from several stored replays side by side on one
+// time axis. Each side parameter names a library or shared replay and a player
+// in it (name or ID) as <replay id>:<player>; the first side is the reference
+// the other build orders are compared with. The filter and where parameters
+// select the commands as for /api/parse.
+func (s *WebServer) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sides := r.URL.Query()["side"]
+	if len(sides) < 2 || len(sides) > maxComparedPlayers {
+		s.sendJSONError(w, fmt.Sprintf("Choose between 2 and %d players to compare", maxComparedPlayers))
+		return
+	}
+	config, err := s.filterConfig(r)
+	if err != nil {
+		s.sendJSONError(w, err.Error())
+		return
+	}
+
+	var players []*vault.Player
+	var games []string
+	var duration uint32
+	for _, side := range sides {
+		id, ref, ok := strings.Cut(side, ":")
+		if !ok || ref == "" {
+			s.sendJSONError(w, fmt.Sprintf("Invalid side %q, expected <replay id>:<player>", side))
+			return
+		}
+		replayData, err := s.storedReplay(id)
+		if errors.Is(err, library.ErrNotFound) {
+			s.sendJSONError(w, "Replay "+id+" not found")
+			return
+		}
+		if err != nil {
+			s.sendJSONError(w, "Failed to read replay "+id+": "+err.Error())
+			return
+		}
+
+		player := findPlayer(config.Apply(replayData), ref)
+		if player == nil {
+			s.sendJSONError(w, fmt.Sprintf("Player %q not found in replay %s", ref, id))
+			return
+		}
+		players = append(players, player)
+		games = append(games, fmt.Sprintf("%s · %s", id, replayData.MapName))
+		if replayData.DurationSeconds > duration {
+			duration = replayData.DurationSeconds
+		}
+	}
+
+	response := s.comparisonResponse(players, games, stats.CompareBuildOrders(players))
+	response.Duration = formatDuration(duration)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// storedReplay loads a replay kept for sharing or stored in the library,
+// returning library.ErrNotFound if neither has it
+func (s *WebServer) storedReplay(id string) (*vault.ReplayData, error) {
+	if s.shares != nil {
+		if _, replayData, err := s.shares.Get(id); !errors.Is(err, share.ErrNotFound) {
+			return replayData, err
+		}
+	}
+	if s.library == nil {
+		return nil, library.ErrNotFound
+	}
+	_, replayData, err := s.library.Get(id)
+	return replayData, err
+}
+
+// findPlayer returns the player referenced by name (case-insensitive) or ID
+func findPlayer(replayData *vault.ReplayData, ref string) *vault.Player {
+	for i := range replayData.Players {
+		player := &replayData.Players[i]
+		if strings.EqualFold(player.PlayerName, ref) || fmt.Sprint(player.PlayerID) == ref {
+			return player
+		}
+	}
+	return nil
+}
+
+// comparisonResponse lays out compared players as the columns of a timeline,
+// with player IDs numbering the columns and each event marked with its diff
+func (s *WebServer) comparisonResponse(players []*vault.Player, games []string, alignments [][]stats.Alignment) ReplayResponse {
+	response := ReplayResponse{
+		Success: true,
+		MapName: "Build order comparison",
+	}
+
+	timeline := make([]TimelineEvent, 0)
+	for i, player := range players {
+		faction := "Unknown"
+		if player.Faction != nil {
+			faction = *player.Faction
+		}
+		color := playerColors[i%len(playerColors)]
+
+		response.Players = append(response.Players, PlayerSummary{
+			ID:       i,
+			Name:     player.PlayerName,
+			Faction:  faction,
+			Color:    color,
+			Commands: len(player.BuildCommands),
+			Game:     games[i],
+		})
+
+		for j, cmd := range player.BuildCommands {
+			diff := diffUnique
+			if alignments[i][j].Common {
+				diff = diffCommon
+			}
+			timeline = append(timeline, TimelineEvent{
+				PlayerID:     i,
+				PlayerName:   player.PlayerName,
+				Faction:      faction,
+				Timestamp:    cmd.Timestamp,
+				TimestampStr: formatTimestamp(cmd.Timestamp),
+				CommandType:  cmd.CommandType,
+				Category:     commandCategory(cmd.CommandType),
+				Description:  commands.Describe(cmd),
+				Color:        color,
+				Diff:         diff,
+				Delta:        alignments[i][j].Delta,
+			})
+		}
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].Timestamp < timeline[j].Timestamp })
+	response.Timeline = timeline
+	return response
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	s, upload := newShareServer(t)
+	entries, _ := s.library.List()
+	libraryID := entries[0].ID
+
+	// Tomsch against himself in the shared copy, and against Surgie
+	query := url.Values{"side": {upload.ID + ":tomsch", libraryID + ":0", libraryID + ":Surgie"}, "filter": {"all"}}
+	var response ReplayResponse
+	get(t, s.handleCompare, "/api/compare?"+query.Encode(), http.StatusOK, &response)
+
+	if len(response.Players) != 3 || response.Players[0].Game != upload.ID+" · rails_and_sand_4p" ||
+		response.Players[2].ID != 2 || response.Players[2].Name != "Surgie" || response.Duration != "10:00" {
+		t.Fatalf("Unexpected players: %+v", response.Players)
+	}
+
+	diffs := make(map[int][]string)
+	for _, event := range response.Timeline {
+		diffs[event.PlayerID] = append(diffs[event.PlayerID], event.Diff)
+		// Abilities are shown alongside the build order
+		if event.CommandType == "use_ability" && (event.Category != "combat" || event.Description != "💥 Used ability") {
+			t.Errorf("Unexpected ability event: %+v", event)
+		}
+	}
+	// Surgie built something else, so none of the reference is common to all
+	want := map[int][]string{
+		0: {"unique", "unique", "unique"},
+		1: {"common", "common", "common"},
+		2: {"unique"},
+	}
+	for column, diff := range want {
+		if len(diffs[column]) != len(diff) {
+			t.Errorf("Column %d diffs = %v, want %v", column, diffs[column], diff)
+			continue
+		}
+		for i := range diff {
+			if diffs[column][i] != diff[i] {
+				t.Errorf("Column %d diffs = %v, want %v", column, diffs[column], diff)
+				break
+			}
+		}
+	}
+
+	var errResponse ReplayResponse
+	for _, sides := range [][]string{
+		{libraryID + ":0"},
+		{libraryID + ":0", "m-404:0"},
+		{libraryID + ":0", libraryID + ":Nobody"},
+		{libraryID + ":0", libraryID},
+	} {
+		get(t, s.handleCompare, "/api/compare?"+url.Values{"side": sides}.Encode(), http.StatusBadRequest, &errResponse)
+		if errResponse.Success || errResponse.Error == "" {
+			t.Errorf("%v: expected an error, got %+v", sides, errResponse)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/timeline"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// timelineImages maps the file names of timeline images to their content types
+var timelineImages = map[string]string{
+	"timeline.svg": "image/svg+xml",
+	"timeline.png": "image/png",
+}
+
+// renderTimeline renders the timeline image with the given file name. The request
+// accepts the filter and where parameters of /api/parse, player (a name or ID,
+// repeatable or comma-separated), from and to (game times such as 90s, 5m or MM:SS)
+// and title.
+func (s *WebServer) renderTimeline(r *http.Request, name string, data *vault.ReplayData) ([]byte, error) {
+	config, err := s.filterConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := timelineOptions(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if name == "timeline.png" {
+		err = timeline.WritePNG(&buf, config.Apply(data), opts)
+	} else {
+		err = timeline.WriteSVG(&buf, config.Apply(data), opts)
+	}
+	return buf.Bytes(), err
+}
+
+func timelineOptions(values url.Values) (timeline.Options, error) {
+	opts := timeline.Options{Title: values.Get("title")}
+	for _, value := range values["player"] {
+		for _, player := range strings.Split(value, ",") {
+			if player = strings.TrimSpace(player); player != "" {
+				opts.Players = append(opts.Players, player)
+			}
+		}
+	}
+
+	var err error
+	if opts.From, _, err = gameTimeParam(values, "from"); err != nil {
+		return opts, err
+	}
+	to, ok, err := gameTimeParam(values, "to")
+	if err != nil {
+		return opts, err
+	}
+	if ok && to <= opts.From {
+		return opts, fmt.Errorf("to must be later than from")
+	}
+	opts.To = to
+	return opts, nil
+}
+
+// writeTimelineImage writes a rendered timeline image
+func writeTimelineImage(w http.ResponseWriter, name string, image []byte) {
+	w.Header().Set("Content-Type", timelineImages[name])
+	w.Write(image)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTimelineImages(t *testing.T) {
+	s, upload := newShareServer(t)
+	entries, _ := s.library.List()
+	mux := s.routes()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/r/"+upload.ID+"/timeline.svg?filter=all&player=Tomsch&to=5m", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("GET timeline.svg = %d %s: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	svg := rec.Body.String()
+	if !strings.Contains(svg, "Grenadier Squad") || strings.Contains(svg, "Surgie") || strings.Contains(svg, "Used ability") {
+		t.Errorf("SVG does not show Tomsch's first five minutes:\n%s", svg)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/replays/"+entries[0].ID+"/timeline.png", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("GET timeline.png = %d %s: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if _, err := png.Decode(bytes.NewReader(rec.Body.Bytes())); err != nil {
+		t.Errorf("Invalid PNG: %v", err)
+	}
+
+	for _, query := range []string{"player=Nobody", "from=5m&to=1m", "from=soon", "filter=nope"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/r/"+upload.ID+"/timeline.svg?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET timeline.svg?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
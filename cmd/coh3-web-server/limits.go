@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Defaults of the upload limits
+const (
+	defaultParseTimeout = 30 * time.Second
+	defaultUploadRate   = 20 // Uploads per minute per client
+	busyRetryAfter      = 5 * time.Second
+)
+
+var (
+	// errServerBusy is returned when every parse slot is taken
+	errServerBusy = errors.New("the server is busy parsing other replays; try again shortly")
+	// errParseTimeout is returned when a replay takes longer than the parse timeout
+	errParseTimeout = errors.New("parsing the replay took too long")
+)
+
+// replayMagic is the game type a CoH3 replay declares in its header, right
+// after the 2-byte game version
+var replayMagic = []byte("COH3_REC")
+
+// replayMagicOffset is where replayMagic starts in a replay
+const replayMagicOffset = 2
+
+// checkReplayHeader checks that an upload starts like a CoH3 replay, so other
+// files are rejected before they reach the parser. The file is rewound afterwards.
+func checkReplayHeader(file io.ReadSeeker) error {
+	header := make([]byte, replayMagicOffset+len(replayMagic))
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if n < len(header) || !bytes.Equal(header[replayMagicOffset:], replayMagic) {
+		return errors.New("the file is not a CoH3 replay")
+	}
+	return nil
+}
+
+// parseWithLimits runs parse in one of the server's parse slots, cancelling it
+// after the parse timeout or when ctx is done. The slot is freed when parse
+// returns, so parse must really stop once its context is done, as a
+// vault.ParseWorker does by killing the child process.
+func (s *WebServer) parseWithLimits(ctx context.Context, parse func(ctx context.Context) (*vault.ReplayData, error)) (*vault.ReplayData, error) {
+	if s.parseSlots != nil {
+		select {
+		case s.parseSlots <- struct{}{}:
+			defer func() { <-s.parseSlots }()
+		default:
+			s.metrics.rejectUpload(failureBusy)
+			return nil, errServerBusy
+		}
+	}
+
+	timeout := s.parseTimeout
+	if timeout <= 0 {
+		timeout = defaultParseTimeout
+	}
+	parseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	data, err := parse(parseCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		s.metrics.rejectUpload(failureTimeout)
+		return nil, errParseTimeout
+	}
+	return data, err
+}
+
+// parseErrorStatus returns the HTTP status for a failed parse, setting
+// Retry-After when the client should try again later. Malformed replays get
+// the fallback status; any other failure is the server's and gets a 500.
+func parseErrorStatus(w http.ResponseWriter, err error, fallback int) int {
+	switch {
+	case errors.Is(err, errServerBusy):
+		w.Header().Set("Retry-After", strconv.Itoa(int(busyRetryAfter/time.Second)))
+		return http.StatusTooManyRequests
+	case errors.Is(err, errParseTimeout):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, vault.ErrNotReplay),
+		errors.Is(err, vault.ErrUnsupportedVersion),
+		errors.Is(err, vault.ErrCorruptReplay):
+		return fallback
+	}
+	return http.StatusInternalServerError
+}
+
+// rateLimiter limits how often each client may upload, with a token bucket per
+// client address that holds up to a minute's worth of uploads
+type rateLimiter struct {
+	perMinute float64
+	now       func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxTrackedClients bounds the memory used by the rate limiter; buckets that
+// have refilled completely are dropped when it is exceeded
+const maxTrackedClients = 4096
+
+// newRateLimiter returns a limiter allowing perMinute uploads per client, or
+// nil for no limit if perMinute is not positive
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{perMinute: float64(perMinute), now: time.Now, clients: make(map[string]*bucket)}
+}
+
+// allow takes a token from the client's bucket. If it is empty, it reports how
+// long until the next token.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxTrackedClients {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.perMinute, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(l.perMinute, b.tokens+now.Sub(b.last).Minutes()*l.perMinute)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets of clients that have not uploaded for long enough to refill
+func (l *rateLimiter) prune(now time.Time) {
+	for client, b := range l.clients {
+		if b.tokens+now.Sub(b.last).Minutes()*l.perMinute >= l.perMinute {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// clientAddress identifies the client of a request by its IP address
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitUpload applies the per-client upload rate limit, returning 429 with
+// Retry-After when the client has to wait
+func (s *WebServer) limitUpload(w http.ResponseWriter, r *http.Request) (int, error) {
+	ok, wait := s.uploadLimiter.allow(clientAddress(r))
+	if ok {
+		return http.StatusOK, nil
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	s.metrics.rejectUpload(failureRateLimited)
+	return http.StatusTooManyRequests, fmt.Errorf("too many uploads; try again in %d seconds", seconds)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func TestCheckReplayHeader(t *testing.T) {
+	for _, tt := range []struct {
+		content string
+		ok      bool
+	}{
+		{"\x13\x00COH3_REC\x00\x00", true},
+		{"\x13\x00COH3_REC", true},
+		{"", false},
+		{"COH2_REC", false},
+		{"MZ\x90\x00 not a replay", false},
+		{"\x13\x00COH3_RE", false},
+		{"COH3_REC\x13\x00", false},
+		{"\x13\x00\x00COH3_REC", false},
+		{"MZ\x90\x00\x00\x00COH3_REC", false},
+	} {
+		file := strings.NewReader(tt.content)
+		err := checkReplayHeader(file)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkReplayHeader(%q) = %v, want ok %v", tt.content, err, tt.ok)
+		}
+		if file.Len() != len(tt.content) {
+			t.Errorf("checkReplayHeader(%q) did not rewind the file", tt.content)
+		}
+	}
+}
+
+func TestUploadRejectsOtherFiles(t *testing.T) {
+	s, _ := newTestServer(t)
+	for _, path := range []string{"/api/parse", "/api/v1/replays"} {
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, uploadRequest(path, "game.rec", "<html>not a replay</html>"))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not a CoH3 replay") {
+			t.Errorf("POST %s with another file = %d %s, want 400", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	s := &WebServer{parseSlots: make(chan struct{}, 1), parseTimeout: 50 * time.Millisecond}
+	release := make(chan struct{})
+	// blocked stands for a parse that stops when cancelled, like a parse worker
+	blocked := func(ctx context.Context) (*vault.ReplayData, error) {
+		select {
+		case <-release:
+			return &vault.ReplayData{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// A parse that times out gives its slot back
+	if _, err := s.parseWithLimits(context.Background(), blocked); err != errParseTimeout {
+		t.Fatalf("slow parse = %v, want %v", err, errParseTimeout)
+	}
+	if len(s.parseSlots) != 0 {
+		t.Fatalf("%d parse slots still taken after the parse timed out", len(s.parseSlots))
+	}
+
+	// While a parse runs, the next one is turned away
+	running := make(chan error, 1)
+	s.parseTimeout = time.Minute
+	go func() {
+		_, err := s.parseWithLimits(context.Background(), blocked)
+		running <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.parseSlots) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := s.parseWithLimits(context.Background(), blocked); err != errServerBusy {
+		t.Fatalf("parse with no free slot = %v, want %v", err, errServerBusy)
+	}
+	rec := httptest.NewRecorder()
+	if status := parseErrorStatus(rec, errServerBusy, http.StatusBadRequest); status != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("parseErrorStatus(busy) = %d, Retry-After %q", status, rec.Header().Get("Retry-After"))
+	}
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{errParseTimeout, http.StatusServiceUnavailable},
+		{&vault.ParseError{Code: "not_a_replay"}, http.StatusBadRequest},
+		{&vault.ParseError{Code: "unsupported_version"}, http.StatusBadRequest},
+		{&vault.ParseError{Code: "corrupt_stream"}, http.StatusBadRequest},
+		{&vault.ParseError{Code: "internal_panic"}, http.StatusInternalServerError},
+		{&vault.ParseError{Code: "io"}, http.StatusInternalServerError},
+		{context.Canceled, http.StatusInternalServerError},
+	} {
+		if status := parseErrorStatus(httptest.NewRecorder(), tc.err, http.StatusBadRequest); status != tc.want {
+			t.Errorf("parseErrorStatus(%v) = %d, want %d", tc.err, status, tc.want)
+		}
+	}
+	close(release)
+	if err := <-running; err != nil {
+		t.Errorf("parse that finished = %v", err)
+	}
+	if len(s.parseSlots) != 0 {
+		t.Errorf("%d parse slots still taken after the parse finished", len(s.parseSlots))
+	}
+
+	// A parse whose request goes away reports the request's error, not a timeout
+	release = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.parseWithLimits(ctx, blocked); err != context.Canceled {
+		t.Errorf("parse of a cancelled request = %v, want %v", err, context.Canceled)
+	}
+}
+
+// hangParseEnv makes the test binary, started as a parse worker, hang like a
+// parser stuck inside vault on a pathological replay
+const hangParseEnv = "COH3_TEST_HANG_PARSE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(vault.ParseWorkerEnv) != "" && os.Getenv(hangParseEnv) != "" {
+		time.Sleep(time.Hour)
+	}
+	vault.RunParseWorker()
+	os.Exit(m.Run())
+}
+
+func TestParseTimeoutStopsHungParser(t *testing.T) {
+	s := &WebServer{parseSlots: make(chan struct{}, 1), parseTimeout: 100 * time.Millisecond, parseWorker: &vault.ParseWorker{}}
+	replay := filepath.Join(t.TempDir(), "game.rec")
+	if err := os.WriteFile(replay, []byte("\x13\x00COH3_REC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(hangParseEnv, "1")
+	if _, err := s.parseReplay(context.Background(), replay, vault.NewBuildOnlyFilter()); err != errParseTimeout {
+		t.Fatalf("parse of a hung replay = %v, want %v", err, errParseTimeout)
+	}
+	// The hung parser was stopped, so its slot is free for the next upload
+	if len(s.parseSlots) != 0 {
+		t.Fatalf("%d parse slots still taken after the hung parse was stopped", len(s.parseSlots))
+	}
+
+	os.Unsetenv(hangParseEnv)
+	if _, err := s.parseReplay(context.Background(), replay, vault.NewBuildOnlyFilter()); err == errServerBusy || err == errParseTimeout {
+		t.Errorf("parse after the hung parse = %v, want the parser's result", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("upload %d was limited", i+1)
+		}
+	}
+	if ok, wait := l.allow("a"); ok || wait != 30*time.Second {
+		t.Errorf("third upload = %v, wait %v; want limited for 30s", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("another client was limited")
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("upload after waiting was limited")
+	}
+
+	if ok, _ := newRateLimiter(0).allow("a"); !ok {
+		t.Error("a zero rate should not limit uploads")
+	}
+}
+
+func TestUploadRateLimit(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.uploadLimiter = newRateLimiter(1)
+
+	for i, want := range []int{http.StatusBadRequest, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, uploadRequest("/api/v1/replays", "notes.txt", "hello"))
+		if rec.Code != want {
+			t.Errorf("upload %d = %d %s, want %d", i+1, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+// uploadRequest builds a multipart upload of one replay file
+func uploadRequest(path, name, content string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("replay", name)
+	part.Write([]byte(content))
+	form.Close()
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
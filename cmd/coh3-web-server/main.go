@@ -1,23 +1,53 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
-
+	"syscall"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/pkg/milestones"
+	"github.com/scharissis/coh3-replay-analyser/pkg/share"
+	"github.com/scharissis/coh3-replay-analyser/pkg/timeline"
+	"github.com/scharissis/coh3-replay-analyser/pkg/watch"
 	"github.com/scharissis/coh3-replay-analyser/vault"
 )
 
 const defaultDataDir = "./data/coh3-data"
 
 type WebServer struct {
-	dataDir string
-	port    int
+	dataDir   string
+	maxUpload int64 // Largest accepted upload in bytes
+
+	parseSlots    chan struct{}      // Bounds concurrent parses; nil for no limit
+	parseWorker   *vault.ParseWorker // Parses replays in child processes; nil parses in process
+	parseTimeout  time.Duration      // How long a request waits for its parse
+	uploadLimiter *rateLimiter       // Per-client upload rate limit; nil for no limit
+
+	presets         *commands.PresetCatalog
+	library         *library.Library     // nil when the library could not be opened
+	resolver        *lookup.DataResolver // nil when the game data could not be loaded
+	milestoneConfig *milestones.Config   // nil uses milestones.DefaultConfig
+	cache           *vault.ParseCache    // nil when caching is disabled
+	shares          *share.Store         // nil when uploads are not kept
+	assets          *assets              // nil serves the web interface built into the binary
+	metrics         *serverMetrics       // nil when metrics are not collected
 }
 
 type TimelineEvent struct {
@@ -27,13 +57,18 @@ type TimelineEvent struct {
 	Timestamp    uint32 `json:"timestamp"`
 	TimestampStr string `json:"timestamp_str"`
 	CommandType  string `json:"command_type"`
+	Category     string `json:"category"`
 	Description  string `json:"description"`
 	Color        string `json:"color"`
+	Diff         string `json:"diff,omitempty"`  // In comparisons: common or unique
+	Delta        int64  `json:"delta,omitempty"` // In comparisons: ms later than the matching reference command
 }
 
 type ReplayResponse struct {
 	Success    bool            `json:"success"`
 	Error      string          `json:"error,omitempty"`
+	ID         string          `json:"id,omitempty"`        // Set when the upload is kept for sharing
+	Permalink  string          `json:"permalink,omitempty"` // Page the upload can be shared as
 	MapName    string          `json:"map_name,omitempty"`
 	Duration   string          `json:"duration,omitempty"`
 	Players    []PlayerSummary `json:"players,omitempty"`
@@ -46,34 +81,237 @@ type PlayerSummary struct {
 	Faction  string `json:"faction"`
 	Color    string `json:"color"`
 	Commands int    `json:"commands"`
+	Game     string `json:"game,omitempty"` // In comparisons: the replay the player is from
 }
 
+// playerColors are the timeline colors of players, in player order, shared with timeline images
+var playerColors = timeline.Colors
+
 func main() {
-	server := &WebServer{
-		dataDir: defaultDataDir,
-		port:    8080,
+	// Replays are parsed in child processes running this binary
+	vault.RunParseWorker()
+
+	server := &WebServer{parseWorker: &vault.ParseWorker{}, metrics: newServerMetrics()}
+
+	addr := flag.String("addr", envString("COH3_ADDR", ":8080"), "address to listen on, e.g. :8080 or 127.0.0.1:3000 (env COH3_ADDR)")
+	flag.StringVar(&server.dataDir, "data-dir", envString("COH3_DATA_DIR", defaultDataDir), "directory containing the coh3-data game data (env COH3_DATA_DIR)")
+	maxUpload := flag.Int64("max-upload-mb", envInt64("COH3_MAX_UPLOAD_MB", defaultMaxUpload>>20), "largest replay upload accepted in MB (env COH3_MAX_UPLOAD_MB)")
+	storageDir := flag.String("storage-dir", envString("COH3_STORAGE_DIR", ""), "directory holding the library, parse cache and shared uploads; individual directory flags take precedence (env COH3_STORAGE_DIR)")
+	tlsCert := flag.String("tls-cert", envString("COH3_TLS_CERT", ""), "TLS certificate file; serves HTTPS together with -tls-key (env COH3_TLS_CERT)")
+	tlsKey := flag.String("tls-key", envString("COH3_TLS_KEY", ""), "TLS private key file (env COH3_TLS_KEY)")
+	maxParses := flag.Int64("max-parses", envInt64("COH3_MAX_PARSES", int64(runtime.NumCPU())), "replays parsed at once; further uploads get 429 (env COH3_MAX_PARSES)")
+	flag.DurationVar(&server.parseTimeout, "parse-timeout", envDuration("COH3_PARSE_TIMEOUT", defaultParseTimeout), "longest a request waits for its replay to be parsed (env COH3_PARSE_TIMEOUT)")
+	uploadRate := flag.Int64("upload-rate", envInt64("COH3_UPLOAD_RATE", defaultUploadRate), "uploads per minute allowed per client address, 0 for no limit (env COH3_UPLOAD_RATE)")
+	watchDir := flag.String("watch", "", "directory to watch for new replays, e.g. the CoH3 playback folder")
+	libraryDir := flag.String("library", "", "replay library directory (default: $COH3_LIBRARY_DIR or the user config directory)")
+	cacheDir := flag.String("cache-dir", "", "parse cache directory (default: $COH3_CACHE_DIR or the user cache directory)")
+	noCache := flag.Bool("no-cache", false, "always re-parse uploaded replays instead of using the parse cache")
+	shareDir := flag.String("share-dir", "", "directory uploads are kept in for permalinks (default: $COH3_SHARE_DIR or the user config directory)")
+	noShare := flag.Bool("no-share", false, "do not keep uploaded replays or create permalinks")
+	shareRetention := flag.Duration("share-retention", 30*24*time.Hour, "how long shared uploads are kept after their last upload (0 keeps them forever)")
+	shareMaxFile := flag.Int64("share-max-file-mb", 32, "largest replay kept for sharing in MB (0 for no limit)")
+	shareQuota := flag.Int64("share-quota-mb", 1024, "total size of shared replays in MB; the oldest are removed first (0 for no limit)")
+	milestonesConfig := flag.String("milestones-config", envString("COH3_MILESTONES_CONFIG", ""), "JSON or YAML file overriding the per-faction milestone configuration (env COH3_MILESTONES_CONFIG)")
+	devDir := flag.String("dev", "", "serve the web interface from this directory for live editing, e.g. cmd/coh3-web-server/web")
+	flag.Parse()
+
+	// A port given as the only argument is kept for compatibility with -addr
+	if flag.NArg() > 0 {
+		port, err := strconv.Atoi(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Invalid port %q", flag.Arg(0))
+		}
+		*addr = fmt.Sprintf(":%d", port)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	server.maxUpload = *maxUpload << 20
+	if *maxParses > 0 {
+		server.parseSlots = make(chan struct{}, *maxParses)
+	}
+	server.uploadLimiter = newRateLimiter(int(*uploadRate))
+
+	// A storage directory holds every store that is not configured individually
+	if *storageDir != "" {
+		if *libraryDir == "" {
+			*libraryDir = filepath.Join(*storageDir, "library")
+		}
+		if *cacheDir == "" {
+			*cacheDir = filepath.Join(*storageDir, "cache")
+		}
+		if *shareDir == "" {
+			*shareDir = filepath.Join(*storageDir, "shared")
+		}
+	}
+
+	if *devDir != "" {
+		assets, err := devAssets(*devDir)
+		if err != nil {
+			log.Fatalf("Cannot serve the web interface from %s: %v", *devDir, err)
+		}
+		server.assets = assets
+		log.Printf("Dev mode: serving the web interface from %s", *devDir)
+	}
+
+	// Load built-in and user-defined filter presets
+	server.presets = commands.NewPresetCatalog(commands.BuiltinPresets()...)
+	if presetDir, err := commands.DefaultPresetDir(); err == nil {
+		presets, err := commands.LoadPresetCatalog(presetDir)
+		if err != nil {
+			log.Printf("Failed to load filter presets from %s: %v", presetDir, err)
+		}
+		server.presets = presets
+	}
+
+	if *milestonesConfig != "" {
+		config, err := milestones.LoadConfig(*milestonesConfig)
+		if err != nil {
+			log.Fatalf("Cannot load the milestone configuration: %v", err)
+		}
+		server.milestoneConfig = &config
+	}
+
+	// Load game data for milestone detection in player profiles
+	if resolver, err := lookup.NewDataResolver(server.dataDir); err == nil {
+		server.resolver = resolver
+	} else {
+		log.Printf("Game data not loaded, profiles will not report vehicles: %v", err)
+	}
+
+	// Cache parse results so re-uploads and filter changes skip the parser
+	if !*noCache {
+		if *cacheDir == "" {
+			if dir, err := vault.DefaultCacheDir(); err == nil {
+				*cacheDir = dir
+			}
+		}
+		if cache, err := vault.OpenParseCache(*cacheDir, server.dataDir); err == nil {
+			cache.Worker = server.parseWorker
+			server.cache = cache
+		} else {
+			log.Printf("Parse cache disabled: %v", err)
+		}
+	}
+
+	// Open the local replay library
+	if *libraryDir == "" {
+		if dir, err := library.DefaultDir(); err == nil {
+			*libraryDir = dir
+		}
+	}
+	if lib, err := library.Open(*libraryDir); err == nil {
+		server.library = lib
+	} else {
+		log.Printf("Replay library disabled: %v", err)
+	}
+
+	// Keep uploads so they can be shared by permalink
+	if !*noShare {
+		if *shareDir == "" {
+			if dir, err := share.DefaultDir(); err == nil {
+				*shareDir = dir
+			}
+		}
+		shares, err := share.Open(*shareDir, share.Options{
+			Retention:    *shareRetention,
+			MaxFileSize:  *shareMaxFile << 20,
+			MaxTotalSize: *shareQuota << 20,
+		})
+		if err == nil {
+			server.shares = shares
+			go server.pruneShares(time.Hour)
+		} else {
+			log.Printf("Permalinks disabled: %v", err)
+		}
 	}
 
-	// Parse command line arguments
-	if len(os.Args) > 1 {
-		if port, err := strconv.Atoi(os.Args[1]); err == nil {
-			server.port = port
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *watchDir != "" {
+		if server.library == nil {
+			log.Fatal("Cannot watch for replays without a replay library")
 		}
+		go server.watchReplays(ctx, *watchDir)
+	}
+
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("🚀 CoH3 Replay Analyzer Web Server starting on %s://%s\n", scheme, displayAddr(*addr))
+
+	if err := serve(ctx, newHTTPServer(*addr, server.routes()), *tlsCert, *tlsKey); err != nil {
+		log.Fatal(err)
 	}
+}
+
+// displayAddr returns a listen address as a host:port to open in a browser
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
 
-	server.setupRoutes()
-	fmt.Printf("🚀 CoH3 Replay Analyzer Web Server starting on http://localhost:%d\n", server.port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", server.port), nil))
+// watchReplays imports new replays from dir into the library as the game saves
+// them, until ctx is done. Replays are parsed through the parse cache, but not
+// in a parse slot, so uploads cannot make the watcher miss a replay.
+func (s *WebServer) watchReplays(ctx context.Context, dir string) {
+	log.Printf("Watching %s for new replays", dir)
+	watcher := watch.New(dir, watch.Options{})
+	err := watcher.Run(ctx, func(path string) {
+		data, err := s.parse(ctx, path, vault.NewBuildOnlyFilter())
+		if err != nil {
+			log.Printf("Watch: failed to parse %s: %v", path, err)
+			return
+		}
+		if entry, added, err := s.library.Add(path, data); err != nil {
+			log.Printf("Watch: failed to store %s: %v", path, err)
+		} else if added {
+			log.Printf("Watch: imported %s as %s", path, entry.ID)
+		}
+	})
+	if err != nil {
+		log.Printf("Watch: stopped watching %s: %v", dir, err)
+	}
 }
 
-func (s *WebServer) setupRoutes() {
+// routes returns the server's request router
+func (s *WebServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
 	// Serve static files
-	http.HandleFunc("/", s.handleHome)
-	http.HandleFunc("/upload", s.handleUpload)
-	http.HandleFunc("/api/parse", s.handleParseReplay)
+	mux.HandleFunc("/", s.handleHome)
+	mux.HandleFunc("/upload", s.handleUpload)
+	mux.HandleFunc("/api/parse", s.handleParseReplay)
+	mux.HandleFunc("/api/presets", s.handlePresets)
+	mux.HandleFunc("/api/library", s.handleLibrary)
+	mux.HandleFunc("/api/library/", s.handleLibraryReplay)
+	mux.HandleFunc("/api/shared/", s.handleSharedReplayData)
+	mux.HandleFunc("/api/compare", s.handleCompare)
+	mux.HandleFunc("/api/profile", s.handleProfile)
+	mux.HandleFunc("/api/meta", s.handleMeta)
+	mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
+	s.setupAPIRoutes(mux)
+	mux.HandleFunc("/profile", s.handleProfilePage)
+	mux.HandleFunc("/r/", s.handleSharedReplay)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.Handle("/metrics", s.metrics)
 	
 	// Static assets
-	http.HandleFunc("/static/", s.handleStatic)
+	mux.HandleFunc("/static/", s.web().serveStatic)
+	return mux
+}
+
+// web returns the web interface's templates and static files
+func (s *WebServer) web() *assets {
+	if s.assets != nil {
+		return s.assets
+	}
+	return embeddedAssets
 }
 
 func (s *WebServer) handleHome(w http.ResponseWriter, r *http.Request) {
@@ -81,693 +319,13 @@ func (s *WebServer) handleHome(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	s.writeHomePage(w, r, nil)
+}
 
-	tmpl := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>CoH3 Replay Analyzer</title>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body { 
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; 
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            min-height: 100vh;
-            color: #333;
-        }
-        .container { 
-            max-width: 95vw; 
-            margin: 0 auto; 
-            padding: 20px; 
-        }
-        .header {
-            text-align: center;
-            color: white;
-            margin-bottom: 30px;
-        }
-        .header h1 {
-            font-size: 2.5rem;
-            margin-bottom: 10px;
-            text-shadow: 2px 2px 4px rgba(0,0,0,0.3);
-        }
-        .header p {
-            font-size: 1.1rem;
-            opacity: 0.9;
-        }
-        .upload-area {
-            background: white;
-            border-radius: 15px;
-            padding: 40px;
-            text-align: center;
-            box-shadow: 0 10px 30px rgba(0,0,0,0.2);
-            margin-bottom: 30px;
-            border: 3px dashed #ddd;
-            transition: all 0.3s ease;
-        }
-        .upload-area:hover {
-            border-color: #667eea;
-            transform: translateY(-2px);
-        }
-        .upload-area.dragover {
-            border-color: #667eea;
-            background: #f8f9ff;
-        }
-        #file-input {
-            display: none;
-        }
-        .upload-btn {
-            background: #667eea;
-            color: white;
-            padding: 12px 30px;
-            border: none;
-            border-radius: 25px;
-            font-size: 1rem;
-            cursor: pointer;
-            transition: all 0.3s ease;
-        }
-        .upload-btn:hover {
-            background: #5a67d8;
-            transform: translateY(-1px);
-        }
-        .results {
-            background: white;
-            border-radius: 15px;
-            padding: 30px;
-            box-shadow: 0 10px 30px rgba(0,0,0,0.2);
-            display: none;
-        }
-        .filters {
-            background: white;
-            border-radius: 15px;
-            padding: 20px;
-            margin-bottom: 20px;
-            box-shadow: 0 5px 15px rgba(0,0,0,0.1);
-        }
-        .filter-row {
-            display: flex;
-            gap: 15px;
-            align-items: center;
-            flex-wrap: wrap;
-            margin-bottom: 15px;
-        }
-        .filter-group {
-            display: flex;
-            align-items: center;
-            gap: 10px;
-        }
-        .filter-label {
-            font-weight: 500;
-            color: #333;
-            white-space: nowrap;
-        }
-        select, input[type="range"] {
-            padding: 8px 12px;
-            border: 2px solid #ddd;
-            border-radius: 6px;
-            font-size: 0.9rem;
-        }
-        select:focus, input[type="range"]:focus {
-            outline: none;
-            border-color: #667eea;
-        }
-        .timeline-container {
-            background: white;
-            border-radius: 15px;
-            padding: 20px;
-            box-shadow: 0 5px 15px rgba(0,0,0,0.1);
-            overflow-x: auto;
-        }
-        .timeline-header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 20px;
-        }
-        .timeline-grid {
-            display: flex;
-            gap: 20px;
-            min-width: 800px;
-        }
-        .timeline-columns {
-            display: flex;
-            gap: 15px;
-            flex: 1;
-        }
-        .player-column {
-            background: #f8f9ff;
-            border-radius: 10px;
-            padding: 15px;
-            border-top: 4px solid;
-            flex: 1;
-            min-height: 800px;
-            position: relative;
-        }
-        .player-column-header {
-            text-align: center;
-            margin-bottom: 15px;
-            padding-bottom: 10px;
-            border-bottom: 2px solid #eee;
-        }
-        .player-column-name {
-            font-weight: bold;
-            font-size: 1.1rem;
-            margin-bottom: 5px;
-        }
-        .player-column-faction {
-            color: #666;
-            font-size: 0.9rem;
-        }
-        .timeline-content {
-            position: relative;
-            height: calc(100% - 60px);
-        }
-        .timeline-item {
-            position: absolute;
-            left: 0;
-            right: 0;
-            background: white;
-            padding: 10px 15px;
-            border-radius: 8px;
-            border-left: 4px solid;
-            box-shadow: 0 2px 6px rgba(0,0,0,0.1);
-            transition: all 0.2s ease;
-            min-height: 50px;
-            display: flex;
-            flex-direction: column;
-            justify-content: center;
-            margin-bottom: 8px;
-        }
-        .timeline-item:hover {
-            transform: translateX(3px);
-            box-shadow: 0 4px 8px rgba(0,0,0,0.15);
-            z-index: 10;
-        }
-        .timeline-time {
-            font-weight: bold;
-            font-size: 0.9rem;
-            color: #666;
-            margin-bottom: 6px;
-        }
-        .timeline-command {
-            font-size: 0.95rem;
-            line-height: 1.4;
-            word-wrap: break-word;
-        }
-        .time-markers {
-            background: linear-gradient(135deg, #f8f9ff 0%, #e8eaff 100%);
-            border-right: 3px solid #ddd;
-            padding: 15px;
-            min-width: 80px;
-            border-radius: 10px 0 0 10px;
-            position: relative;
-        }
-        .time-markers-header {
-            text-align: center;
-            margin-bottom: 15px;
-            padding-bottom: 10px;
-            border-bottom: 2px solid #ddd;
-            font-weight: bold;
-            color: #333;
-        }
-        .time-markers-content {
-            position: relative;
-            height: calc(100% - 60px);
-        }
-        .time-marker {
-            position: absolute;
-            left: 0;
-            right: 0;
-            height: 40px;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            font-size: 0.9rem;
-            font-weight: bold;
-            color: #666;
-            border-bottom: 1px solid #ccc;
-            background: rgba(255,255,255,0.7);
-        }
-        .time-marker.major {
-            background: rgba(102, 126, 234, 0.1);
-            border-bottom: 2px solid #667eea;
-            color: #667eea;
-            font-size: 1rem;
-        }
-        .loading {
-            text-align: center;
-            padding: 20px;
-            display: none;
-        }
-        .spinner {
-            border: 4px solid #f3f3f3;
-            border-top: 4px solid #667eea;
-            border-radius: 50%;
-            width: 40px;
-            height: 40px;
-            animation: spin 1s linear infinite;
-            margin: 0 auto 20px;
-        }
-        @keyframes spin {
-            0% { transform: rotate(0deg); }
-            100% { transform: rotate(360deg); }
-        }
-        .error {
-            background: #fee;
-            color: #c53030;
-            padding: 15px;
-            border-radius: 8px;
-            margin: 20px 0;
-            border-left: 4px solid #c53030;
-        }
-        .replay-info {
-            background: linear-gradient(135deg, #f8f9ff 0%, #e8eaff 100%);
-            border-radius: 15px;
-            padding: 25px;
-            margin-bottom: 30px;
-            box-shadow: 0 5px 15px rgba(0,0,0,0.1);
-        }
-        .info-header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 20px;
-            flex-wrap: wrap;
-            gap: 20px;
-        }
-        .info-title {
-            font-size: 1.5rem;
-            font-weight: bold;
-            color: #333;
-        }
-        .info-grid {
-            display: grid;
-            grid-template-columns: repeat(auto-fit, minmax(150px, 1fr));
-            gap: 15px;
-            margin-bottom: 20px;
-        }
-        .info-card {
-            background: white;
-            padding: 15px;
-            border-radius: 10px;
-            text-align: center;
-            box-shadow: 0 2px 8px rgba(0,0,0,0.1);
-        }
-        .info-value {
-            font-size: 1.3rem;
-            font-weight: bold;
-            color: #667eea;
-            margin-bottom: 5px;
-        }
-        .info-label {
-            color: #666;
-            font-size: 0.85rem;
-            text-transform: uppercase;
-            letter-spacing: 0.5px;
-        }
-        .players-summary {
-            display: grid;
-            grid-template-columns: repeat(auto-fit, minmax(200px, 1fr));
-            gap: 15px;
-        }
-        .player-summary {
-            background: white;
-            padding: 15px;
-            border-radius: 10px;
-            box-shadow: 0 2px 8px rgba(0,0,0,0.1);
-            border-left: 4px solid;
-        }
-        .player-name {
-            font-weight: bold;
-            font-size: 1.1rem;
-            margin-bottom: 5px;
-        }
-        .player-faction {
-            color: #666;
-            font-size: 0.9rem;
-            margin-bottom: 10px;
-        }
-        .player-stats {
-            font-size: 0.85rem;
-            color: #888;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🎮 CoH3 Replay Analyzer</h1>
-            <p>Upload a Company of Heroes 3 replay file (.rec) to analyze build orders and timelines</p>
-        </div>
-
-        <div class="upload-area" id="upload-area">
-            <h3>📁 Upload Replay File</h3>
-            <p style="margin: 15px 0; color: #666;">Drag and drop a .rec file here, or click to browse</p>
-            <input type="file" id="file-input" accept=".rec" />
-            <button class="upload-btn" onclick="document.getElementById('file-input').click()">
-                Choose File
-            </button>
-        </div>
-
-        <div class="loading" id="loading">
-            <div class="spinner"></div>
-            <p>Parsing replay file...</p>
-        </div>
-
-        <div class="results" id="results">
-            <div class="replay-info" id="replay-info"></div>
-            
-            <div class="filters">
-                <div class="filter-row">
-                    <div class="filter-group">
-                        <label class="filter-label">Command Type:</label>
-                        <select id="command-filter">
-                            <option value="all">All Commands</option>
-                            <option value="build_squad">Units Only</option>
-                            <option value="construct_entity">Buildings Only</option>
-                            <option value="build_global_upgrade">Upgrades Only</option>
-                            <option value="select_battlegroup">Battlegroups Only</option>
-                        </select>
-                    </div>
-                    <div class="filter-group">
-                        <label class="filter-label">Player:</label>
-                        <select id="player-filter">
-                            <option value="all">All Players</option>
-                        </select>
-                    </div>
-                    <div class="filter-group">
-                        <label class="filter-label">Time Range:</label>
-                        <input type="range" id="time-filter" min="0" max="100" value="100">
-                        <span id="time-display">All</span>
-                    </div>
-                </div>
-            </div>
-
-            <div class="timeline-container">
-                <div class="timeline-header">
-                    <h3>📊 Build Order Timeline</h3>
-                    <div id="visible-commands">Showing all commands</div>
-                </div>
-                <div class="timeline-grid">
-                    <div class="timeline-columns" id="timeline-columns"></div>
-                </div>
-            </div>
-        </div>
-    </div>
-
-    <script>
-        const uploadArea = document.getElementById('upload-area');
-        const fileInput = document.getElementById('file-input');
-        const loading = document.getElementById('loading');
-        const results = document.getElementById('results');
-
-        // Drag and drop functionality
-        uploadArea.addEventListener('dragover', (e) => {
-            e.preventDefault();
-            uploadArea.classList.add('dragover');
-        });
-
-        uploadArea.addEventListener('dragleave', () => {
-            uploadArea.classList.remove('dragover');
-        });
-
-        uploadArea.addEventListener('drop', (e) => {
-            e.preventDefault();
-            uploadArea.classList.remove('dragover');
-            const files = e.dataTransfer.files;
-            if (files.length > 0) {
-                handleFile(files[0]);
-            }
-        });
-
-        fileInput.addEventListener('change', (e) => {
-            if (e.target.files.length > 0) {
-                handleFile(e.target.files[0]);
-            }
-        });
-
-        function handleFile(file) {
-            if (!file.name.endsWith('.rec')) {
-                alert('Please select a .rec replay file');
-                return;
-            }
-
-            const formData = new FormData();
-            formData.append('replay', file);
-
-            loading.style.display = 'block';
-            results.style.display = 'none';
-
-            fetch('/api/parse', {
-                method: 'POST',
-                body: formData
-            })
-            .then(response => response.json())
-            .then(data => {
-                loading.style.display = 'none';
-                if (data.success) {
-                    displayResults(data);
-                } else {
-                    displayError(data.error);
-                }
-            })
-            .catch(error => {
-                loading.style.display = 'none';
-                displayError('Error parsing replay: ' + error.message);
-            });
-        }
-
-        let currentData = null;
-        let maxTimestamp = 0;
-
-        function displayResults(data) {
-            currentData = data;
-            maxTimestamp = Math.max(...data.timeline.map(e => e.timestamp));
-            
-            displayReplayInfo(data);
-            setupFilters(data);
-            displayTimeline(data.timeline);
-            
-            results.style.display = 'block';
-        }
-
-        function displayReplayInfo(data) {
-            const replayInfo = document.getElementById('replay-info');
-            
-            // Basic info
-            const infoGrid = 
-                '<div class="info-header">' +
-                    '<div class="info-title">📋 ' + data.map_name + '</div>' +
-                '</div>' +
-                '<div class="info-grid">' +
-                    '<div class="info-card">' +
-                        '<div class="info-value">' + data.duration + '</div>' +
-                        '<div class="info-label">Duration</div>' +
-                    '</div>' +
-                    '<div class="info-card">' +
-                        '<div class="info-value">' + data.players.length + '</div>' +
-                        '<div class="info-label">Players</div>' +
-                    '</div>' +
-                    '<div class="info-card">' +
-                        '<div class="info-value">' + data.timeline.length + '</div>' +
-                        '<div class="info-label">Commands</div>' +
-                    '</div>' +
-                '</div>';
-
-            // Players summary
-            const playersSummary = 
-                '<div class="players-summary">' +
-                data.players.map(player => 
-                    '<div class="player-summary" style="border-left-color: ' + player.color + '">' +
-                        '<div class="player-name" style="color: ' + player.color + '">' + player.name + '</div>' +
-                        '<div class="player-faction">' + player.faction + '</div>' +
-                        '<div class="player-stats">' + player.commands + ' commands</div>' +
-                    '</div>'
-                ).join('') +
-                '</div>';
-
-            replayInfo.innerHTML = infoGrid + playersSummary;
-        }
-
-        function setupFilters(data) {
-            // Populate player filter
-            const playerFilter = document.getElementById('player-filter');
-            const players = data.players;
-            playerFilter.innerHTML = '<option value="all">All Players</option>' +
-                players.map(player => '<option value="' + player.id + '">' + player.name + '</option>').join('');
-
-            // Set up time filter
-            const timeFilter = document.getElementById('time-filter');
-            const timeDisplay = document.getElementById('time-display');
-            
-            timeFilter.addEventListener('input', function() {
-                const percentage = this.value;
-                const maxTime = maxTimestamp * (percentage / 100);
-                const minutes = Math.floor(maxTime / 60000);
-                const seconds = Math.floor((maxTime % 60000) / 1000);
-                timeDisplay.textContent = percentage == 100 ? 'All' : 
-                    String(minutes).padStart(2, '0') + ':' + String(seconds).padStart(2, '0');
-                applyFilters();
-            });
-
-            // Set up other filters
-            document.getElementById('command-filter').addEventListener('change', applyFilters);
-            document.getElementById('player-filter').addEventListener('change', applyFilters);
-        }
-
-        function applyFilters() {
-            const commandFilter = document.getElementById('command-filter').value;
-            const playerFilter = document.getElementById('player-filter').value;
-            const timePercentage = document.getElementById('time-filter').value;
-            const maxTime = maxTimestamp * (timePercentage / 100);
-
-            let filteredTimeline = currentData.timeline.filter(event => {
-                if (commandFilter !== 'all' && event.command_type !== commandFilter) return false;
-                if (playerFilter !== 'all' && event.player_id.toString() !== playerFilter) return false;
-                if (event.timestamp > maxTime) return false;
-                return true;
-            });
-
-            displayTimeline(filteredTimeline);
-            
-            const visibleCommands = document.getElementById('visible-commands');
-            visibleCommands.textContent = 'Showing ' + filteredTimeline.length + ' of ' + currentData.timeline.length + ' commands';
-        }
-
-        function displayTimeline(timeline) {
-            const timelineGrid = document.querySelector('.timeline-grid');
-            
-            // Calculate timeline parameters
-            const timelineHeight = 800; // Increased height for better spacing
-            const headerHeight = 60;
-            const contentHeight = timelineHeight - headerHeight;
-            
-            // Group events by player
-            const playerEvents = {};
-            currentData.players.forEach(player => {
-                playerEvents[player.id] = timeline.filter(event => event.player_id === player.id);
-            });
-            
-            // Create a unified timeline that handles both time markers and events
-            const unifiedTimeline = createUnifiedTimeline(playerEvents, contentHeight);
-            
-            // Create time markers based on unified timeline
-            const timeMarkersHtml = createUnifiedTimeMarkers(unifiedTimeline, contentHeight);
-            
-            // Create player columns HTML from unified timeline
-            const playerColumnsHtml = currentData.players.map(player => {
-                return createUnifiedPlayerColumn(player, unifiedTimeline, contentHeight);
-            }).join('');
-            
-            timelineGrid.innerHTML = timeMarkersHtml + '<div class="timeline-columns">' + playerColumnsHtml + '</div>';
-        }
-
-        function createUnifiedTimeline(playerEvents, contentHeight) {
-            // Collect all events and time markers into a unified timeline
-            const allItems = [];
-            
-            // Add time markers every 30 seconds
-            const maxMinutes = Math.ceil(maxTimestamp / 60000);
-            for (let seconds = 0; seconds <= maxMinutes * 60; seconds += 30) {
-                const minutes = Math.floor(seconds / 60);
-                const remainingSeconds = seconds % 60;
-                const timeStr = String(minutes).padStart(2, '0') + ':' + String(remainingSeconds).padStart(2, '0');
-                const timestamp = seconds * 1000;
-                const isMajor = remainingSeconds === 0;
-                
-                allItems.push({
-                    type: 'time_marker',
-                    timestamp: timestamp,
-                    timeStr: timeStr,
-                    major: isMajor
-                });
-            }
-            
-            // Add all player events
-            Object.keys(playerEvents).forEach(playerId => {
-                playerEvents[playerId].forEach(event => {
-                    allItems.push({
-                        type: 'event',
-                        timestamp: event.timestamp,
-                        playerId: event.player_id,
-                        event: event
-                    });
-                });
-            });
-            
-            // Sort all items by timestamp
-            allItems.sort((a, b) => a.timestamp - b.timestamp);
-            
-            // Assign positions with overlap prevention
-            const itemHeight = 58;
-            const positionedItems = [];
-            let currentPosition = 0;
-            
-            allItems.forEach(item => {
-                const idealPosition = (item.timestamp / maxTimestamp) * contentHeight;
-                let actualPosition = Math.max(idealPosition, currentPosition);
-                
-                // For events, ensure minimum spacing
-                if (item.type === 'event') {
-                    actualPosition = Math.max(actualPosition, currentPosition);
-                    currentPosition = actualPosition + itemHeight;
-                }
-                
-                positionedItems.push({
-                    ...item,
-                    position: actualPosition
-                });
-            });
-            
-            return positionedItems;
-        }
-
-        function createUnifiedTimeMarkers(unifiedTimeline, contentHeight) {
-            const timeMarkers = unifiedTimeline.filter(item => item.type === 'time_marker');
-            
-            const markersContent = timeMarkers.map(marker => 
-                '<div class="time-marker' + (marker.major ? ' major' : '') + '" style="top: ' + marker.position + 'px">' +
-                    marker.timeStr +
-                '</div>'
-            ).join('');
-            
-            return '<div class="time-markers">' +
-                '<div class="time-markers-header">⏱️ Time</div>' +
-                '<div class="time-markers-content">' + markersContent + '</div>' +
-            '</div>';
-        }
-
-        function createUnifiedPlayerColumn(player, unifiedTimeline, contentHeight) {
-            const playerEvents = unifiedTimeline.filter(item => 
-                item.type === 'event' && item.playerId === player.id
-            );
-            
-            const eventsHtml = playerEvents.map(item => {
-                return '<div class="timeline-item" style="top: ' + item.position + 'px; border-left-color: ' + item.event.color + '">' +
-                    '<div class="timeline-time">' + item.event.timestamp_str + '</div>' +
-                    '<div class="timeline-command">' + item.event.description + '</div>' +
-                '</div>';
-            }).join('');
-            
-            return '<div class="player-column" style="border-top-color: ' + player.color + '; height: 800px">' +
-                '<div class="player-column-header">' +
-                    '<div class="player-column-name" style="color: ' + player.color + '">' + player.name + '</div>' +
-                    '<div class="player-column-faction">' + player.faction + ' (' + playerEvents.length + ' commands)</div>' +
-                '</div>' +
-                '<div class="timeline-content">' + eventsHtml + '</div>' +
-            '</div>';
-        }
-
-        function displayError(message) {
-            results.innerHTML = '<div class="error">❌ ' + message + '</div>';
-            results.style.display = 'block';
-        }
-    </script>
-</body>
-</html>`
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(tmpl))
+// writeHomePage writes the web interface. A shared replay is embedded in the
+// page so its timeline is shown without another request.
+func (s *WebServer) writeHomePage(w http.ResponseWriter, r *http.Request, shared *ReplayResponse) {
+	s.web().render(w, r, "index.html", struct{ Shared *ReplayResponse }{shared})
 }
 
 func (s *WebServer) handleUpload(w http.ResponseWriter, r *http.Request) {
@@ -782,29 +340,36 @@ func (s *WebServer) handleParseReplay(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse multipart form
-	err := r.ParseMultipartForm(32 << 20) // 32MB max
-	if err != nil {
-		s.sendJSONError(w, "Failed to parse upload: "+err.Error())
+	if status, err := s.readUpload(w, r); err != nil {
+		s.writeJSONError(w, status, err.Error())
 		return
 	}
 
 	file, handler, err := r.FormFile("replay")
 	if err != nil {
+		s.metrics.rejectUpload(failureInvalidUpload)
 		s.sendJSONError(w, "No replay file uploaded")
 		return
 	}
 	defer file.Close()
+	s.metrics.observeUpload(handler.Size)
 
-	// Validate file extension
+	// Validate file extension and header
 	if !strings.HasSuffix(strings.ToLower(handler.Filename), ".rec") {
+		s.metrics.rejectUpload(failureInvalidUpload)
 		s.sendJSONError(w, "Please upload a .rec replay file")
 		return
 	}
+	if err := checkReplayHeader(file); err != nil {
+		s.metrics.rejectUpload(failureNotReplay)
+		s.sendJSONError(w, "Please upload a CoH3 replay: "+err.Error())
+		return
+	}
 
 	// Create temporary file
 	tempFile, err := os.CreateTemp("", "replay_*.rec")
 	if err != nil {
-		s.sendJSONError(w, "Failed to create temporary file")
+		s.writeJSONError(w, http.StatusInternalServerError, "Failed to create temporary file")
 		return
 	}
 	defer os.Remove(tempFile.Name())
@@ -813,32 +378,196 @@ func (s *WebServer) handleParseReplay(w http.ResponseWriter, r *http.Request) {
 	// Copy uploaded file to temp file
 	_, err = io.Copy(tempFile, file)
 	if err != nil {
-		s.sendJSONError(w, "Failed to save uploaded file")
+		s.writeJSONError(w, http.StatusInternalServerError, "Failed to save uploaded file")
+		return
+	}
+
+	config, err := s.filterConfig(r)
+	if err != nil {
+		s.sendJSONError(w, err.Error())
 		return
 	}
 
 	// Parse the replay
-	replayData, err := vault.ParseReplayWithLookup(tempFile.Name(), s.dataDir)
+	replayData, err := s.parseReplay(r.Context(), tempFile.Name(), config.ToVaultFilter())
 	if err != nil {
-		s.sendJSONError(w, "Failed to parse replay: "+err.Error())
+		s.writeJSONError(w, parseErrorStatus(w, err, http.StatusBadRequest), "Failed to parse replay: "+err.Error())
 		return
 	}
+	upload := s.keepUpload(tempFile.Name(), handler.Filename, replayData)
+	replayData = config.Apply(replayData)
 
 	// Convert to web response format
 	response := s.convertToWebResponse(replayData)
+	if upload != nil {
+		response.ID = upload.ID
+		response.Permalink = permalink(upload.ID)
+	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *WebServer) handleStatic(w http.ResponseWriter, r *http.Request) {
-	// For future static assets (CSS, JS files)
-	http.NotFound(w, r)
+// milestoneExtractor returns a milestone extractor with the server's configuration
+func (s *WebServer) milestoneExtractor() *milestones.Extractor {
+	config := milestones.DefaultConfig()
+	if s.milestoneConfig != nil {
+		config = *s.milestoneConfig
+	}
+	return milestones.NewExtractor(config, s.resolver)
+}
+
+// parseReplay parses and enriches a replay, using the parse cache when enabled.
+// It fails with errServerBusy when every parse slot is taken, with
+// errParseTimeout when parsing takes too long, and with ctx.Err() when ctx is
+// done first.
+func (s *WebServer) parseReplay(ctx context.Context, path string, filter vault.CommandFilter) (*vault.ReplayData, error) {
+	return s.parseWithLimits(ctx, func(ctx context.Context) (*vault.ReplayData, error) {
+		return s.parse(ctx, path, filter)
+	})
+}
+
+// parse parses and enriches a replay through the parse cache when enabled,
+// recording the parse in the metrics
+func (s *WebServer) parse(ctx context.Context, path string, filter vault.CommandFilter) (*vault.ReplayData, error) {
+	done := s.metrics.parseStarted()
+	defer done()
+
+	var data *vault.ReplayData
+	var stats vault.ParseStats
+	var err error
+	if s.cache != nil {
+		data, stats, err = s.cache.ParseReplayContext(ctx, path, filter)
+	} else {
+		data, stats, err = s.parseUncached(ctx, path, filter)
+	}
+	s.metrics.observeParse(stats, s.cache != nil, err)
+	return data, err
+}
+
+// parseUncached parses a replay and enriches it with the game data loaded at startup
+func (s *WebServer) parseUncached(ctx context.Context, path string, filter vault.CommandFilter) (*vault.ReplayData, vault.ParseStats, error) {
+	var stats vault.ParseStats
+	start := time.Now()
+	var data *vault.ReplayData
+	var err error
+	if s.parseWorker != nil {
+		data, err = s.parseWorker.Parse(ctx, path, nil, filter)
+	} else {
+		data, err = vault.ParseReplayContext(ctx, path, nil, filter)
+	}
+	stats.Parse = time.Since(start)
+	if err != nil || s.resolver == nil {
+		return data, stats, err
+	}
+
+	start = time.Now()
+	vault.EnrichReplay(data, s.resolver)
+	stats.Enrich = time.Since(start)
+	return data, stats, nil
+}
+
+// filterConfig builds the filter configuration from the request's filter and where values
+func (s *WebServer) filterConfig(r *http.Request) (*commands.FilterConfig, error) {
+	// Optional filter preset name, defaulting to build commands
+	config := commands.NewFilterConfig()
+	if name := strings.TrimSpace(r.FormValue("filter")); name != "" {
+		preset, ok := s.presets.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown filter preset %q (available: %s)", name, strings.Join(s.presets.Names(), ", "))
+		}
+		if _, err := config.WithPreset(preset); err != nil {
+			return nil, fmt.Errorf("Filter preset %q has an invalid where expression: %v", name, err)
+		}
+	}
+
+	// Optional filter expression, e.g. where=type = use_ability and time < 5m
+	if where := strings.TrimSpace(r.FormValue("where")); where != "" {
+		if _, err := config.WithExpression(where); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// handleLibrary lists the replays in the local library. Query parameters
+// (q, player, faction, map, version, min_duration, max_duration, since, until)
+// narrow the list.
+func (s *WebServer) handleLibrary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := library.QueryFromValues(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries := []library.Entry{}
+	if s.library != nil {
+		list, err := s.library.Search(query)
+		if err != nil {
+			http.Error(w, "Failed to read replay library", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, list...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleLibraryReplay returns a stored replay in the same format as /api/parse
+func (s *WebServer) handleLibraryReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.library == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/library/")
+	_, replayData, err := s.library.Get(id)
+	if errors.Is(err, library.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read replay: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config, err := s.filterConfig(r)
+	if err != nil {
+		s.sendJSONError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.convertToWebResponse(config.Apply(replayData)))
+}
+
+func (s *WebServer) handlePresets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.presets.List())
 }
 
 func (s *WebServer) sendJSONError(w http.ResponseWriter, message string) {
+	s.writeJSONError(w, http.StatusBadRequest, message)
+}
+
+func (s *WebServer) writeJSONError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(ReplayResponse{
 		Success: false,
 		Error:   message,
@@ -853,10 +582,7 @@ func (s *WebServer) convertToWebResponse(replayData *vault.ReplayData) ReplayRes
 	}
 
 	// Player colors for visualization
-	colors := []string{
-		"#e74c3c", "#3498db", "#2ecc71", "#f39c12", 
-		"#9b59b6", "#1abc9c", "#e67e22", "#95a5a6",
-	}
+	colors := playerColors
 
 	// Create player summaries
 	playerSummaries := make([]PlayerSummary, 0, len(replayData.Players))
@@ -887,7 +613,7 @@ func (s *WebServer) convertToWebResponse(replayData *vault.ReplayData) ReplayRes
 		}
 
 		for _, cmd := range player.BuildCommands {
-			description := s.formatCommandDescription(cmd)
+			description := commands.Describe(cmd)
 			
 			timeline = append(timeline, TimelineEvent{
 				PlayerID:     int(player.PlayerID),
@@ -896,56 +622,22 @@ func (s *WebServer) convertToWebResponse(replayData *vault.ReplayData) ReplayRes
 				Timestamp:    cmd.Timestamp,
 				TimestampStr: formatTimestamp(cmd.Timestamp),
 				CommandType:  cmd.CommandType,
+				Category:     commandCategory(cmd.CommandType),
 				Description:  description,
 				Color:        color,
 			})
 		}
 	}
 
-	// Sort timeline by timestamp
-	for i := 0; i < len(timeline)-1; i++ {
-		for j := i + 1; j < len(timeline); j++ {
-			if timeline[i].Timestamp > timeline[j].Timestamp {
-				timeline[i], timeline[j] = timeline[j], timeline[i]
-			}
-		}
-	}
+	// Sort timeline by timestamp, keeping each player's commands in order
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].Timestamp < timeline[j].Timestamp
+	})
 
 	response.Timeline = timeline
 	return response
 }
 
-func (s *WebServer) formatCommandDescription(cmd vault.Command) string {
-	switch cmd.CommandType {
-	case "build_squad":
-		if cmd.UnitName != nil {
-			return fmt.Sprintf("🪖 Built: %s", *cmd.UnitName)
-		}
-		return "🪖 Built unit"
-		
-	case "construct_entity":
-		if cmd.BuildingName != nil {
-			return fmt.Sprintf("🏗️ Constructed: %s", *cmd.BuildingName)
-		}
-		return "🏗️ Constructed building"
-		
-	case "build_global_upgrade":
-		if cmd.UnitName != nil {
-			return fmt.Sprintf("🔬 Researched: %s", *cmd.UnitName)
-		}
-		return "🔬 Researched upgrade"
-		
-	case "select_battlegroup":
-		if cmd.UnitName != nil {
-			return fmt.Sprintf("⚔️ Selected: %s", *cmd.UnitName)
-		}
-		return "⚔️ Selected battlegroup"
-		
-	default:
-		return fmt.Sprintf("📋 %s", cmd.CommandType)
-	}
-}
-
 func formatTimestamp(ms uint32) string {
 	seconds := ms / 1000
 	minutes := seconds / 60
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func TestConvertToWebResponseSortsTimeline(t *testing.T) {
+	data := &vault.ReplayData{Players: []vault.Player{
+		{PlayerID: 1, PlayerName: "first", BuildCommands: []vault.Command{
+			{Timestamp: 3000, CommandType: "build_squad", Details: "a"},
+			{Timestamp: 5000, CommandType: "build_squad", Details: "b"},
+			{Timestamp: 5000, CommandType: "build_squad", Details: "c"},
+		}},
+		{PlayerID: 2, PlayerName: "second", BuildCommands: []vault.Command{
+			{Timestamp: 1000, CommandType: "build_squad", Details: "d"},
+			{Timestamp: 5000, CommandType: "build_squad", Details: "e"},
+		}},
+	}}
+
+	timeline := (&WebServer{}).convertToWebResponse(data).Timeline
+	// Commands at the same time stay in player and command order
+	want := []struct {
+		player    int
+		timestamp uint32
+	}{{2, 1000}, {1, 3000}, {1, 5000}, {1, 5000}, {2, 5000}}
+	if len(timeline) != len(want) {
+		t.Fatalf("expected %d timeline events, got %d", len(want), len(timeline))
+	}
+	for i, w := range want {
+		if timeline[i].PlayerID != w.player || timeline[i].Timestamp != w.timestamp {
+			t.Errorf("event %d = player %d at %d, want player %d at %d",
+				i, timeline[i].PlayerID, timeline[i].Timestamp, w.player, w.timestamp)
+		}
+	}
+}
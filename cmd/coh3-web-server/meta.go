@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/stats"
+)
+
+// handleMeta returns a meta report over the library replays selected by the
+// library query parameters. format=csv downloads the report as CSV; top and
+// opening_length tune the openings and units listed.
+func (s *WebServer) handleMeta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.library == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	values := r.URL.Query()
+	query, err := library.QueryFromValues(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := stats.MetaOptions{TopOpenings: 5, TopUnits: 5}
+	for name, target := range map[string]*int{"top": &opts.TopOpenings, "opening_length": &opts.OpeningLength} {
+		if v := values.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+name+" parameter", http.StatusBadRequest)
+				return
+			}
+			*target = n
+		}
+	}
+	opts.TopUnits = opts.TopOpenings
+
+	games, err := stats.LoadGames(s.library, query)
+	if err != nil {
+		http.Error(w, "Failed to read replay library", http.StatusInternalServerError)
+		return
+	}
+	report := stats.BuildMetaReport(games, opts)
+
+	if values.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="meta.csv"`)
+		stats.WriteMetaCSV(w, report)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
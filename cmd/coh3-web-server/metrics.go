@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/metrics"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Reasons a replay upload was not parsed, as reported by coh3_parse_failures_total
+const (
+	failureTooLarge      = "too_large"      // The upload exceeds the size limit
+	failureInvalidUpload = "invalid_upload" // Not a multipart upload of a .rec file
+	failureNotReplay     = "not_replay"     // The file does not start like a CoH3 replay
+	failureRateLimited   = "rate_limited"   // The client uploaded too often
+	failureBusy          = "busy"           // Every parse slot was taken
+	failureTimeout       = "timeout"        // Parsing took longer than the parse timeout
+	failureParser        = "parser"         // The parser rejected the replay
+)
+
+// uploadSizeBuckets are upload size histogram buckets in bytes
+var uploadSizeBuckets = []float64{64 << 10, 256 << 10, 1 << 20, 2 << 20, 4 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// serverMetrics are the metrics served at /metrics. A nil *serverMetrics
+// records nothing, so servers built in tests need none.
+type serverMetrics struct {
+	registry      *metrics.Registry
+	parses        *metrics.Counter
+	failures      *metrics.Counter
+	parseDuration *metrics.Histogram
+	uploadSize    *metrics.Histogram
+	cache         *metrics.Counter
+	inFlight      *metrics.Gauge
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:      r,
+		parses:        r.NewCounter("coh3_parses_total", "Replays parsed or served from the parse cache, by result (success, failure or cancelled).", "result"),
+		failures:      r.NewCounter("coh3_parse_failures_total", "Uploads that could not be parsed, by reason.", "reason"),
+		parseDuration: r.NewHistogram("coh3_parse_duration_seconds", "Time spent parsing replays, by stage: ffi for the Rust parser, enrich for resolving names.", metrics.DefaultBuckets, "stage"),
+		uploadSize:    r.NewHistogram("coh3_upload_size_bytes", "Size of uploaded replays.", uploadSizeBuckets),
+		cache:         r.NewCounter("coh3_parse_cache_requests_total", "Parse cache lookups, by result (hit or miss).", "result"),
+		inFlight:      r.NewGauge("coh3_parses_in_flight", "Replays being parsed."),
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	m.registry.ServeHTTP(w, r)
+}
+
+// observeUpload records the size of an uploaded replay
+func (m *serverMetrics) observeUpload(size int64) {
+	if m != nil {
+		m.uploadSize.Observe(float64(size))
+	}
+}
+
+// rejectUpload records an upload that was not parsed
+func (m *serverMetrics) rejectUpload(reason string) {
+	if m != nil {
+		m.failures.Inc(reason)
+	}
+}
+
+// parseStarted records a parse in flight until the returned function is called
+func (m *serverMetrics) parseStarted() (done func()) {
+	if m == nil {
+		return func() {}
+	}
+	m.inFlight.Add(1)
+	return func() { m.inFlight.Add(-1) }
+}
+
+// observeParse records the outcome and timing of a parse
+func (m *serverMetrics) observeParse(stats vault.ParseStats, cached bool, err error) {
+	if m == nil {
+		return
+	}
+	if cached {
+		if stats.Hit {
+			m.cache.Inc("hit")
+		} else {
+			m.cache.Inc("miss")
+		}
+	}
+	if !stats.Hit {
+		m.parseDuration.Observe(stats.Parse.Seconds(), "ffi")
+		if stats.Enrich > 0 {
+			m.parseDuration.Observe(stats.Enrich.Seconds(), "enrich")
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		m.parses.Inc("cancelled")
+		return
+	case err != nil:
+		m.parses.Inc("failure")
+		m.failures.Inc(failureParser)
+		return
+	}
+	m.parses.Inc("success")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func TestMetrics(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.metrics = newServerMetrics()
+	cache, err := vault.OpenParseCache(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cache = cache
+	mux := s.routes()
+
+	upload := func(name, content string) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("replay", name)
+		part.Write([]byte(content))
+		form.Close()
+		req := httptest.NewRequest("POST", "/api/parse", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	upload("game.rec", "\x13\x00COH3_REC corrupt")
+	upload("notes.txt", "not a replay either")
+	upload("fake.rec", "not a replay")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rec.Code)
+	}
+	for _, line := range []string{
+		`coh3_parses_total{result="failure"} 1`,
+		`coh3_parse_failures_total{reason="invalid_upload"} 1`,
+		`coh3_parse_failures_total{reason="not_replay"} 1`,
+		`coh3_parse_failures_total{reason="parser"} 1`,
+		`coh3_parse_duration_seconds_count{stage="ffi"} 1`,
+		`coh3_upload_size_bytes_bucket{le="65536"} 3`,
+		`coh3_upload_size_bytes_sum 49`,
+		`coh3_parse_cache_requests_total{result="miss"} 1`,
+		`coh3_parses_in_flight 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("Metrics do not contain %q:\n%s", line, rec.Body.String())
+		}
+	}
+
+	// Servers without metrics do not serve them
+	rec = httptest.NewRecorder()
+	(&WebServer{}).routes().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /metrics without metrics = %d, want 404", rec.Code)
+	}
+}
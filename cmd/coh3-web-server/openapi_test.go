@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/api"
+)
+
+// openAPISpec is the subset of an OpenAPI 3 document the tests inspect
+type openAPISpec struct {
+	OpenAPI string                                 `json:"openapi"`
+	Paths   map[string]map[string]openAPIOperation `json:"paths"`
+	Schemas map[string]interface{}
+}
+
+type openAPIOperation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema map[string]interface{} `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+func loadOpenAPISpec(t *testing.T) *openAPISpec {
+	t.Helper()
+	var spec openAPISpec
+	if err := json.Unmarshal(api.OpenAPI, &spec); err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+	var components struct {
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	json.Unmarshal(api.OpenAPI, &components)
+	spec.Schemas = components.Components.Schemas
+	return &spec
+}
+
+// validate checks a decoded JSON value against a schema. Objects are checked
+// strictly: properties missing from the schema are reported, so every field a
+// handler returns must be documented.
+func (spec *openAPISpec) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved, ok := spec.Schemas[name].(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", at, ref)}
+		}
+		return spec.validate(resolved, value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", at, value)}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %s", at, name))
+			}
+		}
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for name, v := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, spec.validate(property, v, at+"."+name)...)
+			} else if additional != nil {
+				problems = append(problems, spec.validate(additional, v, at+"."+name)...)
+			} else if properties != nil || schema["additionalProperties"] == false {
+				problems = append(problems, fmt.Sprintf("%s: undocumented property %s", at, name))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", at, value)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			problems = append(problems, spec.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected string, got %T", at, value)}
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok {
+			found := false
+			for _, allowed := range enum {
+				found = found || allowed == s
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s: %q is not one of %v", at, s, enum))
+			}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			problems = append(problems, fmt.Sprintf("%s: expected integer, got %v", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected number, got %T", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected boolean, got %T", at, value))
+		}
+	}
+	return problems
+}
+
+func TestOpenAPIDocumentsRoutes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got %q", spec.OpenAPI)
+	}
+
+	// Every documented path is routed to its own handler rather than the home page
+	mux := (&WebServer{}).routes()
+	for path := range spec.Paths {
+		req := httptest.NewRequest("GET", strings.ReplaceAll(path, "{id}", "m-1"), nil)
+		if _, pattern := mux.Handler(req); pattern == "/" {
+			t.Errorf("Documented path %s has no handler", path)
+		}
+	}
+
+	// The schemas clients share are documented under their names
+	for _, name := range []string{"ReplayData", "Command", "TimelineEvent", "Error"} {
+		if _, ok := spec.Schemas[name]; !ok {
+			t.Errorf("Schema %s is not documented", name)
+		}
+	}
+	if ref := spec.Paths["/api/v1/replays/{id}"]["get"].Responses["200"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/ReplayData" {
+		t.Errorf("GET /api/v1/replays/{id} returns %v, want the ReplayData schema", ref)
+	}
+
+	// Every $ref resolves
+	var refs []string
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				refs = append(refs, ref)
+			}
+			for _, child := range v {
+				collect(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				collect(child)
+			}
+		}
+	}
+	var document interface{}
+	json.Unmarshal(api.OpenAPI, &document)
+	collect(document)
+	for _, ref := range refs {
+		if _, ok := spec.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			t.Errorf("Unresolved reference %s", ref)
+		}
+	}
+}
+
+func TestHandlersMatchOpenAPI(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	s, upload := newShareServer(t)
+	entries, _ := s.library.List()
+	id := entries[0].ID
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	tests := []struct {
+		method, path, url string
+		status            int
+	}{
+		{"GET", "/api/v1/replays", "/api/v1/replays?player=tomsch", 200},
+		{"GET", "/api/v1/replays", "/api/v1/replays?since=yesterday", 400},
+		{"GET", "/api/v1/replays/{id}", "/api/v1/replays/" + id, 200},
+		{"GET", "/api/v1/replays/{id}", "/api/v1/replays/m-404", 404},
+		{"GET", "/api/v1/replays/{id}/players", "/api/v1/replays/" + id + "/players", 200},
+		{"GET", "/api/v1/replays/{id}/commands", "/api/v1/replays/" + id + "/commands?type=build_squad&to=5m", 200},
+		{"GET", "/api/v1/replays/{id}/commands", "/api/v1/replays/" + id + "/commands?type=bogus", 400},
+		{"GET", "/api/v1/replays/{id}/analysis", "/api/v1/replays/" + id + "/analysis", 200},
+		{"GET", "/api/v1/replays/{id}/timeline.svg", "/api/v1/replays/" + id + "/timeline.svg?player=0,1&from=1m", 200},
+		{"GET", "/api/v1/replays/{id}/timeline.png", "/api/v1/replays/" + id + "/timeline.png?player=Nobody", 400},
+		{"POST", "/api/v1/replays", "/api/v1/replays", 400},
+		{"POST", "/api/parse", "/api/parse", 400},
+		{"GET", "/api/presets", "/api/presets", 200},
+		{"GET", "/api/library", "/api/library?faction=americans", 200},
+		{"GET", "/api/library/{id}", "/api/library/" + id, 200},
+		{"GET", "/api/shared/{id}", "/api/shared/" + upload.ID, 200},
+		{"GET", "/api/compare", "/api/compare?side=" + upload.ID + ":0&side=" + id + ":Surgie", 200},
+		{"GET", "/api/compare", "/api/compare?side=" + id + ":0", 400},
+		{"GET", "/r/{id}", "/r/" + upload.ID, 200},
+		{"GET", "/r/{id}/download", "/r/" + upload.ID + "/download", 200},
+		{"GET", "/r/{id}/timeline.png", "/r/" + upload.ID + "/timeline.png?filter=all", 200},
+		{"GET", "/r/{id}/timeline.svg", "/r/" + upload.ID + "/timeline.svg?to=0:00", 400},
+		{"GET", "/api/profile", "/api/profile?player=Tomsch", 200},
+		{"GET", "/api/meta", "/api/meta", 200},
+		{"GET", "/api/openapi.json", "/api/openapi.json", 200},
+		{"GET", "/healthz", "/healthz", 200},
+		{"GET", "/readyz", "/readyz", 503},
+	}
+	for _, tt := range tests {
+		var body io.Reader
+		contentType := ""
+		if tt.method == "POST" {
+			var form bytes.Buffer
+			writer := multipart.NewWriter(&form)
+			writer.WriteField("note", "no replay attached")
+			writer.Close()
+			body, contentType = &form, writer.FormDataContentType()
+		}
+		req, _ := http.NewRequest(tt.method, server.URL+tt.url, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		name := tt.method + " " + tt.url
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s = %d, want %d: %s", name, resp.StatusCode, tt.status, content)
+			continue
+		}
+		response, ok := spec.Paths[tt.path][strings.ToLower(tt.method)].Responses[fmt.Sprint(tt.status)]
+		if !ok {
+			t.Errorf("%s: status %d is not documented", name, tt.status)
+			continue
+		}
+		media, ok := response.Content["application/json"]
+		if !ok {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(content, &value); err != nil {
+			t.Errorf("%s: invalid JSON: %v", name, err)
+			continue
+		}
+		problems := spec.validate(media.Schema, value, "response")
+		sort.Strings(problems)
+		for _, problem := range problems {
+			t.Errorf("%s: %s", name, problem)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	s, id := newTestServer(t)
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	client := api.NewClient(server.URL+"/", nil)
+	ctx := context.Background()
+
+	replays, err := client.ListReplays(ctx, api.ReplayQuery{Faction: "Wehrmacht", TeamSize: 1, Since: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil || len(replays) != 1 || replays[0].ID != id {
+		t.Fatalf("ListReplays = %+v, %v", replays, err)
+	}
+
+	replay, err := client.GetReplay(ctx, id)
+	if err != nil || replay.Map != "rails_and_sand_4p" {
+		t.Errorf("GetReplay = %+v, %v", replay, err)
+	}
+
+	players, err := client.ListPlayers(ctx, id)
+	if err != nil || len(players) != 2 || players[1].Name != "Surgie" {
+		t.Errorf("ListPlayers = %+v, %v", players, err)
+	}
+
+	list, err := client.ListCommands(ctx, id, api.CommandQuery{Types: []string{"build_squad", "select_battlegroup"}, Player: "Tomsch", From: time.Minute})
+	if err != nil || list.Total != 1 || list.Commands[0].Name != "Mechanized" {
+		t.Errorf("ListCommands = %+v, %v", list, err)
+	}
+
+	analysis, err := client.GetAnalysis(ctx, id)
+	if err != nil || len(analysis.Players) != 2 || analysis.Players[0].Result != api.ResultWin {
+		t.Errorf("GetAnalysis = %+v, %v", analysis, err)
+	}
+
+	_, err = client.GetReplay(ctx, "m-404")
+	var statusErr *api.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Message != "replay not found" {
+		t.Errorf("GetReplay of a missing replay = %v, want a 404 StatusError", err)
+	}
+
+	_, _, err = client.UploadReplay(ctx, "notes.txt", strings.NewReader("not a replay"))
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("UploadReplay of a non-.rec file = %v, want a 400 StatusError", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/stats"
+)
+
+// handleProfile returns the profile of the player given by the player query
+// parameter, aggregated over the library replays matching the other parameters
+func (s *WebServer) handleProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.library == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	values := r.URL.Query()
+	ref := values.Get("player")
+	if ref == "" {
+		http.Error(w, "Missing player parameter", http.StatusBadRequest)
+		return
+	}
+	// The player selects the profile, not the games: a renamed player is matched by profile ID
+	values.Del("player")
+	query, err := library.QueryFromValues(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	games, err := stats.LoadGames(s.library, query)
+	if err != nil {
+		http.Error(w, "Failed to read replay library", http.StatusInternalServerError)
+		return
+	}
+	profile, err := stats.BuildProfile(games, ref, s.milestoneExtractor())
+	if errors.Is(err, stats.ErrPlayerNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (s *WebServer) handleProfilePage(w http.ResponseWriter, r *http.Request) {
+	s.web().render(w, r, "profile.html", nil)
+}
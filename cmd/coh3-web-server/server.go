@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Timeouts of the HTTP server. Reads allow for slow uploads and writes for
+// parsing a replay before the response starts.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = time.Minute
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+	shutdownTimeout   = 30 * time.Second
+)
+
+// defaultMaxUpload is the largest replay upload accepted unless configured otherwise
+const defaultMaxUpload = 32 << 20
+
+// newHTTPServer returns a server for handler with read, write and idle timeouts
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// serve runs server until ctx is done, then stops accepting connections and
+// waits for requests in flight to finish. TLS is used when certFile and
+// keyFile are given.
+func serve(ctx context.Context, server *http.Server, certFile, keyFile string) error {
+	errs := make(chan error, 1)
+	go func() {
+		if certFile != "" {
+			errs <- server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for requests to finish", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleHealthz reports that the server is running
+func (s *WebServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports whether the server can fully serve requests, which
+// requires the game data used to resolve names and milestones
+func (s *WebServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if s.resolver == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "game data not loaded from %s\n", s.dataDir)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// uploadMemory is how much of an upload is held in memory; the rest is
+// buffered in a temporary file
+const uploadMemory = 1 << 20
+
+// readUpload applies the upload rate limit and parses a multipart upload no
+// larger than the upload limit. It returns the HTTP status and message to
+// respond with if that fails.
+func (s *WebServer) readUpload(w http.ResponseWriter, r *http.Request) (int, error) {
+	if status, err := s.limitUpload(w, r); err != nil {
+		return status, err
+	}
+
+	limit := s.maxUpload
+	if limit <= 0 {
+		limit = defaultMaxUpload
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.metrics.rejectUpload(failureTooLarge)
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("upload exceeds the limit of %d MB", limit>>20)
+		}
+		s.metrics.rejectUpload(failureInvalidUpload)
+		return http.StatusBadRequest, fmt.Errorf("failed to parse upload: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// envString returns the value of the environment variable name, or fallback if it is unset
+func envString(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+// envDuration returns the duration value of the environment variable name, such
+// as 30s, or fallback if it is unset or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: not a duration", name, value)
+		return fallback
+	}
+	return d
+}
+
+// envInt64 returns the integer value of the environment variable name, or
+// fallback if it is unset or invalid
+func envInt64(name string, fallback int64) int64 {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: not an integer", name, value)
+		return fallback
+	}
+	return n
+}
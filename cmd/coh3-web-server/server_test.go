@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	s := &WebServer{dataDir: "missing-data"}
+	mux := s.routes()
+
+	for _, tt := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/healthz", http.StatusOK, "ok\n"},
+		{"/readyz", http.StatusServiceUnavailable, "game data not loaded from missing-data\n"},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	s.resolver = &lookup.DataResolver{}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /readyz with game data = %d, want 200", rec.Code)
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.maxUpload = 1 << 20
+
+	for _, path := range []string{"/api/parse", "/api/v1/replays"} {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("replay", "big.rec")
+		part.Write(bytes.Repeat([]byte{0}, 2<<20))
+		form.Close()
+
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "limit of 1 MB") {
+			t.Errorf("POST %s over the limit = %d %s, want 413", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, newHTTPServer("127.0.0.1:0", http.NotFoundHandler()), "", "")
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve = %v, want nil after shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the context was cancelled")
+	}
+}
+
+func TestWatchReplaysStopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		(&WebServer{}).watchReplays(ctx, t.TempDir())
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchReplays did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/share"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// permalink returns the page a shared upload is reachable at
+func permalink(id string) string {
+	return "/r/" + id
+}
+
+// keepUpload stores an uploaded replay for sharing. It returns nil when uploads
+// are not kept or the replay could not be stored; the upload itself still succeeds.
+func (s *WebServer) keepUpload(path, name string, data *vault.ReplayData) *share.Upload {
+	if s.shares == nil {
+		return nil
+	}
+	upload, err := s.shares.Save(path, name, data)
+	if err != nil {
+		log.Printf("Failed to keep %s for sharing: %v", name, err)
+		return nil
+	}
+	return &upload
+}
+
+// pruneShares periodically removes expired shared uploads
+func (s *WebServer) pruneShares(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.shares.Prune(); err != nil {
+			log.Printf("Failed to prune shared replays: %v", err)
+		}
+	}
+}
+
+// handleSharedReplay serves the permalinks of shared uploads: /r/{id} opens the
+// replay in the web interface with its timeline already loaded, and
+// /r/{id}/download returns the original replay file and /r/{id}/timeline.svg and
+// /r/{id}/timeline.png render its timeline as an image. The page accepts the same
+// filter and where parameters as /api/parse, and t (e.g. 7:00) to jump to a
+// point in the game.
+func (s *WebServer) handleSharedReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.shares == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/r/"), "/")
+	switch action {
+	case "":
+		upload, replayData, ok := s.getShared(w, r, id)
+		if !ok {
+			return
+		}
+		config, err := s.filterConfig(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response := s.sharedResponse(upload, config.Apply(replayData))
+		s.writeHomePage(w, r, &response)
+
+	case "download":
+		file, upload, err := s.shares.OpenReplay(id)
+		if errors.Is(err, share.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read replay: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": upload.Name}))
+		http.ServeContent(w, r, upload.Name, upload.UploadedAt, file)
+
+	case "timeline.svg", "timeline.png":
+		_, replayData, ok := s.getShared(w, r, id)
+		if !ok {
+			return
+		}
+		image, err := s.renderTimeline(r, action, replayData)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeTimelineImage(w, action, image)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleSharedReplayData returns a shared upload in the same format as /api/parse
+func (s *WebServer) handleSharedReplayData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.shares == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	upload, replayData, ok := s.getShared(w, r, strings.TrimPrefix(r.URL.Path, "/api/shared/"))
+	if !ok {
+		return
+	}
+	config, err := s.filterConfig(r)
+	if err != nil {
+		s.sendJSONError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.sharedResponse(upload, config.Apply(replayData)))
+}
+
+// getShared loads a shared upload, writing an error response if that fails
+func (s *WebServer) getShared(w http.ResponseWriter, r *http.Request, id string) (share.Upload, *vault.ReplayData, bool) {
+	upload, replayData, err := s.shares.Get(id)
+	if errors.Is(err, share.ErrNotFound) {
+		http.NotFound(w, r)
+		return share.Upload{}, nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to read replay: "+err.Error(), http.StatusInternalServerError)
+		return share.Upload{}, nil, false
+	}
+	return upload, replayData, true
+}
+
+// sharedResponse converts a shared upload to the web response format
+func (s *WebServer) sharedResponse(upload share.Upload, replayData *vault.ReplayData) ReplayResponse {
+	response := s.convertToWebResponse(replayData)
+	response.ID = upload.ID
+	response.Permalink = permalink(upload.ID)
+	return response
+}
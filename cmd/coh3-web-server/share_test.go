@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/pkg/share"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// newShareServer returns a server keeping uploads, with one shared replay
+func newShareServer(t *testing.T) (*WebServer, share.Upload) {
+	t.Helper()
+	s, id := newTestServer(t)
+	_, replay, err := s.library.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.presets = commands.NewPresetCatalog(commands.BuiltinPresets()...)
+	s.shares, err = share.Open(t.TempDir(), share.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "replay_123.rec")
+	if err := os.WriteFile(path, []byte("original replay"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := s.shares.Save(path, "Tomsch vs Surgie.rec", replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, upload
+}
+
+func TestSharedReplayPage(t *testing.T) {
+	s, upload := newShareServer(t)
+	mux := s.routes()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/r/"+upload.ID+"?t=7:00", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /r/%s = %d: %s", upload.ID, rec.Code, rec.Body.String())
+	}
+	page := rec.Body.String()
+	if strings.Contains(page, "/*shared-replay*/") {
+		t.Error("Shared replay was not embedded in the page")
+	}
+	if !strings.Contains(page, `"permalink":"/r/`+upload.ID+`"`) || !strings.Contains(page, "Grenadier Squad") {
+		t.Error("Page does not embed the shared replay's timeline")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/r/"+upload.ID+"/download", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "original replay" {
+		t.Errorf("Download = %d %q, want the original file", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="Tomsch vs Surgie.rec"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	for _, path := range []string{"/r/000000000000", "/r/" + upload.ID + "/nope", "/api/shared/000000000000"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestSharedReplayData(t *testing.T) {
+	s, upload := newShareServer(t)
+
+	var response ReplayResponse
+	get(t, s.handleSharedReplayData, "/api/shared/"+upload.ID+"?filter=all", http.StatusOK, &response)
+	if response.ID != upload.ID || response.Permalink != "/r/"+upload.ID || len(response.Timeline) != 4 {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+
+	// Without a store, nothing is shared
+	s.shares = nil
+	rec := httptest.NewRecorder()
+	s.handleSharedReplayData(rec, httptest.NewRequest("GET", "/api/shared/"+upload.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET without a store = %d, want 404", rec.Code)
+	}
+	if s.keepUpload("replay.rec", "replay.rec", &vault.ReplayData{}) != nil {
+		t.Error("Expected no upload to be kept without a store")
+	}
+}
+
+func TestSharedPageEscapesReplay(t *testing.T) {
+	s := &WebServer{}
+	rec := httptest.NewRecorder()
+	s.writeHomePage(rec, httptest.NewRequest("GET", "/r/abc", nil), &ReplayResponse{
+		Success: true,
+		MapName: "</script><script>alert(1)</script>",
+		Players: []PlayerSummary{{Name: "<script>alert(2)</script>", Faction: `"><img src=x onerror=alert(3)>`}},
+	})
+	for _, injected := range []string{"</script><script>alert", "<script>alert(2)", "<img src=x"} {
+		if strings.Contains(rec.Body.String(), injected) {
+			t.Errorf("Replay data injects %q into the page", injected)
+		}
+	}
+
+	var embedded ReplayResponse
+	page := rec.Body.String()
+	start := strings.Index(page, "const sharedReplay = ") + len("const sharedReplay = ")
+	end := strings.Index(page[start:], ";\n")
+	if err := json.Unmarshal([]byte(page[start:start+end]), &embedded); err != nil || embedded.MapName != "</script><script>alert(1)</script>" ||
+		embedded.Players[0].Name != "<script>alert(2)</script>" {
+		t.Errorf("Embedded replay = %+v, %v", embedded, err)
+	}
+}
@@ -0,0 +1,606 @@
+const uploadArea = document.getElementById('upload-area');
+const fileInput = document.getElementById('file-input');
+const loading = document.getElementById('loading');
+const results = document.getElementById('results');
+const pageParams = new URLSearchParams(window.location.search);
+document.getElementById('where-input').value = pageParams.get('where') || '';
+
+// Drag and drop functionality
+uploadArea.addEventListener('dragover', (e) => {
+    e.preventDefault();
+    uploadArea.classList.add('dragover');
+});
+
+uploadArea.addEventListener('dragleave', () => {
+    uploadArea.classList.remove('dragover');
+});
+
+uploadArea.addEventListener('drop', (e) => {
+    e.preventDefault();
+    uploadArea.classList.remove('dragover');
+    const files = e.dataTransfer.files;
+    if (files.length > 0) {
+        handleFile(files[0]);
+    }
+});
+
+fileInput.addEventListener('change', (e) => {
+    if (e.target.files.length > 0) {
+        handleFile(e.target.files[0]);
+    }
+});
+
+// Re-apply the filter expression to the last opened replay on Enter
+let lastFile = null;
+let lastLibraryId = null;
+let lastSharedId = null;
+let lastComparison = false;
+function reloadReplay() {
+    if (lastFile) {
+        handleFile(lastFile);
+    } else if (lastLibraryId) {
+        openLibraryReplay(lastLibraryId);
+    } else if (lastSharedId) {
+        openSharedReplay(lastSharedId);
+    } else if (lastComparison) {
+        compareSelected();
+    }
+}
+document.getElementById('where-input').addEventListener('keydown', (e) => {
+    if (e.key === 'Enter') {
+        reloadReplay();
+    }
+});
+
+// Populate the preset dropdown with built-in and user presets
+const presetSelect = document.getElementById('preset-select');
+fetch('/api/presets')
+    .then(response => response.json())
+    .then(presets => {
+        presetSelect.innerHTML = presets.map(preset =>
+            '<option value="' + escapeHTML(preset.name) + '"' + (preset.name === (pageParams.get('filter') || 'build') ? ' selected' : '') +
+            ' title="' + escapeHTML(preset.description) + '">' + escapeHTML(preset.name) + '</option>'
+        ).join('');
+    });
+presetSelect.addEventListener('change', reloadReplay);
+
+// Show replays from the local library; new replays appear as the server imports them
+const librarySearch = document.getElementById('library-search');
+function loadLibrary() {
+    const search = librarySearch.value.trim();
+    fetch('/api/library' + (search ? '?q=' + encodeURIComponent(search) : ''))
+        .then(response => response.json())
+        .then(entries => {
+            if (entries.length || search) {
+                document.getElementById('library-panel').style.display = 'block';
+            }
+            document.getElementById('library-list').innerHTML = entries.map(entry => {
+                const players = (entry.players || []).map(p =>
+                    '<a href="/profile?player=' + encodeURIComponent(p.profile_id || p.player_name) +
+                    '" onclick="event.stopPropagation()">' + escapeHTML(p.player_name) + '</a>' +
+                    (p.faction ? ' (' + escapeHTML(p.faction) + ')' : '')).join(', ');
+                const mapName = escapeHTML(entry.map_name.split('\\').pop());
+                return '<div class="library-item" onclick="openLibraryReplay(\'' + entry.id + '\')">' +
+                    '<span><strong>' + mapName + '</strong> — ' + players + '</span>' +
+                    '<span class="library-meta">' + formatSeconds(entry.duration_seconds) + ' · ' +
+                    new Date(entry.played_at || entry.added_at).toLocaleString() +
+                    ' <button class="compare-add" title="Add to comparison" onclick="event.stopPropagation(); ' +
+                    'addToComparison(\'' + entry.id + '\')">⚖️</button></span>' +
+                    '</div>';
+            }).join('');
+        })
+        .catch(() => {});
+}
+loadLibrary();
+setInterval(loadLibrary, 10000);
+librarySearch.addEventListener('input', loadLibrary);
+
+function openLibraryReplay(id) {
+    lastFile = null;
+    lastLibraryId = id;
+    lastSharedId = null;
+    lastComparison = false;
+
+    const params = new URLSearchParams({ filter: presetSelect.value });
+    const where = document.getElementById('where-input').value.trim();
+    if (where) {
+        params.append('where', where);
+    }
+    loadReplay(fetch('/api/library/' + encodeURIComponent(id) + '?' + params.toString()));
+}
+
+function openSharedReplay(id) {
+    lastFile = null;
+    lastLibraryId = null;
+    lastSharedId = id;
+    lastComparison = false;
+    loadReplay(fetch('/api/shared/' + encodeURIComponent(id) + '?' + filterParams().toString()));
+}
+
+// filterParams returns the selected preset and expression as query parameters
+function filterParams() {
+    const params = new URLSearchParams({ filter: presetSelect.value || pageParams.get('filter') || 'build' });
+    const where = document.getElementById('where-input').value.trim();
+    if (where) {
+        params.append('where', where);
+    }
+    return params;
+}
+
+// shareURL links to the current replay with its filter, optionally at a time in ms
+function shareURL(timestamp) {
+    const params = filterParams();
+    if (timestamp !== undefined) {
+        params.append('t', formatSeconds(Math.floor(timestamp / 1000)));
+    }
+    return currentData.permalink + '?' + params.toString();
+}
+
+// parseTime reads a time such as 7:00, 7m or 420 (seconds) into ms
+function parseTime(text) {
+    const parts = text.split(':');
+    if (parts.length === 2) {
+        return (parseInt(parts[0], 10) * 60 + parseInt(parts[1], 10)) * 1000;
+    }
+    return parseFloat(text) * (text.endsWith('m') ? 60000 : 1000);
+}
+
+// linkToTime points the address bar at a time in the current replay so it can be shared
+function linkToTime(timestamp) {
+    if (currentData && currentData.permalink) {
+        history.replaceState(null, '', shareURL(timestamp));
+    }
+    highlightTime(timestamp);
+}
+
+// highlightTime scrolls to a time and highlights the commands in the following 30 seconds
+function highlightTime(timestamp) {
+    if (isNaN(timestamp)) {
+        return;
+    }
+    const start = Math.floor(timestamp / 30000) * 30000;
+    let marker = null;
+    document.querySelectorAll('[data-timestamp]').forEach(element => {
+        const time = Number(element.dataset.timestamp);
+        const isMarker = element.classList.contains('time-marker');
+        const highlight = isMarker ? time === start : time >= timestamp && time < timestamp + 30000;
+        element.classList.toggle('highlight', highlight);
+        if (highlight && isMarker) {
+            marker = element;
+        }
+    });
+    if (marker) {
+        marker.scrollIntoView({ block: 'center' });
+    }
+}
+
+// Players chosen for comparison, the reference first: { id, map, players, player }
+let comparison = [];
+
+// addToComparison adds a shared or library replay to the comparison
+function addToComparison(id) {
+    if (comparison.some(side => side.id === id)) {
+        return;
+    }
+    const query = '?' + filterParams().toString();
+    fetch('/api/shared/' + encodeURIComponent(id) + query)
+        .then(response => response.ok ? response : fetch('/api/library/' + encodeURIComponent(id) + query))
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                displayError(data.error);
+                return;
+            }
+            addComparisonSide(id, data);
+        })
+        .catch(error => displayError('Could not add replay: ' + error.message));
+}
+
+// addComparisonSide defaults to the player already compared in other games, if any
+function addComparisonSide(id, data) {
+    const names = comparison.map(side => side.players.find(p => String(p.id) === String(side.player)).name.toLowerCase());
+    const known = data.players.find(p => names.includes(p.name.toLowerCase()));
+    comparison.push({ id: id, map: data.map_name, players: data.players, player: (known || data.players[0]).id });
+    renderComparison();
+}
+
+function renderComparison() {
+    document.getElementById('compare-list').innerHTML = comparison.map((side, i) =>
+        '<div class="library-item">' +
+            '<span>' + (i === 0 ? '⭐ ' : '') + '<strong>' + escapeHTML(side.map.split('\\').pop()) + '</strong> ' +
+            '<select onchange="comparison[' + i + '].player = this.value">' +
+            side.players.map(p => '<option value="' + p.id + '"' + (String(p.id) === String(side.player) ? ' selected' : '') + '>' +
+                escapeHTML(p.name) + ' (' + escapeHTML(p.faction) + ')</option>').join('') +
+            '</select></span>' +
+            '<span class="library-meta">' +
+                (i > 0 ? '<button class="compare-add" title="Make reference" onclick="makeReference(' + i + ')">⭐</button>' : '') +
+                '<button class="compare-add" title="Remove" onclick="comparison.splice(' + i + ', 1); renderComparison()">✖</button>' +
+            '</span>' +
+        '</div>'
+    ).join('');
+}
+
+function makeReference(i) {
+    comparison.unshift(comparison.splice(i, 1)[0]);
+    renderComparison();
+}
+
+function clearComparison() {
+    comparison = [];
+    renderComparison();
+}
+
+// Uploaded replays are compared by the ID they are kept under
+document.getElementById('compare-input').addEventListener('change', (e) => {
+    const uploads = Array.from(e.target.files).map(file => {
+        const formData = new FormData();
+        formData.append('replay', file);
+        formData.append('filter', presetSelect.value);
+        return fetch('/api/parse', { method: 'POST', body: formData }).then(response => response.json());
+    });
+    e.target.value = '';
+    Promise.all(uploads)
+        .then(responses => responses.forEach(data => {
+            if (!data.success) {
+                displayError(data.error);
+            } else if (!data.id) {
+                displayError('Comparing uploads needs permalinks, which this server has disabled');
+            } else if (!comparison.some(side => side.id === data.id)) {
+                addComparisonSide(data.id, data);
+            }
+        }))
+        .catch(error => displayError('Error uploading replays: ' + error.message));
+});
+
+function compareSelected() {
+    if (comparison.length < 2) {
+        alert('Add at least two replays to compare');
+        return;
+    }
+    lastFile = null;
+    lastLibraryId = null;
+    lastSharedId = null;
+    lastComparison = true;
+
+    const params = filterParams();
+    comparison.forEach(side => params.append('side', side.id + ':' + side.player));
+    loadReplay(fetch('/api/compare?' + params.toString()));
+}
+
+function formatSeconds(seconds) {
+    const minutes = Math.floor(seconds / 60);
+    return String(minutes).padStart(2, '0') + ':' + String(seconds % 60).padStart(2, '0');
+}
+
+// escapeHTML escapes text from replays and presets for use in HTML, including
+// attribute values
+function escapeHTML(text) {
+    return String(text)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+function handleFile(file) {
+    if (!file.name.endsWith('.rec')) {
+        alert('Please select a .rec replay file');
+        return;
+    }
+    lastFile = file;
+    lastLibraryId = null;
+    lastSharedId = null;
+    lastComparison = false;
+
+    const formData = new FormData();
+    formData.append('replay', file);
+    formData.append('filter', presetSelect.value);
+    const where = document.getElementById('where-input').value.trim();
+    if (where) {
+        formData.append('where', where);
+    }
+
+    loadReplay(fetch('/api/parse', {
+        method: 'POST',
+        body: formData
+    }));
+}
+
+function loadReplay(request) {
+    loading.style.display = 'block';
+    results.style.display = 'none';
+
+    request
+    .then(response => response.json())
+    .then(data => {
+        loading.style.display = 'none';
+        if (data.success) {
+            displayResults(data);
+        } else {
+            displayError(data.error);
+        }
+    })
+    .catch(error => {
+        loading.style.display = 'none';
+        displayError('Error parsing replay: ' + error.message);
+    });
+}
+
+let currentData = null;
+let maxTimestamp = 0;
+
+function displayResults(data) {
+    // A filter expression may leave no commands at all
+    data.timeline = data.timeline || [];
+    currentData = data;
+    maxTimestamp = Math.max(1, ...data.timeline.map(e => e.timestamp));
+
+    displayReplayInfo(data);
+    setupFilters(data);
+    displayTimeline(data.timeline);
+
+    results.style.display = 'block';
+
+    // Show the permalink of shared uploads in the address bar
+    if (data.permalink) {
+        lastSharedId = data.id;
+        history.replaceState(null, '', shareURL());
+    } else if (window.location.pathname !== '/') {
+        history.replaceState(null, '', '/');
+    }
+}
+
+function displayReplayInfo(data) {
+    const replayInfo = document.getElementById('replay-info');
+
+    // Basic info
+    const infoGrid =
+        '<div class="info-header">' +
+            '<div class="info-title">📋 ' + escapeHTML(data.map_name) + '</div>' +
+            (data.permalink ?
+                '<div class="share-links">' +
+                    '<a href="' + shareURL() + '">🔗 Permalink</a>' +
+                    '<a href="' + data.permalink + '/download">⬇️ Download replay</a>' +
+                    '<a href="' + data.permalink + '/timeline.svg?' + filterParams() + '">🖼️ SVG</a>' +
+                    '<a href="' + data.permalink + '/timeline.png?' + filterParams() + '">PNG</a>' +
+                    '<span class="share-hint">Click a time to link to it</span>' +
+                '</div>' : '') +
+            (comparableId() ?
+                '<div class="share-links"><a href="#" onclick="addToComparison(comparableId()); return false">⚖️ Add to comparison</a></div>' : '') +
+        '</div>' +
+        '<div class="info-grid">' +
+            '<div class="info-card">' +
+                '<div class="info-value">' + data.duration + '</div>' +
+                '<div class="info-label">Duration</div>' +
+            '</div>' +
+            '<div class="info-card">' +
+                '<div class="info-value">' + data.players.length + '</div>' +
+                '<div class="info-label">Players</div>' +
+            '</div>' +
+            '<div class="info-card">' +
+                '<div class="info-value">' + data.timeline.length + '</div>' +
+                '<div class="info-label">Commands</div>' +
+            '</div>' +
+        '</div>';
+
+    // Players summary
+    const playersSummary =
+        '<div class="players-summary">' +
+        data.players.map(player =>
+            '<div class="player-summary" style="border-left-color: ' + player.color + '">' +
+                '<div class="player-name" style="color: ' + player.color + '">' + escapeHTML(player.name) + '</div>' +
+                '<div class="player-faction">' + escapeHTML(player.faction) + '</div>' +
+                '<div class="player-stats">' + player.commands + ' commands</div>' +
+            '</div>'
+        ).join('') +
+        '</div>';
+
+    replayInfo.innerHTML = infoGrid + playersSummary;
+}
+
+// comparableId returns the stored replay shown, which can be added to a comparison
+function comparableId() {
+    return lastComparison ? null : currentData.id || lastLibraryId;
+}
+
+function setupFilters(data) {
+    // Offer the command types present, labelled with their timeline icon
+    const commandFilter = document.getElementById('command-filter');
+    const types = [];
+    data.timeline.forEach(event => {
+        if (!types.some(type => type.name === event.command_type)) {
+            types.push({ name: event.command_type, icon: event.description.split(' ')[0] });
+        }
+    });
+    commandFilter.innerHTML = '<option value="all">All Commands</option>' +
+        types.map(type => '<option value="' + escapeHTML(type.name) + '">' + escapeHTML(type.icon) + ' ' +
+            escapeHTML(type.name.replace(/_/g, ' ')) + '</option>').join('');
+
+    // Populate player filter
+    const playerFilter = document.getElementById('player-filter');
+    const players = data.players;
+    playerFilter.innerHTML = '<option value="all">All Players</option>' +
+        players.map(player => '<option value="' + player.id + '">' + escapeHTML(player.name) + '</option>').join('');
+
+    // Set up time filter
+    const timeFilter = document.getElementById('time-filter');
+    const timeDisplay = document.getElementById('time-display');
+
+    timeFilter.addEventListener('input', function() {
+        const percentage = this.value;
+        const maxTime = maxTimestamp * (percentage / 100);
+        const minutes = Math.floor(maxTime / 60000);
+        const seconds = Math.floor((maxTime % 60000) / 1000);
+        timeDisplay.textContent = percentage == 100 ? 'All' :
+            String(minutes).padStart(2, '0') + ':' + String(seconds).padStart(2, '0');
+        applyFilters();
+    });
+
+    // Set up other filters
+    document.getElementById('command-filter').addEventListener('change', applyFilters);
+    document.getElementById('player-filter').addEventListener('change', applyFilters);
+}
+
+function applyFilters() {
+    const commandFilter = document.getElementById('command-filter').value;
+    const playerFilter = document.getElementById('player-filter').value;
+    const timePercentage = document.getElementById('time-filter').value;
+    const maxTime = maxTimestamp * (timePercentage / 100);
+
+    let filteredTimeline = currentData.timeline.filter(event => {
+        if (commandFilter !== 'all' && event.command_type !== commandFilter) return false;
+        if (playerFilter !== 'all' && event.player_id.toString() !== playerFilter) return false;
+        if (event.timestamp > maxTime) return false;
+        return true;
+    });
+
+    displayTimeline(filteredTimeline);
+
+    const visibleCommands = document.getElementById('visible-commands');
+    visibleCommands.textContent = 'Showing ' + filteredTimeline.length + ' of ' + currentData.timeline.length + ' commands';
+}
+
+function displayTimeline(timeline) {
+    const timelineGrid = document.querySelector('.timeline-grid');
+
+    // Calculate timeline parameters
+    const timelineHeight = 800; // Increased height for better spacing
+    const headerHeight = 60;
+    const contentHeight = timelineHeight - headerHeight;
+
+    // Group events by player
+    const playerEvents = {};
+    currentData.players.forEach(player => {
+        playerEvents[player.id] = timeline.filter(event => event.player_id === player.id);
+    });
+
+    // Create a unified timeline that handles both time markers and events
+    const unifiedTimeline = createUnifiedTimeline(playerEvents, contentHeight);
+
+    // Create time markers based on unified timeline
+    const timeMarkersHtml = createUnifiedTimeMarkers(unifiedTimeline, contentHeight);
+
+    // Create player columns HTML from unified timeline
+    const playerColumnsHtml = currentData.players.map(player => {
+        return createUnifiedPlayerColumn(player, unifiedTimeline, contentHeight);
+    }).join('');
+
+    timelineGrid.innerHTML = timeMarkersHtml + '<div class="timeline-columns">' + playerColumnsHtml + '</div>';
+}
+
+function createUnifiedTimeline(playerEvents, contentHeight) {
+    // Collect all events and time markers into a unified timeline
+    const allItems = [];
+
+    // Add time markers every 30 seconds
+    const maxMinutes = Math.ceil(maxTimestamp / 60000);
+    for (let seconds = 0; seconds <= maxMinutes * 60; seconds += 30) {
+        const minutes = Math.floor(seconds / 60);
+        const remainingSeconds = seconds % 60;
+        const timeStr = String(minutes).padStart(2, '0') + ':' + String(remainingSeconds).padStart(2, '0');
+        const timestamp = seconds * 1000;
+        const isMajor = remainingSeconds === 0;
+
+        allItems.push({
+            type: 'time_marker',
+            timestamp: timestamp,
+            timeStr: timeStr,
+            major: isMajor
+        });
+    }
+
+    // Add all player events
+    Object.keys(playerEvents).forEach(playerId => {
+        playerEvents[playerId].forEach(event => {
+            allItems.push({
+                type: 'event',
+                timestamp: event.timestamp,
+                playerId: event.player_id,
+                event: event
+            });
+        });
+    });
+
+    // Sort all items by timestamp
+    allItems.sort((a, b) => a.timestamp - b.timestamp);
+
+    // Assign positions with overlap prevention
+    const itemHeight = 58;
+    const positionedItems = [];
+    let currentPosition = 0;
+
+    allItems.forEach(item => {
+        const idealPosition = (item.timestamp / maxTimestamp) * contentHeight;
+        let actualPosition = Math.max(idealPosition, currentPosition);
+
+        // For events, ensure minimum spacing
+        if (item.type === 'event') {
+            actualPosition = Math.max(actualPosition, currentPosition);
+            currentPosition = actualPosition + itemHeight;
+        }
+
+        positionedItems.push({
+            ...item,
+            position: actualPosition
+        });
+    });
+
+    return positionedItems;
+}
+
+function createUnifiedTimeMarkers(unifiedTimeline, contentHeight) {
+    const timeMarkers = unifiedTimeline.filter(item => item.type === 'time_marker');
+
+    const markersContent = timeMarkers.map(marker =>
+        '<div class="time-marker' + (marker.major ? ' major' : '') + '" style="top: ' + marker.position + 'px; cursor: pointer"' +
+            ' data-timestamp="' + marker.timestamp + '" onclick="linkToTime(' + marker.timestamp + ')">' +
+            marker.timeStr +
+        '</div>'
+    ).join('');
+
+    return '<div class="time-markers">' +
+        '<div class="time-markers-header">⏱️ Time</div>' +
+        '<div class="time-markers-content">' + markersContent + '</div>' +
+    '</div>';
+}
+
+function createUnifiedPlayerColumn(player, unifiedTimeline, contentHeight) {
+    const playerEvents = unifiedTimeline.filter(item =>
+        item.type === 'event' && item.playerId === player.id
+    );
+
+    const eventsHtml = playerEvents.map(item => {
+        const delta = item.event.diff === 'common' && item.event.delta ?
+            ' <span class="diff-delta">(' + (item.event.delta > 0 ? '+' : '-') +
+            formatSeconds(Math.round(Math.abs(item.event.delta) / 1000)) + ')</span>' : '';
+        return '<div class="timeline-item category-' + item.event.category + (item.event.diff === 'unique' ? ' diff-unique' : '') + '"' +
+            ' style="top: ' + item.position + 'px; border-left-color: ' + item.event.color + '"' +
+            ' data-timestamp="' + item.timestamp + '" onclick="linkToTime(' + item.timestamp + ')">' +
+            '<div class="timeline-time">' + item.event.timestamp_str + delta + '</div>' +
+            '<div class="timeline-command">' + escapeHTML(item.event.description) + '</div>' +
+        '</div>';
+    }).join('');
+
+    return '<div class="player-column" style="border-top-color: ' + player.color + '; height: 800px">' +
+        '<div class="player-column-header">' +
+            '<div class="player-column-name" style="color: ' + player.color + '">' + escapeHTML(player.name) + '</div>' +
+            '<div class="player-column-faction">' + escapeHTML(player.faction) + ' (' + playerEvents.length + ' commands)</div>' +
+            (player.game ? '<div class="player-column-faction">' + escapeHTML(player.game) + '</div>' : '') +
+        '</div>' +
+        '<div class="timeline-content">' + eventsHtml + '</div>' +
+    '</div>';
+}
+
+function displayError(message) {
+    results.innerHTML = '<div class="error">❌ ' + escapeHTML(message) + '</div>';
+    results.style.display = 'block';
+}
+
+// A permalink page embeds its replay, so the timeline shows without uploading
+if (sharedReplay) {
+    displayResults(sharedReplay);
+    if (pageParams.get('t')) {
+        highlightTime(parseTime(pageParams.get('t')));
+    }
+}
@@ -0,0 +1,103 @@
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+function formatMs(ms) {
+    const seconds = Math.floor(ms / 1000);
+    return String(Math.floor(seconds / 60)).padStart(2, '0') + ':' + String(seconds % 60).padStart(2, '0');
+}
+
+function winRate(record) {
+    const decided = record.wins + record.losses;
+    return decided ? Math.round(100 * record.wins / decided) + '%' : '-';
+}
+
+function recordTable(title, label, records) {
+    return '<div class="card"><h3>' + title + '</h3><table>' +
+        '<tr><th>' + label + '</th><th class="num">Games</th><th class="num">W</th><th class="num">L</th><th class="num">Win Rate</th></tr>' +
+        records.map(r => '<tr><td>' + escapeHTML(r.key) + '</td><td class="num">' + r.games + '</td><td class="num">' +
+            r.wins + '</td><td class="num">' + r.losses + '</td><td class="num">' + winRate(r) + '</td></tr>').join('') +
+        '</table></div>';
+}
+
+function countTable(title, label, counts) {
+    return '<div class="card"><h3>' + title + '</h3><table>' +
+        '<tr><th>' + label + '</th><th class="num">Count</th></tr>' +
+        (counts || []).map(c => '<tr><td>' + escapeHTML(c.name) + '</td><td class="num">' + c.count + '</td></tr>').join('') +
+        '</table></div>';
+}
+
+// Draw the monthly win rate as a line chart
+function trendChart(trend) {
+    const width = 1100, height = 220, pad = 35;
+    const points = trend.filter(p => p.record.wins + p.record.losses > 0);
+    if (points.length === 0) {
+        return '<p style="color:#888">No decided games yet</p>';
+    }
+    const x = i => pad + (points.length === 1 ? (width - 2 * pad) / 2 : i * (width - 2 * pad) / (points.length - 1));
+    const y = rate => height - pad - rate * (height - 2 * pad);
+    const rate = p => p.record.wins / (p.record.wins + p.record.losses);
+
+    let svg = '<svg viewBox="0 0 ' + width + ' ' + height + '" width="100%">';
+    [0, 0.5, 1].forEach(level => {
+        svg += '<line x1="' + pad + '" x2="' + (width - pad) + '" y1="' + y(level) + '" y2="' + y(level) + '" stroke="#eee" />' +
+            '<text x="0" y="' + (y(level) + 4) + '">' + (level * 100) + '%</text>';
+    });
+    svg += '<polyline fill="none" stroke="#667eea" stroke-width="3" points="' +
+        points.map((p, i) => x(i) + ',' + y(rate(p))).join(' ') + '" />';
+    points.forEach((p, i) => {
+        svg += '<circle cx="' + x(i) + '" cy="' + y(rate(p)) + '" r="5" fill="#764ba2">' +
+            '<title>' + p.period + ': ' + winRate(p.record) + ' of ' + p.record.games + ' games</title></circle>' +
+            '<text x="' + x(i) + '" y="' + (height - 10) + '" text-anchor="middle">' + p.period + '</text>';
+    });
+    return svg + '</svg>';
+}
+
+function trendTable(profile) {
+    const labels = profile.milestones.map(m => m.label);
+    return '<table><tr><th>Month</th><th class="num">Games</th><th class="num">Win Rate</th>' +
+        labels.map(l => '<th class="num">' + escapeHTML(l) + '</th>').join('') + '</tr>' +
+        profile.trend.map(p => '<tr><td>' + p.period + '</td><td class="num">' + p.record.games + '</td><td class="num">' +
+            winRate(p.record) + '</td>' +
+            profile.milestones.map(m => {
+                const average = (p.milestones || []).find(a => a.milestone === m.milestone);
+                return '<td class="num">' + (average ? formatMs(average.average) : '-') + '</td>';
+            }).join('') + '</tr>').join('') +
+        '</table>';
+}
+
+function render(profile) {
+    document.getElementById('title').textContent = '👤 ' + profile.names.join(' / ');
+    const record = profile.record;
+    document.getElementById('content').innerHTML =
+        '<div class="card"><div class="summary">' +
+            '<div><div class="value">' + record.games + '</div><div class="label">Games</div></div>' +
+            '<div><div class="value">' + record.wins + ' / ' + record.losses + '</div><div class="label">Wins / Losses</div></div>' +
+            '<div><div class="value">' + winRate(record) + '</div><div class="label">Win Rate</div></div>' +
+            (profile.profile_id ? '<div><div class="value">' + escapeHTML(profile.profile_id) + '</div><div class="label">Profile ID</div></div>' : '') +
+        '</div></div>' +
+        '<div class="card"><h3>Win Rate Trend</h3>' + trendChart(profile.trend) + trendTable(profile) + '</div>' +
+        '<div class="grid">' +
+            recordTable('By Faction', 'Faction', profile.by_faction) +
+            recordTable('By Map', 'Map', profile.by_map) +
+            recordTable('By Matchup', 'Matchup', profile.by_matchup) +
+            '<div class="card"><h3>Average Milestones</h3><table>' +
+                '<tr><th>Milestone</th><th class="num">Average</th><th class="num">Games</th></tr>' +
+                (profile.milestones || []).map(m => '<tr><td>' + escapeHTML(m.label) + '</td><td class="num">' +
+                    formatMs(m.average) + '</td><td class="num">' + m.samples + '</td></tr>').join('') +
+            '</table></div>' +
+            countTable('Favourite Battlegroups', 'Battlegroup', profile.battlegroups) +
+            countTable('Most Built Units', 'Unit', profile.units) +
+        '</div>';
+}
+
+const params = new URLSearchParams(window.location.search);
+fetch('/api/profile?' + params.toString())
+    .then(response => response.ok ? response.json() : response.text().then(text => Promise.reject(new Error(text))))
+    .then(render)
+    .catch(error => {
+        document.getElementById('content').innerHTML =
+            '<div class="card error">Could not load profile: ' + escapeHTML(error.message) + '</div>';
+    });
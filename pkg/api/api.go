@@ -0,0 +1,153 @@
+// Package api defines the JSON schemas of the web server's versioned REST API.
+//
+// The types are decoupled from the parser's output (vault.ReplayData) so that
+// parser changes do not break API clients. Within a version, fields are only
+// ever added, never renamed or removed. The package has no cgo dependencies and
+// can be imported by clients.
+package api
+
+import "time"
+
+// Version is the current API version; its endpoints live under BasePath
+const Version = "v1"
+
+// BasePath is the path prefix of the current API version
+const BasePath = "/api/" + Version
+
+// Error is the body of every non-2xx response
+type Error struct {
+	Error string `json:"error"`
+}
+
+// ReplaySummary describes a stored replay without loading its commands
+type ReplaySummary struct {
+	ID              string          `json:"id"`
+	MatchHistoryID  string          `json:"matchhistory_id,omitempty"`
+	Map             string          `json:"map"`
+	DurationSeconds uint32          `json:"duration_seconds"`
+	GameVersion     uint16          `json:"game_version,omitempty"`
+	GameType        string          `json:"game_type,omitempty"`
+	PlayedAt        *time.Time      `json:"played_at,omitempty"` // Nil if the replay does not record it
+	AddedAt         time.Time       `json:"added_at"`
+	WinningTeam     *uint32         `json:"winning_team,omitempty"` // Nil if the replay does not record a winner
+	Players         []PlayerSummary `json:"players"`
+}
+
+// PlayerSummary identifies a player in a replay
+type PlayerSummary struct {
+	ID        uint32 `json:"id"`
+	Name      string `json:"name"`
+	TeamID    uint32 `json:"team_id"`
+	Faction   string `json:"faction,omitempty"`
+	ProfileID string `json:"profile_id,omitempty"`
+	SteamID   string `json:"steam_id,omitempty"`
+}
+
+// ReplayList is the response of GET /replays
+type ReplayList struct {
+	Replays []ReplaySummary `json:"replays"`
+}
+
+// Replay is the full match metadata of a stored replay, documented as the
+// ReplayData schema
+type Replay struct {
+	ID              string     `json:"id"`
+	Source          string     `json:"source"` // File name the replay was uploaded or imported as
+	MatchHistoryID  string     `json:"matchhistory_id,omitempty"`
+	Map             string     `json:"map"`
+	MapFilename     string     `json:"map_filename,omitempty"`
+	DurationSeconds uint32     `json:"duration_seconds"`
+	GameVersion     uint16     `json:"game_version,omitempty"`
+	GameType        string     `json:"game_type,omitempty"`
+	PlayedAt        *time.Time `json:"played_at,omitempty"`
+	AddedAt         time.Time  `json:"added_at"`
+	WinningTeam     *uint32    `json:"winning_team,omitempty"`
+	Teams           []Team     `json:"teams"`
+	Players         []Player   `json:"players"`
+	Messages        []Message  `json:"messages"`
+}
+
+// Team lists the players of a team
+type Team struct {
+	ID        uint32   `json:"id"`
+	PlayerIDs []uint32 `json:"player_ids"`
+}
+
+// Player is a player in a replay
+type Player struct {
+	ID          uint32 `json:"id"`
+	Name        string `json:"name"`
+	TeamID      uint32 `json:"team_id"`
+	Faction     string `json:"faction,omitempty"`
+	IsHuman     bool   `json:"is_human"`
+	ProfileID   string `json:"profile_id,omitempty"`
+	SteamID     string `json:"steam_id,omitempty"`
+	Battlegroup string `json:"battlegroup,omitempty"` // First battlegroup selected
+	Commands    int    `json:"commands"`              // Number of commands issued
+}
+
+// PlayerList is the response of GET /replays/{id}/players
+type PlayerList struct {
+	Players []Player `json:"players"`
+}
+
+// Message is a chat message or game event
+type Message struct {
+	Timestamp uint32  `json:"timestamp"` // Milliseconds from the start of the game
+	PlayerID  *uint32 `json:"player_id,omitempty"`
+	Content   string  `json:"content"`
+	Type      string  `json:"type"`
+}
+
+// Command is a command issued by a player
+type Command struct {
+	PlayerID  uint32 `json:"player_id"`
+	Timestamp uint32 `json:"timestamp"` // Milliseconds from the start of the game
+	Time      string `json:"time"`      // MM:SS
+	Type      string `json:"type"`
+	Category  string `json:"category"`
+	Name      string `json:"name,omitempty"` // Resolved unit, building, upgrade or battlegroup name
+	PBGID     string `json:"pbgid,omitempty"`
+}
+
+// CommandList is the response of GET /replays/{id}/commands. Total counts all
+// matching commands; Commands holds the page selected with offset and limit.
+type CommandList struct {
+	Total    int       `json:"total"`
+	Commands []Command `json:"commands"`
+}
+
+// Analysis is the response of GET /replays/{id}/analysis
+type Analysis struct {
+	ReplayID string           `json:"replay_id"`
+	Players  []PlayerAnalysis `json:"players"`
+}
+
+// PlayerAnalysis summarises one player's game
+type PlayerAnalysis struct {
+	PlayerID          uint32         `json:"player_id"`
+	PlayerName        string         `json:"player_name"`
+	Faction           string         `json:"faction,omitempty"`
+	Result            string         `json:"result"` // win, loss or unknown
+	Battlegroup       string         `json:"battlegroup,omitempty"`
+	CommandsPerMinute float64        `json:"commands_per_minute"`
+	CommandCounts     map[string]int `json:"command_counts"`  // By command type
+	CategoryCounts    map[string]int `json:"category_counts"` // By command category
+	Milestones        []Milestone    `json:"milestones"`
+}
+
+// Milestone is the time a player first reached a key point of their build
+type Milestone struct {
+	Milestone string `json:"milestone"`
+	Label     string `json:"label"`
+	Timestamp uint32 `json:"timestamp"` // Milliseconds from the start of the game
+	Time      string `json:"time"`      // MM:SS
+	Name      string `json:"name"`
+}
+
+// Match results reported in PlayerAnalysis.Result
+const (
+	ResultWin     = "win"
+	ResultLoss    = "loss"
+	ResultUnknown = "unknown"
+)
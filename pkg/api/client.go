@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the versioned REST API of a coh3-web-server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the server at baseURL, e.g. http://localhost:8080.
+// A nil httpClient uses http.DefaultClient.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// StatusError is returned for non-2xx responses
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// ReplayQuery selects stored replays. Zero-valued fields match everything.
+type ReplayQuery struct {
+	Text        string
+	Player      string // Player name, profile ID or Steam ID
+	Faction     string
+	Map         string
+	GameVersion uint16
+	TeamSize    int
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	Since       time.Time
+	Until       time.Time
+}
+
+func (q ReplayQuery) values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("q", q.Text)
+	set("player", q.Player)
+	set("faction", q.Faction)
+	set("map", q.Map)
+	if q.GameVersion != 0 {
+		set("version", strconv.Itoa(int(q.GameVersion)))
+	}
+	if q.TeamSize != 0 {
+		set("team_size", strconv.Itoa(q.TeamSize))
+	}
+	if q.MinDuration != 0 {
+		set("min_duration", q.MinDuration.String())
+	}
+	if q.MaxDuration != 0 {
+		set("max_duration", q.MaxDuration.String())
+	}
+	if !q.Since.IsZero() {
+		set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		set("until", q.Until.Format(time.RFC3339))
+	}
+	return values
+}
+
+// CommandQuery selects commands of a replay. Zero-valued fields match everything.
+type CommandQuery struct {
+	Types  []string
+	Player string        // Player name (case-insensitive) or ID
+	From   time.Duration // Commands at or after this game time
+	To     time.Duration // Commands before this game time
+	Where  string        // Filter expression
+	Offset int
+	Limit  int
+}
+
+func (q CommandQuery) values() url.Values {
+	values := url.Values{}
+	for _, t := range q.Types {
+		values.Add("type", t)
+	}
+	if q.Player != "" {
+		values.Set("player", q.Player)
+	}
+	if q.From != 0 {
+		values.Set("from", q.From.String())
+	}
+	if q.To != 0 {
+		values.Set("to", q.To.String())
+	}
+	if q.Where != "" {
+		values.Set("where", q.Where)
+	}
+	if q.Offset != 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit != 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return values
+}
+
+// ListReplays lists stored replays matching the query, most recently played first
+func (c *Client) ListReplays(ctx context.Context, q ReplayQuery) ([]ReplaySummary, error) {
+	var list ReplayList
+	if err := c.get(ctx, "/replays", q.values(), &list); err != nil {
+		return nil, err
+	}
+	return list.Replays, nil
+}
+
+// UploadReplay uploads a replay file and returns its metadata. created is false
+// if the server already stored the replay.
+func (c *Client) UploadReplay(ctx context.Context, fileName string, replay io.Reader) (result *Replay, created bool, err error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("replay", fileName)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := io.Copy(part, replay); err != nil {
+		return nil, false, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+BasePath+"/replays", &body)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	result = &Replay{}
+	status, err := c.do(req, result)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, status == http.StatusCreated, nil
+}
+
+// GetReplay returns the full match metadata of a stored replay
+func (c *Client) GetReplay(ctx context.Context, id string) (*Replay, error) {
+	var replay Replay
+	if err := c.get(ctx, "/replays/"+url.PathEscape(id), nil, &replay); err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+// ListPlayers returns the players of a stored replay
+func (c *Client) ListPlayers(ctx context.Context, id string) ([]Player, error) {
+	var list PlayerList
+	if err := c.get(ctx, "/replays/"+url.PathEscape(id)+"/players", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Players, nil
+}
+
+// ListCommands returns the commands of a stored replay matching the query, in game order
+func (c *Client) ListCommands(ctx context.Context, id string, q CommandQuery) (*CommandList, error) {
+	var list CommandList
+	if err := c.get(ctx, "/replays/"+url.PathEscape(id)+"/commands", q.values(), &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetAnalysis returns the per-player analysis of a stored replay
+func (c *Client) GetAnalysis(ctx context.Context, id string) (*Analysis, error) {
+	var analysis Analysis
+	if err := c.get(ctx, "/replays/"+url.PathEscape(id)+"/analysis", nil, &analysis); err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	target := c.baseURL + BasePath + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(req, v)
+	return err
+}
+
+// do sends a request and decodes a successful JSON response into v
+func (c *Client) do(req *http.Request, v interface{}) (int, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr Error
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(body))
+		}
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("invalid response from %s: %w", req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,9 @@
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document describing the web server's JSON endpoints,
+// served at /api/openapi.json. Update it together with the schemas in this package.
+//
+//go:embed openapi.json
+var OpenAPI []byte
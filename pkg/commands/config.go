@@ -6,6 +6,7 @@ import "github.com/scharissis/coh3-replay-analyser/vault"
 type FilterConfig struct {
 	preset *FilterPreset
 	custom []CommandType
+	where  Predicate
 }
 
 // NewFilterConfig creates a new filter configuration
@@ -13,10 +14,18 @@ func NewFilterConfig() *FilterConfig {
 	return &FilterConfig{}
 }
 
-// WithPreset sets a predefined filter preset
-func (c *FilterConfig) WithPreset(preset FilterPreset) *FilterConfig {
+// WithPreset sets a predefined filter preset. A preset's Where expression is
+// applied as a where clause; an invalid expression returns its *ExprError.
+func (c *FilterConfig) WithPreset(preset FilterPreset) (*FilterConfig, error) {
+	if preset.Where != "" {
+		expr, err := ParseExpression(preset.Where)
+		if err != nil {
+			return nil, err
+		}
+		c.WithWhere(expr.Predicate())
+	}
 	c.preset = &preset
-	return c
+	return c, nil
 }
 
 // WithCustom sets custom command types to include
@@ -37,73 +46,96 @@ func (c *FilterConfig) WithProperty(filter func(CommandDefinition) bool) *Filter
 	return c
 }
 
+// WithWhere narrows the configuration with an additional query predicate.
+// Repeated calls combine with and. Predicates only apply to already-parsed
+// replays (see Apply).
+func (c *FilterConfig) WithWhere(predicate Predicate) *FilterConfig {
+	if c.where != nil {
+		predicate = And(c.where, predicate)
+	}
+	c.where = predicate
+	return c
+}
+
+// WithExpression narrows the configuration with a textual filter expression
+func (c *FilterConfig) WithExpression(expression string) (*FilterConfig, error) {
+	expr, err := ParseExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return c.WithWhere(expr.Predicate()), nil
+}
+
+// Apply filters an already-parsed replay with this configuration
+func (c *FilterConfig) Apply(data *vault.ReplayData) *vault.ReplayData {
+	return Apply(data, c.Predicate())
+}
+
 // ToVaultFilter converts the configuration to a vault.CommandFilter
 func (c *FilterConfig) ToVaultFilter() vault.CommandFilter {
-	// Start with all false
-	filter := vault.CommandFilter{}
-	
-	// Determine which commands to include
-	var includeTypes []CommandType
+	var types []string
+	for _, cmdType := range c.includeTypes() {
+		types = append(types, string(cmdType))
+	}
+	return vault.NewCommandFilter(types...)
+}
+
+// Predicate returns a query predicate matching the command types this
+// configuration includes, for filtering already-parsed replays
+func (c *FilterConfig) Predicate() Predicate {
+	typePredicate := ByType(c.includeTypes()...)
+	if c.where == nil {
+		return typePredicate
+	}
+	return And(typePredicate, c.where)
+}
+
+// includeTypes determines which command types the configuration includes
+func (c *FilterConfig) includeTypes() []CommandType {
 	if c.preset != nil {
-		includeTypes = c.preset.Include
-	} else if len(c.custom) > 0 {
-		includeTypes = c.custom
-	} else {
-		// Default to build commands
-		includeTypes = BuildOnlyPreset.Include
+		return c.preset.Include
 	}
-	
-	// Set the appropriate flags
-	for _, cmdType := range includeTypes {
-		switch cmdType {
-		case BuildSquad:
-			filter.IncludeBuildSquad = true
-		case ConstructEntity:
-			filter.IncludeConstructEntity = true
-		case BuildGlobalUpgrade:
-			filter.IncludeBuildGlobalUpgrade = true
-		case UseAbility:
-			filter.IncludeUseAbility = true
-		case UseBattlegroupAbility:
-			filter.IncludeUseBattlegroupAbility = true
-		case SelectBattlegroup:
-			filter.IncludeSelectBattlegroup = true
-		case SelectBattlegroupAbility:
-			filter.IncludeSelectBattlegroupAbility = true
-		case CancelConstruction:
-			filter.IncludeCancelConstruction = true
-		case CancelProduction:
-			filter.IncludeCancelProduction = true
-		case AITakeover:
-			filter.IncludeAITakeover = true
-		case Unknown:
-			filter.IncludeUnknown = true
-		}
+	if len(c.custom) > 0 {
+		return c.custom
+	}
+	// A where clause on its own selects from all commands
+	if c.where != nil {
+		return AllCommandsPreset.Include
 	}
-	
-	return filter
+	// Default to build commands
+	return BuildOnlyPreset.Include
 }
 
 // Quick access functions for common configurations
 
 // BuildCommands returns a filter for build-related commands only
 func BuildCommands() vault.CommandFilter {
-	return NewFilterConfig().WithPreset(BuildOnlyPreset).ToVaultFilter()
+	return builtinFilter(BuildOnlyPreset)
 }
 
 // CombatCommands returns a filter for combat-related commands only
 func CombatCommands() vault.CommandFilter {
-	return NewFilterConfig().WithPreset(CombatOnlyPreset).ToVaultFilter()
+	return builtinFilter(CombatOnlyPreset)
 }
 
 // AllCommands returns a filter that includes all command types
 func AllCommands() vault.CommandFilter {
-	return NewFilterConfig().WithPreset(AllCommandsPreset).ToVaultFilter()
+	return builtinFilter(AllCommandsPreset)
 }
 
 // EconomicCommands returns a filter for economy-affecting commands
 func EconomicCommands() vault.CommandFilter {
-	return NewFilterConfig().WithPreset(EconomicPreset).ToVaultFilter()
+	return builtinFilter(EconomicPreset)
+}
+
+// builtinFilter converts a built-in preset, which has no where expression,
+// to a vault.CommandFilter
+func builtinFilter(preset FilterPreset) vault.CommandFilter {
+	config, err := NewFilterConfig().WithPreset(preset)
+	if err != nil {
+		panic(err)
+	}
+	return config.ToVaultFilter()
 }
 
 // OnlySquadBuilding returns a filter for squad building commands only
@@ -158,4 +190,20 @@ filter := commands.NewFilterConfig().
 // Use the filter with vault parsing
 data, err := vault.ParseReplayWithFilter(replayFile, dataDir, filter)
 
+// Query an already-parsed replay without re-parsing
+matches := commands.Query(data, commands.And(
+	commands.ByCategory(commands.CategoryBuild),
+	commands.Before(5*time.Minute),
+	commands.ByPlayer("Tomsch"),
+	commands.ByName("Panzer"),
+))
+
+// Narrow each player's BuildCommands to the matching commands
+filtered := commands.Apply(data, commands.ByFaction("Wehrmacht"))
+
+// Or describe the same query as a filter expression
+config, err := commands.NewFilterConfig().
+	WithExpression(`type in (build_squad, construct_entity) and time < 5m and name ~ "Panzer"`)
+filtered := config.Apply(data)
+
 */
\ No newline at end of file
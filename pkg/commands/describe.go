@@ -0,0 +1,24 @@
+package commands
+
+import "github.com/scharissis/coh3-replay-analyser/vault"
+
+// Describe returns a one-line description of a command for timelines, such as
+// "🪖 Built: Grenadier Squad". Commands whose target was not resolved to a name
+// are described by their PBGID if they have one, and command types missing
+// from the registry by their raw type name.
+func Describe(cmd vault.Command) string {
+	def, known := CommandDefinitions[CommandType(cmd.CommandType)]
+	if !known {
+		return "📋 " + cmd.CommandType
+	}
+
+	name := Match{Command: &cmd}.Name()
+	switch {
+	case name != "":
+		return def.Icon + " " + def.Action + ": " + name
+	case cmd.PBGID != nil:
+		return def.Icon + " " + def.Summary + " (PBGID " + *cmd.PBGID + ")"
+	default:
+		return def.Icon + " " + def.Summary
+	}
+}
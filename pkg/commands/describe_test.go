@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		cmd  vault.Command
+		want string
+	}{
+		{vault.Command{CommandType: "build_squad", PBGID: strPtr("2071856"), UnitName: strPtr("Grenadier Squad")}, "🪖 Built: Grenadier Squad"},
+		{vault.Command{CommandType: "build_squad"}, "🪖 Built unit"},
+		{vault.Command{CommandType: "construct_entity", BuildingName: strPtr("Kampfgruppe HQ")}, "🏗️ Constructed: Kampfgruppe HQ"},
+		{vault.Command{CommandType: "select_battlegroup", UnitName: strPtr("Mechanized")}, "⚔️ Selected: Mechanized"},
+		{vault.Command{CommandType: "use_ability", PBGID: strPtr("2090001")}, "💥 Used ability (PBGID 2090001)"},
+		{vault.Command{CommandType: "use_battlegroup_ability"}, "🎯 Used battlegroup ability"},
+		{vault.Command{CommandType: "cancel_production"}, "❌ Cancelled production"},
+		{vault.Command{CommandType: "ai_takeover"}, "🤖 AI took over"},
+		{vault.Command{CommandType: "unknown"}, "❓ Unknown command"},
+		{vault.Command{CommandType: "retreat"}, "📋 retreat"},
+	}
+	for _, tt := range tests {
+		if got := Describe(tt.cmd); got != tt.want {
+			t.Errorf("Describe(%s) = %q, want %q", tt.cmd.CommandType, got, tt.want)
+		}
+	}
+
+	// Every registered command type renders with its own icon and text
+	for _, def := range RegisteredCommands() {
+		if def.Icon == "" || def.Action == "" || def.Summary == "" {
+			t.Errorf("%s has no timeline icon or text", def.Type)
+		}
+	}
+}
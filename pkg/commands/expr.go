@@ -0,0 +1,556 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Filter expressions are a small textual language for selecting commands, e.g.
+//
+//	type in (build_squad, construct_entity) and time < 5m and name ~ "Panzer"
+//
+// Grammar:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = field op value | field ["not"] "in" "(" value { "," value } ")"
+//	op         = "=" | "==" | "!=" | "<" | "<=" | ">" | ">=" | "~" | "!~"
+//
+// Fields are type, category, time, player, faction, name and pbgid. Times are
+// written as durations (90s, 5m, 1m30s), as MM:SS (01:30) or as plain seconds.
+// The ~ operator is a case-insensitive substring match.
+
+// ExprError describes a syntax or validation error in a filter expression
+type ExprError struct {
+	Expr string // the full expression
+	Pos  int    // byte offset of the offending token
+	Msg  string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("filter expression: %s at position %d", e.Msg, e.Pos+1)
+}
+
+// Context returns the expression with a caret line pointing at the error position
+func (e *ExprError) Context() string {
+	return e.Expr + "\n" + strings.Repeat(" ", e.Pos) + "^"
+}
+
+// Expression is a compiled filter expression
+type Expression struct {
+	source    string
+	predicate Predicate
+}
+
+// ParseExpression parses and validates a filter expression
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{source: source, tokens: tokens}
+	predicate, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok.describe())
+	}
+
+	return &Expression{source: source, predicate: predicate}, nil
+}
+
+// String returns the source text of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Predicate returns the expression as a query predicate
+func (e *Expression) Predicate() Predicate {
+	return e.predicate
+}
+
+// Match evaluates the expression against a command and the player that issued it
+func (e *Expression) Match(m Match) bool {
+	return e.predicate(m)
+}
+
+// MatchCommand evaluates the expression against a single command without player
+// context. Comparisons on player or faction never match.
+func (e *Expression) MatchCommand(cmd vault.Command) bool {
+	return e.predicate(Match{Player: &vault.Player{}, Command: &cmd})
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value string // unquoted string value for tokenString
+	pos   int
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// isKeyword reports whether the token is the given (case-insensitive) keyword
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+
+		case c == '"' || c == '\'':
+			start := i
+			var value strings.Builder
+			i++
+			closed := false
+			for i < len(source) {
+				if source[i] == '\\' && i+1 < len(source) {
+					value.WriteByte(source[i+1])
+					i += 2
+					continue
+				}
+				if source[i] == c {
+					closed = true
+					i++
+					break
+				}
+				value.WriteByte(source[i])
+				i++
+			}
+			if !closed {
+				return nil, &ExprError{Expr: source, Pos: start, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: source[start:i], value: value.String(), pos: start})
+
+		case strings.ContainsRune("=!<>~", rune(c)):
+			start := i
+			i++
+			if i < len(source) && (source[i] == '=' || (c == '!' && source[i] == '~')) {
+				i++
+			}
+			op := source[start:i]
+			if op == "!" {
+				return nil, &ExprError{Expr: source, Pos: start, Msg: `unexpected "!"; use != or !~`}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: start})
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (isIdentByte(source[i]) || source[i] == ':' || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], pos: start})
+
+		case isIdentByte(c) || c >= 0x80:
+			start := i
+			for i < len(source) && (isIdentByte(source[i]) || source[i] >= 0x80) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+
+		default:
+			return nil, &ExprError{Expr: source, Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(source)})
+	return tokens, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '-' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+type exprParser struct {
+	source string
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) errorf(tok token, format string, args ...interface{}) error {
+	return &ExprError{Expr: p.source, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (Predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	predicates := []Predicate{left}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, right)
+	}
+	if len(predicates) == 1 {
+		return left, nil
+	}
+	return Or(predicates...), nil
+}
+
+func (p *exprParser) parseAnd() (Predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	predicates := []Predicate{left}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, right)
+	}
+	if len(predicates) == 1 {
+		return left, nil
+	}
+	return And(predicates...), nil
+}
+
+func (p *exprParser) parseUnary() (Predicate, error) {
+	tok := p.peek()
+	switch {
+	case tok.isKeyword("not"):
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(inner), nil
+
+	case tok.kind == tokenLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected \")\" to close \"(\" at position %d, got %s", tok.pos+1, closing.describe())
+		}
+		return inner, nil
+
+	default:
+		return p.parseComparison()
+	}
+}
+
+// exprFields lists the fields that can be compared in an expression
+var exprFields = []string{"category", "faction", "name", "pbgid", "player", "time", "type"}
+
+func (p *exprParser) parseComparison() (Predicate, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenIdent || fieldTok.isKeyword("and") || fieldTok.isKeyword("or") || fieldTok.isKeyword("in") {
+		return nil, p.errorf(fieldTok, "expected a field name (%s), got %s", strings.Join(exprFields, ", "), fieldTok.describe())
+	}
+	field := strings.ToLower(fieldTok.text)
+	if !containsString(exprFields, field) {
+		return nil, p.errorf(fieldTok, "unknown field %q; expected one of %s", fieldTok.text, strings.Join(exprFields, ", "))
+	}
+
+	opTok := p.next()
+	op := opTok.text
+	negateIn := false
+	if opTok.isKeyword("not") && p.peek().isKeyword("in") {
+		negateIn = true
+		opTok = p.next()
+	}
+
+	if opTok.isKeyword("in") {
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		predicates := make([]Predicate, 0, len(values))
+		for _, value := range values {
+			predicate, err := p.compare(field, fieldTok, "=", value)
+			if err != nil {
+				return nil, err
+			}
+			predicates = append(predicates, predicate)
+		}
+		if negateIn {
+			return Not(Or(predicates...)), nil
+		}
+		return Or(predicates...), nil
+	}
+
+	if opTok.kind != tokenOperator {
+		return nil, p.errorf(opTok, "expected an operator after %q, got %s", fieldTok.text, opTok.describe())
+	}
+
+	value := p.next()
+	if value.kind != tokenIdent && value.kind != tokenString && value.kind != tokenNumber {
+		return nil, p.errorf(value, "expected a value after %q, got %s", op, value.describe())
+	}
+
+	if op == "==" {
+		op = "="
+	}
+	return p.compare(field, fieldTok, op, value)
+}
+
+func (p *exprParser) parseList() ([]token, error) {
+	open := p.next()
+	if open.kind != tokenLParen {
+		return nil, p.errorf(open, "expected \"(\" after \"in\", got %s", open.describe())
+	}
+
+	var values []token
+	for {
+		value := p.next()
+		if value.kind != tokenIdent && value.kind != tokenString && value.kind != tokenNumber {
+			return nil, p.errorf(value, "expected a value in list, got %s", value.describe())
+		}
+		values = append(values, value)
+
+		sep := p.next()
+		if sep.kind == tokenRParen {
+			return values, nil
+		}
+		if sep.kind != tokenComma {
+			return nil, p.errorf(sep, "expected \",\" or \")\" in list, got %s", sep.describe())
+		}
+	}
+}
+
+// compare builds the predicate for a single field comparison
+func (p *exprParser) compare(field string, fieldTok token, op string, value token) (Predicate, error) {
+	text := value.text
+	if value.kind == tokenString {
+		text = value.value
+	}
+
+	var predicate Predicate
+	switch field {
+	case "type":
+		cmdType := CommandType(strings.ToLower(text))
+		if _, exists := CommandDefinitions[cmdType]; !exists {
+			return nil, p.errorf(value, "unknown command type %q; expected one of %s", text, strings.Join(knownCommandTypes(), ", "))
+		}
+		predicate = ByType(cmdType)
+
+	case "category":
+		category := CommandCategory(strings.ToLower(text))
+		if len(GetCommandsByCategory(category)) == 0 {
+			return nil, p.errorf(value, "unknown category %q; expected one of %s", text, strings.Join(knownCategories(), ", "))
+		}
+		predicate = ByCategory(category)
+
+	case "time":
+		t, err := ParseGameTime(text)
+		if err != nil {
+			return nil, p.errorf(value, "invalid time %q: use a duration like 90s or 5m, or MM:SS", text)
+		}
+		switch op {
+		case "<":
+			return Before(t), nil
+		case "<=":
+			return Not(After(t + time.Millisecond)), nil
+		case ">":
+			return After(t + time.Millisecond), nil
+		case ">=":
+			return After(t), nil
+		case "=":
+			return Between(t, t+time.Second), nil
+		case "!=":
+			return Not(Between(t, t+time.Second)), nil
+		}
+		return nil, p.errorf(fieldTok, "operator %q is not supported for time", op)
+
+	case "player":
+		if op == "~" || op == "!~" {
+			predicate = playerNameContains(text)
+		} else {
+			predicate = ByPlayer(text)
+		}
+
+	case "faction":
+		if op == "~" || op == "!~" {
+			predicate = factionContains(text)
+		} else {
+			predicate = ByFaction(text)
+		}
+
+	case "name":
+		if op == "~" || op == "!~" {
+			predicate = ByName(text)
+		} else {
+			predicate = nameEquals(text)
+		}
+
+	case "pbgid":
+		if value.kind != tokenNumber {
+			return nil, p.errorf(value, "pbgid must be a number, got %s", value.describe())
+		}
+		predicate = ByPBGID(text)
+	}
+
+	switch op {
+	case "=":
+		return predicate, nil
+	case "!=":
+		return Not(predicate), nil
+	case "~":
+		if field == "player" || field == "faction" || field == "name" {
+			return predicate, nil
+		}
+	case "!~":
+		if field == "player" || field == "faction" || field == "name" {
+			return Not(predicate), nil
+		}
+	}
+	return nil, p.errorf(fieldTok, "operator %q is not supported for %s", op, field)
+}
+
+// ParseGameTime parses a game time written as a duration (90s, 5m), MM:SS or
+// seconds. The whole text must match, and negative times and MM:SS times with
+// 60 or more seconds are rejected.
+func ParseGameTime(text string) (time.Duration, error) {
+	if minuteText, secondText, found := strings.Cut(text, ":"); found {
+		minutes, minErr := parseDigits(minuteText)
+		seconds, secErr := parseDigits(secondText)
+		if minErr != nil || secErr != nil || len(secondText) > 2 || seconds >= 60 {
+			return 0, fmt.Errorf("invalid game time %q: expected MM:SS", text)
+		}
+		return time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, nil
+	}
+
+	var t time.Duration
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return 0, fmt.Errorf("invalid game time %q", text)
+		}
+		t = time.Duration(seconds * float64(time.Second))
+	} else if t, err = time.ParseDuration(text); err != nil {
+		return 0, err
+	}
+	if t < 0 {
+		return 0, fmt.Errorf("invalid game time %q: must not be negative", text)
+	}
+	return t, nil
+}
+
+// parseDigits parses a non-empty run of decimal digits, without a sign
+func parseDigits(text string) (int, error) {
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("%q is not a number", text)
+		}
+	}
+	return strconv.Atoi(text)
+}
+
+func playerNameContains(text string) Predicate {
+	text = strings.ToLower(text)
+	return func(m Match) bool {
+		return strings.Contains(strings.ToLower(m.Player.PlayerName), text)
+	}
+}
+
+func factionContains(text string) Predicate {
+	text = strings.ToLower(text)
+	return func(m Match) bool {
+		return m.Player.Faction != nil && strings.Contains(strings.ToLower(*m.Player.Faction), text)
+	}
+}
+
+func nameEquals(text string) Predicate {
+	return func(m Match) bool {
+		return strings.EqualFold(m.Name(), text)
+	}
+}
+
+func knownCommandTypes() []string {
+	var types []string
+	for cmdType := range CommandDefinitions {
+		types = append(types, string(cmdType))
+	}
+	sort.Strings(types)
+	return types
+}
+
+func knownCategories() []string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, def := range CommandDefinitions {
+		if !seen[string(def.Category)] {
+			seen[string(def.Category)] = true
+			categories = append(categories, string(def.Category))
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExpression(t *testing.T) {
+	data := testReplay()
+
+	tests := []struct {
+		expr     string
+		expected int
+	}{
+		{`type = build_squad`, 3},
+		{`type == build_squad`, 3},
+		{`type != build_squad`, 4},
+		{`type in (build_squad, construct_entity)`, 4},
+		{`type not in (build_squad, construct_entity)`, 3},
+		{`category = combat`, 2},
+		{`time < 1m`, 2},
+		{`time <= 61s`, 3},
+		{`time > 01:38`, 3},
+		{`time >= 1m38s and time < 7m`, 3},
+		{`time = 98`, 1},
+		{`player = Tomsch`, 4},
+		{`player = 1`, 3},
+		{`player ~ "sur"`, 3},
+		{`faction = wehrmacht`, 4},
+		{`faction ~ merican`, 3},
+		{`name ~ "Panzer"`, 1},
+		{`name !~ squad and type = build_squad`, 1},
+		{`name = "grenadier squad"`, 1},
+		{`pbgid = 196934`, 1},
+		{`pbgid in (196934, 198361)`, 2},
+		{`TYPE = build_squad AND (player = 0 OR name ~ engineer)`, 3},
+		{`not type = build_squad`, 4},
+		{`type in (build_squad, construct_entity) and time < 5m and name ~ "Panzer"`, 0},
+		{`type in (build_squad, construct_entity) and time < 8m and name ~ "Panzer"`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expr.String() != tt.expr {
+				t.Errorf("String() = %q, want %q", expr.String(), tt.expr)
+			}
+			matches := Query(data, expr.Predicate())
+			if len(matches) != tt.expected {
+				t.Errorf("expected %d matches, got %d", tt.expected, len(matches))
+			}
+		})
+	}
+}
+
+func TestParseExpression_Errors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		pos     int
+		message string
+	}{
+		{`type = build_sqaud`, 8, "unknown command type"},
+		{`typ = build_squad`, 1, "unknown field"},
+		{`type < build_squad`, 1, `operator "<" is not supported for type`},
+		{`time < soon`, 8, "invalid time"},
+		{`name ~ "Panzer`, 8, "unterminated string"},
+		{`type = build_squad and`, 23, "expected a field name"},
+		{`(type = build_squad`, 20, `expected ")"`},
+		{`type in (build_squad construct_entity)`, 22, `expected "," or ")"`},
+		{`type = build_squad or or`, 23, "expected a field name"},
+		{`time ! 5m`, 6, `unexpected "!"`},
+		{`pbgid = abc`, 9, "pbgid must be a number"},
+		{`type = build_squad )`, 20, `unexpected ")"`},
+		{`category = economy`, 12, "unknown category"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseExpression(tt.expr)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			var exprErr *ExprError
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("expected *ExprError, got %T", err)
+			}
+			if exprErr.Pos+1 != tt.pos {
+				t.Errorf("expected error at position %d, got %d (%v)", tt.pos, exprErr.Pos+1, err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error to contain %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestParseGameTime(t *testing.T) {
+	valid := []struct {
+		text     string
+		expected time.Duration
+	}{
+		{"90", 90 * time.Second},
+		{"1.5", 1500 * time.Millisecond},
+		{"90s", 90 * time.Second},
+		{"5m", 5 * time.Minute},
+		{"1m30s", 90 * time.Second},
+		{"1:30", 90 * time.Second},
+		{"01:05", 65 * time.Second},
+		{"0:00", 0},
+		{"12:59", 12*time.Minute + 59*time.Second},
+	}
+	for _, tt := range valid {
+		if got, err := ParseGameTime(tt.text); err != nil || got != tt.expected {
+			t.Errorf("ParseGameTime(%q) = %v, %v; want %v", tt.text, got, err, tt.expected)
+		}
+	}
+
+	for _, text := range []string{
+		"", "soon", "1:30:00", "1:30abc", "1:60", "1:99", "1:-5", "-1:30", "+1:30", "1:", ":30", "1:005",
+		"-5", "-5m", "NaN", "Inf", "5 m",
+	} {
+		if got, err := ParseGameTime(text); err == nil {
+			t.Errorf("ParseGameTime(%q) = %v, want an error", text, got)
+		}
+	}
+}
+
+func TestExpressionMatchCommand(t *testing.T) {
+	expr, err := ParseExpression(`type = build_squad and name ~ grenadier`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cmd := testReplay().Players[0].Commands[0]
+	if !expr.MatchCommand(cmd) {
+		t.Errorf("expected command to match: %+v", cmd)
+	}
+}
+
+func TestFilterConfigWithExpression(t *testing.T) {
+	config, err := NewFilterConfig().WithExpression(`category = combat`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	filtered := config.Apply(testReplay())
+	if len(filtered.Players[0].BuildCommands) != 1 || len(filtered.Players[1].BuildCommands) != 1 {
+		t.Errorf("expected one combat command per player, got %+v", filtered.Players)
+	}
+
+	// Presets still apply alongside the expression
+	config, err = NewFilterConfig().WithPreset(BuildOnlyPreset)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config, err = config.WithExpression(`player = 1`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	filtered = config.Apply(testReplay())
+	if len(filtered.Players[0].BuildCommands) != 0 || len(filtered.Players[1].BuildCommands) != 2 {
+		t.Errorf("expected only Surgie's build commands, got %+v", filtered.Players)
+	}
+}
@@ -33,109 +33,164 @@ type CommandDefinition struct {
 	Type        CommandType
 	Category    CommandCategory
 	Description string
-	IsBuildable bool // Does this command create/build something?
-	IsCombat    bool // Is this a combat-related action?
-	IsEconomic  bool // Does this affect economy/resources?
+	Icon        string // Shown before the command in timelines
+	Action      string // Timeline text for a command naming its target, e.g. "Built" in "Built: Grenadier Squad"
+	Summary     string // Timeline text for a command without a resolved target, e.g. "Built unit"
+	IsBuildable bool   // Does this command create/build something?
+	IsCombat    bool   // Is this a combat-related action?
+	IsEconomic  bool   // Does this affect economy/resources?
 }
 
-// CommandDefinitions defines all known command types and their properties
-// This is the single source of truth for command configuration
-var CommandDefinitions = map[CommandType]CommandDefinition{
-	BuildSquad: {
+// commandRegistry defines all known command types and their properties, in display order.
+// This is the single source of truth for command configuration: a new command type
+// needs only an entry here and a matching kind in the parser's COMMAND_KINDS table
+// (vault-wrapper/src/lib.rs); filters carry command types by name across the FFI.
+var commandRegistry = []CommandDefinition{
+	{
 		Type:        BuildSquad,
 		Category:    CategoryBuild,
 		Description: "Build a squad/unit",
+		Icon:        "🪖",
+		Action:      "Built",
+		Summary:     "Built unit",
 		IsBuildable: true,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	ConstructEntity: {
+	{
 		Type:        ConstructEntity,
 		Category:    CategoryBuild,
 		Description: "Construct a building",
+		Icon:        "🏗️",
+		Action:      "Constructed",
+		Summary:     "Constructed building",
 		IsBuildable: true,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	BuildGlobalUpgrade: {
+	{
 		Type:        BuildGlobalUpgrade,
 		Category:    CategoryBuild,
 		Description: "Research a technology upgrade",
+		Icon:        "🔬",
+		Action:      "Researched",
+		Summary:     "Researched upgrade",
 		IsBuildable: true,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	UseAbility: {
+	{
 		Type:        UseAbility,
 		Category:    CategoryCombat,
 		Description: "Use a unit ability",
+		Icon:        "💥",
+		Action:      "Used",
+		Summary:     "Used ability",
 		IsBuildable: false,
 		IsCombat:    true,
 		IsEconomic:  false,
 	},
-	UseBattlegroupAbility: {
+	{
 		Type:        UseBattlegroupAbility,
 		Category:    CategoryCombat,
 		Description: "Use a battlegroup ability",
+		Icon:        "🎯",
+		Action:      "Used",
+		Summary:     "Used battlegroup ability",
 		IsBuildable: false,
 		IsCombat:    true,
 		IsEconomic:  false,
 	},
-	SelectBattlegroup: {
+	{
 		Type:        SelectBattlegroup,
 		Category:    CategoryBuild,
 		Description: "Select a battlegroup",
+		Icon:        "⚔️",
+		Action:      "Selected",
+		Summary:     "Selected battlegroup",
 		IsBuildable: true,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	SelectBattlegroupAbility: {
+	{
 		Type:        SelectBattlegroupAbility,
 		Category:    CategoryBuild,
 		Description: "Select a battlegroup ability",
+		Icon:        "🎖️",
+		Action:      "Unlocked",
+		Summary:     "Unlocked battlegroup ability",
 		IsBuildable: true,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	CancelConstruction: {
+	{
 		Type:        CancelConstruction,
 		Category:    CategoryCancel,
 		Description: "Cancel building construction",
+		Icon:        "🚫",
+		Action:      "Cancelled",
+		Summary:     "Cancelled construction",
 		IsBuildable: false,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	CancelProduction: {
+	{
 		Type:        CancelProduction,
 		Category:    CategoryCancel,
 		Description: "Cancel unit production",
+		Icon:        "❌",
+		Action:      "Cancelled",
+		Summary:     "Cancelled production",
 		IsBuildable: false,
 		IsCombat:    false,
 		IsEconomic:  true,
 	},
-	AITakeover: {
+	{
 		Type:        AITakeover,
 		Category:    CategoryControl,
 		Description: "AI takes control of player",
+		Icon:        "🤖",
+		Action:      "AI took over",
+		Summary:     "AI took over",
 		IsBuildable: false,
 		IsCombat:    false,
 		IsEconomic:  false,
 	},
-	Unknown: {
+	{
 		Type:        Unknown,
 		Category:    CategoryOther,
 		Description: "Unknown command type",
+		Icon:        "❓",
+		Action:      "Unknown command",
+		Summary:     "Unknown command",
 		IsBuildable: false,
 		IsCombat:    false,
 		IsEconomic:  false,
 	},
 }
 
+// CommandDefinitions indexes the registered command definitions by type
+var CommandDefinitions = indexCommandDefinitions(commandRegistry)
+
+func indexCommandDefinitions(registry []CommandDefinition) map[CommandType]CommandDefinition {
+	definitions := make(map[CommandType]CommandDefinition, len(registry))
+	for _, def := range registry {
+		definitions[def.Type] = def
+	}
+	return definitions
+}
+
+// RegisteredCommands returns the definitions of all known command types in registry order
+func RegisteredCommands() []CommandDefinition {
+	return append([]CommandDefinition(nil), commandRegistry...)
+}
+
 // FilterPreset represents a named collection of command types to include
 type FilterPreset struct {
-	Name        string
-	Description string
-	Include     []CommandType
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Include     []CommandType `json:"include"`
+	Where       string        `json:"where,omitempty"` // Optional filter expression narrowing the included commands
 }
 
 // Predefined filter presets for common use cases
@@ -181,8 +236,8 @@ var (
 // GetAllCommandTypes returns all known command types
 func GetAllCommandTypes() []CommandType {
 	var types []CommandType
-	for cmdType := range CommandDefinitions {
-		types = append(types, cmdType)
+	for _, def := range commandRegistry {
+		types = append(types, def.Type)
 	}
 	return types
 }
@@ -190,9 +245,9 @@ func GetAllCommandTypes() []CommandType {
 // GetCommandsByCategory returns all command types in a specific category
 func GetCommandsByCategory(category CommandCategory) []CommandType {
 	var types []CommandType
-	for cmdType, def := range CommandDefinitions {
+	for _, def := range commandRegistry {
 		if def.Category == category {
-			types = append(types, cmdType)
+			types = append(types, def.Type)
 		}
 	}
 	return types
@@ -201,9 +256,9 @@ func GetCommandsByCategory(category CommandCategory) []CommandType {
 // GetCommandsByProperty returns command types matching a custom property filter
 func GetCommandsByProperty(filter func(CommandDefinition) bool) []CommandType {
 	var types []CommandType
-	for cmdType, def := range CommandDefinitions {
+	for _, def := range commandRegistry {
 		if filter(def) {
-			types = append(types, cmdType)
+			types = append(types, def.Type)
 		}
 	}
 	return types
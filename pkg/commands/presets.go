@@ -0,0 +1,285 @@
+package commands
+
+import (
+	"errors"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PresetDirEnv overrides the directory user presets are loaded from
+const PresetDirEnv = "COH3_PRESET_DIR"
+
+// presetFile is the on-disk format of a user-defined filter preset.
+// Include, Categories and Properties are combined; Where narrows the result.
+//
+//	name: early_army
+//	description: Units and upgrades in the first five minutes
+//	include: [build_squad, build_global_upgrade]
+//	categories: [combat]
+//	properties: [IsEconomic]
+//	where: time < 5m
+type presetFile struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description" yaml:"description"`
+	Include     []string `json:"include" yaml:"include"`
+	Categories  []string `json:"categories" yaml:"categories"`
+	Properties  []string `json:"properties" yaml:"properties"`
+	Where       string   `json:"where" yaml:"where"`
+}
+
+// presetProperties maps property selector names to CommandDefinition flags
+var presetProperties = map[string]func(CommandDefinition) bool{
+	"isbuildable": func(def CommandDefinition) bool { return def.IsBuildable },
+	"iscombat":    func(def CommandDefinition) bool { return def.IsCombat },
+	"iseconomic":  func(def CommandDefinition) bool { return def.IsEconomic },
+}
+
+// BuiltinPresets returns the presets compiled into the binary
+func BuiltinPresets() []FilterPreset {
+	presets := []FilterPreset{
+		BuildOnlyPreset,
+		CombatOnlyPreset,
+		EconomicPreset,
+		AllCommandsPreset,
+	}
+	return append(presets, ExampleCustomFilters...)
+}
+
+// DefaultPresetDir returns the directory user presets are loaded from:
+// $COH3_PRESET_DIR if set, otherwise coh3-replay-analyser/presets in the
+// user config directory (e.g. ~/.config on Linux)
+func DefaultPresetDir() (string, error) {
+	if dir := os.Getenv(PresetDirEnv); dir != "" {
+		return dir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "coh3-replay-analyser", "presets"), nil
+}
+
+// LoadPresetDir loads and validates every .json, .yaml and .yml preset file in a directory.
+// A missing directory is not an error and yields no presets. Invalid files and
+// duplicate presets are skipped and reported in the error, which joins one error
+// per problem; the valid presets are returned either way.
+func LoadPresetDir(dir string) ([]FilterPreset, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preset directory: %w", err)
+	}
+
+	var presets []FilterPreset
+	var problems []error
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		filePresets, err := LoadPresetFile(path)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		for _, preset := range filePresets {
+			if other, exists := seen[preset.Name]; exists {
+				problems = append(problems, fmt.Errorf("%s: preset %q is already defined in %s", path, preset.Name, other))
+				continue
+			}
+			seen[preset.Name] = path
+			presets = append(presets, preset)
+		}
+	}
+
+	return presets, errors.Join(problems...)
+}
+
+// LoadPresetFile loads and validates the presets in a JSON or YAML file.
+// A file may contain a single preset or a list of presets.
+func LoadPresetFile(path string) ([]FilterPreset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []presetFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = unmarshalPresets(data, &files, yaml.Unmarshal)
+	default:
+		err = unmarshalPresets(data, &files, json.Unmarshal)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	presets := make([]FilterPreset, 0, len(files))
+	for _, file := range files {
+		preset, err := file.toPreset()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		presets = append(presets, preset)
+	}
+	return presets, nil
+}
+
+// unmarshalPresets decodes either a single preset or a list of presets
+func unmarshalPresets(data []byte, files *[]presetFile, unmarshal func([]byte, interface{}) error) error {
+	if err := unmarshal(data, files); err == nil {
+		return nil
+	}
+	var single presetFile
+	if err := unmarshal(data, &single); err != nil {
+		return err
+	}
+	*files = []presetFile{single}
+	return nil
+}
+
+// toPreset validates a preset file against CommandDefinitions
+func (f presetFile) toPreset() (FilterPreset, error) {
+	if strings.TrimSpace(f.Name) == "" {
+		return FilterPreset{}, fmt.Errorf("preset is missing a name")
+	}
+
+	var include []CommandType
+	seen := make(map[CommandType]bool)
+	add := func(types ...CommandType) {
+		for _, cmdType := range types {
+			if !seen[cmdType] {
+				seen[cmdType] = true
+				include = append(include, cmdType)
+			}
+		}
+	}
+
+	for _, name := range f.Include {
+		cmdType := CommandType(strings.ToLower(name))
+		if _, exists := CommandDefinitions[cmdType]; !exists {
+			return FilterPreset{}, fmt.Errorf("preset %q: unknown command type %q; expected one of %s",
+				f.Name, name, strings.Join(knownCommandTypes(), ", "))
+		}
+		add(cmdType)
+	}
+
+	for _, name := range f.Categories {
+		types := GetCommandsByCategory(CommandCategory(strings.ToLower(name)))
+		if len(types) == 0 {
+			return FilterPreset{}, fmt.Errorf("preset %q: unknown category %q; expected one of %s",
+				f.Name, name, strings.Join(knownCategories(), ", "))
+		}
+		sortCommandTypes(types)
+		add(types...)
+	}
+
+	for _, name := range f.Properties {
+		property, exists := presetProperties[strings.ToLower(strings.ReplaceAll(name, "_", ""))]
+		if !exists {
+			return FilterPreset{}, fmt.Errorf("preset %q: unknown property %q; expected one of IsBuildable, IsCombat, IsEconomic",
+				f.Name, name)
+		}
+		types := GetCommandsByProperty(property)
+		sortCommandTypes(types)
+		add(types...)
+	}
+
+	if f.Where != "" {
+		if _, err := ParseExpression(f.Where); err != nil {
+			return FilterPreset{}, fmt.Errorf("preset %q: %w", f.Name, err)
+		}
+		// A where clause on its own selects from all commands
+		if len(include) == 0 {
+			include = GetAllCommandTypes()
+			sortCommandTypes(include)
+		}
+	}
+
+	if len(include) == 0 {
+		return FilterPreset{}, fmt.Errorf("preset %q selects no command types", f.Name)
+	}
+
+	return FilterPreset{
+		Name:        f.Name,
+		Description: f.Description,
+		Include:     include,
+		Where:       f.Where,
+	}, nil
+}
+
+func sortCommandTypes(types []CommandType) {
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+}
+
+// PresetCatalog is a named collection of built-in and user-defined presets
+type PresetCatalog struct {
+	presets []FilterPreset
+}
+
+// NewPresetCatalog creates a catalog; later presets replace earlier ones with the same name
+func NewPresetCatalog(presets ...FilterPreset) *PresetCatalog {
+	catalog := &PresetCatalog{}
+	for _, preset := range presets {
+		catalog.add(preset)
+	}
+	return catalog
+}
+
+// LoadPresetCatalog returns the built-in presets together with the user presets
+// found in dir. User presets replace built-in presets with the same name. The
+// catalog holds every valid preset even when some files fail to load, which the
+// error reports.
+func LoadPresetCatalog(dir string) (*PresetCatalog, error) {
+	userPresets, err := LoadPresetDir(dir)
+	return NewPresetCatalog(append(BuiltinPresets(), userPresets...)...), err
+}
+
+func (c *PresetCatalog) add(preset FilterPreset) {
+	for i := range c.presets {
+		if c.presets[i].Name == preset.Name {
+			c.presets[i] = preset
+			return
+		}
+	}
+	c.presets = append(c.presets, preset)
+}
+
+// List returns all presets in the catalog
+func (c *PresetCatalog) List() []FilterPreset {
+	return append([]FilterPreset(nil), c.presets...)
+}
+
+// Get returns the preset with the given name (case-insensitive)
+func (c *PresetCatalog) Get(name string) (FilterPreset, bool) {
+	for _, preset := range c.presets {
+		if strings.EqualFold(preset.Name, name) {
+			return preset, true
+		}
+	}
+	return FilterPreset{}, false
+}
+
+// Names returns the names of all presets in the catalog
+func (c *PresetCatalog) Names() []string {
+	names := make([]string, 0, len(c.presets))
+	for _, preset := range c.presets {
+		names = append(names, preset.Name)
+	}
+	return names
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePresetFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoadPresetDir(t *testing.T) {
+	dir := t.TempDir()
+	writePresetFile(t, dir, "early.yaml", `
+name: early_army
+description: Units and upgrades in the first five minutes
+include: [build_squad, build_global_upgrade]
+where: time < 5m
+`)
+	writePresetFile(t, dir, "views.json", `[
+		{"name": "fights", "categories": ["combat"], "properties": ["is_economic"]},
+		{"name": "surgie", "where": "player = Surgie"}
+	]`)
+	writePresetFile(t, dir, "notes.txt", "not a preset")
+
+	presets, err := LoadPresetDir(dir)
+	if err != nil {
+		t.Fatalf("LoadPresetDir failed: %v", err)
+	}
+	if len(presets) != 3 {
+		t.Fatalf("expected 3 presets, got %d: %+v", len(presets), presets)
+	}
+
+	catalog := NewPresetCatalog(append(BuiltinPresets(), presets...)...)
+
+	early, ok := catalog.Get("EARLY_ARMY")
+	if !ok {
+		t.Fatalf("expected early_army preset in %v", catalog.Names())
+	}
+	config, err := NewFilterConfig().WithPreset(early)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matches := Query(testReplay(), config.Predicate())
+	if len(matches) != 2 {
+		t.Errorf("expected 2 early army commands, got %d", len(matches))
+	}
+
+	fights, _ := catalog.Get("fights")
+	for _, cmdType := range []CommandType{UseAbility, UseBattlegroupAbility, BuildSquad, CancelProduction} {
+		if !containsCommandType(fights.Include, cmdType) {
+			t.Errorf("expected fights preset to include %s, got %v", cmdType, fights.Include)
+		}
+	}
+	if containsCommandType(fights.Include, AITakeover) {
+		t.Errorf("fights preset should not include %s", AITakeover)
+	}
+
+	surgie, _ := catalog.Get("surgie")
+	config, err = NewFilterConfig().WithPreset(surgie)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matches = Query(testReplay(), config.Predicate())
+	if len(matches) != 3 {
+		t.Errorf("expected all 3 of Surgie's commands, got %d", len(matches))
+	}
+
+	if _, ok := catalog.Get("build"); !ok {
+		t.Errorf("expected built-in presets in catalog")
+	}
+}
+
+func TestLoadPresetDir_Missing(t *testing.T) {
+	presets, err := LoadPresetDir(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(presets) != 0 {
+		t.Errorf("expected no presets and no error for a missing directory, got %v, %v", presets, err)
+	}
+}
+
+func TestLoadPresetFile_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"missing_name.json", `{"include": ["build_squad"]}`, "missing a name"},
+		{"bad_type.json", `{"name": "x", "include": ["build_sqaud"]}`, `unknown command type "build_sqaud"`},
+		{"bad_category.yaml", "name: x\ncategories: [economy]\n", `unknown category "economy"`},
+		{"bad_property.yaml", "name: x\nproperties: [IsFast]\n", `unknown property "IsFast"`},
+		{"bad_where.yaml", "name: x\nwhere: time < soon\n", "invalid time"},
+		{"empty.yaml", "name: x\n", "selects no command types"},
+		{"syntax.json", `{"name": `, "syntax.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePresetFile(t, t.TempDir(), tt.name, tt.content)
+			_, err := LoadPresetFile(path)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error to contain %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestLoadPresetDir_Duplicate(t *testing.T) {
+	dir := t.TempDir()
+	writePresetFile(t, dir, "a.json", `{"name": "mine", "include": ["build_squad"]}`)
+	writePresetFile(t, dir, "b.yaml", "name: mine\ninclude: [use_ability]\n")
+
+	presets, err := LoadPresetDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Errorf("expected duplicate preset error, got %v", err)
+	}
+	if len(presets) != 1 || !containsCommandType(presets[0].Include, BuildSquad) {
+		t.Errorf("expected the first definition to be kept, got %+v", presets)
+	}
+}
+
+func TestLoadPresetCatalog_SkipsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	writePresetFile(t, dir, "a_broken.json", `{"name": `)
+	writePresetFile(t, dir, "b_typo.yaml", "name: typo\ninclude: [build_sqaud]\n")
+	writePresetFile(t, dir, "c_mine.yaml", "name: mine\ninclude: [use_ability]\n")
+
+	catalog, err := LoadPresetCatalog(dir)
+	if err == nil || !strings.Contains(err.Error(), "a_broken.json") || !strings.Contains(err.Error(), "build_sqaud") {
+		t.Errorf("expected both invalid files to be reported, got %v", err)
+	}
+	if _, ok := catalog.Get("mine"); !ok {
+		t.Errorf("expected the valid preset to be loaded, got %v", catalog.Names())
+	}
+	if _, ok := catalog.Get("typo"); ok {
+		t.Error("expected the invalid preset to be skipped")
+	}
+	if _, ok := catalog.Get("build"); !ok {
+		t.Error("expected built-in presets in catalog")
+	}
+}
+
+func containsCommandType(types []CommandType, cmdType CommandType) bool {
+	for _, t := range types {
+		if t == cmdType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Match pairs a parsed command with the player that issued it
+type Match struct {
+	Player  *vault.Player
+	Command *vault.Command
+}
+
+// Name returns the resolved unit or building name of the command, if any
+func (m Match) Name() string {
+	if m.Command.UnitName != nil {
+		return *m.Command.UnitName
+	}
+	if m.Command.BuildingName != nil {
+		return *m.Command.BuildingName
+	}
+	return ""
+}
+
+// Time returns the command timestamp as a duration from the start of the game
+func (m Match) Time() time.Duration {
+	return time.Duration(m.Command.Timestamp) * time.Millisecond
+}
+
+// Predicate decides whether a command is included in a query result
+type Predicate func(Match) bool
+
+// ByType matches commands of any of the given types
+func ByType(types ...CommandType) Predicate {
+	set := make(map[string]bool, len(types))
+	for _, cmdType := range types {
+		set[string(cmdType)] = true
+	}
+	return func(m Match) bool {
+		return set[m.Command.CommandType]
+	}
+}
+
+// ByCategory matches commands whose definition is in any of the given categories
+func ByCategory(categories ...CommandCategory) Predicate {
+	var types []CommandType
+	for _, category := range categories {
+		types = append(types, GetCommandsByCategory(category)...)
+	}
+	return ByType(types...)
+}
+
+// ByProperty matches commands whose definition satisfies the property filter
+func ByProperty(filter func(CommandDefinition) bool) Predicate {
+	return ByType(GetCommandsByProperty(filter)...)
+}
+
+// After matches commands issued at or after the given game time
+func After(t time.Duration) Predicate {
+	return func(m Match) bool {
+		return m.Time() >= t
+	}
+}
+
+// Before matches commands issued strictly before the given game time
+func Before(t time.Duration) Predicate {
+	return func(m Match) bool {
+		return m.Time() < t
+	}
+}
+
+// Between matches commands issued in the half-open window [from, to)
+func Between(from, to time.Duration) Predicate {
+	return And(After(from), Before(to))
+}
+
+// ByPlayerID matches commands issued by any of the given player IDs
+func ByPlayerID(ids ...uint32) Predicate {
+	return func(m Match) bool {
+		for _, id := range ids {
+			if m.Player.PlayerID == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ByPlayer matches commands issued by a player referenced by name
+// (case-insensitive) or by numeric ID
+func ByPlayer(ref string) Predicate {
+	id, idErr := strconv.ParseUint(ref, 10, 32)
+	return func(m Match) bool {
+		if strings.EqualFold(m.Player.PlayerName, ref) {
+			return true
+		}
+		return idErr == nil && m.Player.PlayerID == uint32(id)
+	}
+}
+
+// ByFaction matches commands issued by players of any of the given factions (case-insensitive)
+func ByFaction(factions ...string) Predicate {
+	return func(m Match) bool {
+		if m.Player.Faction == nil {
+			return false
+		}
+		for _, faction := range factions {
+			if strings.EqualFold(*m.Player.Faction, faction) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ByName matches commands whose resolved unit or building name contains the
+// given text (case-insensitive)
+func ByName(text string) Predicate {
+	text = strings.ToLower(text)
+	return func(m Match) bool {
+		name := m.Name()
+		return name != "" && strings.Contains(strings.ToLower(name), text)
+	}
+}
+
+// ByPBGID matches commands referencing any of the given PBGIDs
+func ByPBGID(pbgids ...string) Predicate {
+	return func(m Match) bool {
+		if m.Command.PBGID == nil {
+			return false
+		}
+		for _, pbgid := range pbgids {
+			if *m.Command.PBGID == pbgid {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// And matches commands that satisfy every predicate
+func And(predicates ...Predicate) Predicate {
+	return func(m Match) bool {
+		for _, p := range predicates {
+			if !p(m) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches commands that satisfy at least one predicate
+func Or(predicates ...Predicate) Predicate {
+	return func(m Match) bool {
+		for _, p := range predicates {
+			if p(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not inverts a predicate
+func Not(p Predicate) Predicate {
+	return func(m Match) bool {
+		return !p(m)
+	}
+}
+
+// Query returns every command in the replay matching the predicate, player by player.
+// It searches each player's full command list, so it works regardless of the
+// filter the replay was parsed with.
+func Query(data *vault.ReplayData, p Predicate) []Match {
+	var matches []Match
+	for i := range data.Players {
+		player := &data.Players[i]
+		for j := range player.Commands {
+			m := Match{Player: player, Command: &player.Commands[j]}
+			if p(m) {
+				matches = append(matches, m)
+			}
+		}
+	}
+	return matches
+}
+
+// Apply returns a copy of the replay whose players' BuildCommands hold the
+// commands matching the predicate. The full command lists are left untouched,
+// so the result can be filtered again without re-parsing. Like a parse filter,
+// Apply only selects registered command types: internal kinds such as
+// construct_entity_completion never reach BuildCommands, even when the
+// predicate does not restrict the type.
+func Apply(data *vault.ReplayData, p Predicate) *vault.ReplayData {
+	filtered := *data
+	filtered.Players = make([]vault.Player, len(data.Players))
+	copy(filtered.Players, data.Players)
+
+	for i := range filtered.Players {
+		player := &filtered.Players[i]
+		buildCommands := make([]vault.Command, 0)
+		for j := range player.Commands {
+			if !filterable(player.Commands[j].CommandType) {
+				continue
+			}
+			if p(Match{Player: player, Command: &player.Commands[j]}) {
+				buildCommands = append(buildCommands, player.Commands[j])
+			}
+		}
+		player.BuildCommands = buildCommands
+	}
+
+	return &filtered
+}
+
+// filterable reports whether a command type can be selected with a filter
+func filterable(commandType string) bool {
+	_, exists := CommandDefinitions[CommandType(commandType)]
+	return exists
+}
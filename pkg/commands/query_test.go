@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func strPtr(s string) *string { return &s }
+
+func testReplay() *vault.ReplayData {
+	return &vault.ReplayData{
+		Success: true,
+		Players: []vault.Player{
+			{
+				PlayerID:   0,
+				PlayerName: "Tomsch",
+				Faction:    strPtr("Wehrmacht"),
+				Commands: []vault.Command{
+					{Timestamp: 61000, CommandType: "build_squad", PBGID: strPtr("2071856"), UnitName: strPtr("Grenadier Squad")},
+					{Timestamp: 98000, CommandType: "construct_entity", Index: strPtr("22"), BuildingName: strPtr("Wehrmacht Building (Structure #22)")},
+					{Timestamp: 120000, CommandType: "use_ability", PBGID: strPtr("2090001")},
+					{Timestamp: 420000, CommandType: "build_squad", PBGID: strPtr("198361"), UnitName: strPtr("Panzer IV Medium Tank")},
+				},
+			},
+			{
+				PlayerID:   1,
+				PlayerName: "Surgie",
+				Faction:    strPtr("Americans"),
+				Commands: []vault.Command{
+					{Timestamp: 5000, CommandType: "select_battlegroup", PBGID: strPtr("196934"), UnitName: strPtr("Armored (US)")},
+					{Timestamp: 14000, CommandType: "build_squad", PBGID: strPtr("2069371"), UnitName: strPtr("Engineer Squad")},
+					{Timestamp: 200000, CommandType: "use_battlegroup_ability"},
+				},
+			},
+		},
+	}
+}
+
+func TestQuery(t *testing.T) {
+	data := testReplay()
+
+	tests := []struct {
+		name      string
+		predicate Predicate
+		expected  int
+	}{
+		{"Type", ByType(BuildSquad), 3},
+		{"Category", ByCategory(CategoryCombat), 2},
+		{"Property", ByProperty(func(def CommandDefinition) bool { return def.IsBuildable }), 5},
+		{"Before", Before(time.Minute), 2},
+		{"Between", Between(time.Minute, 2*time.Minute), 2},
+		{"PlayerByName", ByPlayer("tomsch"), 4},
+		{"PlayerByID", ByPlayer("1"), 3},
+		{"Faction", ByFaction("americans"), 3},
+		{"Name", ByName("panzer"), 1},
+		{"PBGID", ByPBGID("196934", "198361"), 2},
+		{"And", And(ByType(BuildSquad), ByPlayerID(0)), 2},
+		{"Or", Or(ByName("engineer"), ByName("grenadier")), 2},
+		{"Not", Not(ByCategory(CategoryBuild)), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := Query(data, tt.predicate)
+			if len(matches) != tt.expected {
+				t.Errorf("expected %d matches, got %d: %+v", tt.expected, len(matches), matches)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	data := testReplay()
+	filtered := Apply(data, And(ByType(BuildSquad), Before(2*time.Minute)))
+
+	if len(filtered.Players[0].BuildCommands) != 1 || len(filtered.Players[1].BuildCommands) != 1 {
+		t.Errorf("unexpected build commands after Apply: %+v", filtered.Players)
+	}
+
+	// The original replay and the full command lists are left untouched
+	if len(data.Players[0].BuildCommands) != 0 {
+		t.Errorf("Apply modified the original replay")
+	}
+	if len(filtered.Players[0].Commands) != 4 {
+		t.Errorf("Apply modified the full command list")
+	}
+}
+
+func TestApply_OnlyFilterableTypes(t *testing.T) {
+	data := testReplay()
+	player := &data.Players[0]
+	player.Commands = append(player.Commands,
+		vault.Command{Timestamp: 130000, CommandType: "construct_entity_completion", Index: strPtr("22")},
+		vault.Command{Timestamp: 140000, CommandType: "unknown"},
+	)
+
+	// Without a type predicate internal kinds are still left out
+	filtered := Apply(data, ByPlayer("Tomsch"))
+	var types []string
+	for _, cmd := range filtered.Players[0].BuildCommands {
+		types = append(types, cmd.CommandType)
+	}
+	want := []string{"build_squad", "construct_entity", "use_ability", "build_squad", "unknown"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("Apply selected %v, want %v", types, want)
+	}
+	if len(filtered.Players[0].Commands) != 6 {
+		t.Errorf("Apply modified the full command list")
+	}
+}
+
+func TestFilterConfigPredicate(t *testing.T) {
+	data := testReplay()
+	config, err := NewFilterConfig().WithPreset(CombatOnlyPreset)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matches := Query(data, config.Predicate())
+	if len(matches) != 2 {
+		t.Errorf("expected 2 combat commands, got %d", len(matches))
+	}
+}
+
+func TestFilterConfigPresetInvalidWhere(t *testing.T) {
+	preset := FilterPreset{Name: "broken", Where: "time <"}
+	_, err := NewFilterConfig().WithPreset(preset)
+	if _, ok := err.(*ExprError); !ok {
+		t.Fatalf("expected *ExprError, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func TestRegistryMatchesParser(t *testing.T) {
+	parserTypes, err := vault.SupportedCommandTypes()
+	if err != nil {
+		t.Fatalf("SupportedCommandTypes: %v", err)
+	}
+
+	var registryTypes []string
+	for _, def := range RegisteredCommands() {
+		registryTypes = append(registryTypes, string(def.Type))
+	}
+
+	sort.Strings(parserTypes)
+	sort.Strings(registryTypes)
+	if len(parserTypes) != len(registryTypes) {
+		t.Fatalf("parser supports %v, registry defines %v", parserTypes, registryTypes)
+	}
+	for i := range parserTypes {
+		if parserTypes[i] != registryTypes[i] {
+			t.Fatalf("parser supports %v, registry defines %v", parserTypes, registryTypes)
+		}
+	}
+}
+
+func TestToVaultFilterCarriesRegisteredTypes(t *testing.T) {
+	filter := NewFilterConfig().WithCategory(CategoryCancel).ToVaultFilter()
+
+	for _, def := range RegisteredCommands() {
+		want := def.Category == CategoryCancel
+		if got := filter.Includes(string(def.Type)); got != want {
+			t.Errorf("Includes(%s) = %v, want %v", def.Type, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// BatchWriter writes the results of a batch parse as they arrive
+type BatchWriter interface {
+	Write(result vault.ParseResult) error
+	// Close flushes any buffered output
+	Close() error
+}
+
+// NewBatchWriter creates a combined writer for many replays. JSON writes one
+// line per replay (JSONL); CSV writes one row per build command with a leading
+// file column, skipping replays that failed to parse.
+func NewBatchWriter(w io.Writer, format Format) (BatchWriter, error) {
+	switch format {
+	case JSON:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(append([]string{"file"}, csvHeader...)); err != nil {
+			return nil, err
+		}
+		return &csvBatchWriter{writer: writer}, nil
+	}
+	return nil, fmt.Errorf("format %q is not supported for batch output; use json or csv", format)
+}
+
+// batchRecord is one line of JSONL batch output
+type batchRecord struct {
+	File   string            `json:"file"`
+	Error  string            `json:"error,omitempty"`
+	Replay *vault.ReplayData `json:"replay,omitempty"`
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) Write(result vault.ParseResult) error {
+	record := batchRecord{File: result.Path, Replay: result.Data}
+	if result.Err != nil {
+		record.Error = result.Err.Error()
+	}
+	return j.encoder.Encode(record)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+type csvBatchWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvBatchWriter) Write(result vault.ParseResult) error {
+	if result.Err != nil || result.Data == nil {
+		return nil
+	}
+	if err := writeCSVRecords(c.writer, result.Data, result.Path); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvBatchWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
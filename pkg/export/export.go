@@ -0,0 +1,226 @@
+// Package export writes parsed build orders in the formats analysts paste
+// into spreadsheets, wikis and chat: text, JSON, CSV, Markdown and YAML.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies an output format
+type Format string
+
+const (
+	Text     Format = "text"
+	JSON     Format = "json"
+	CSV      Format = "csv"
+	Markdown Format = "markdown"
+	YAML     Format = "yaml"
+)
+
+// Formats returns all supported formats
+func Formats() []Format {
+	return []Format{Text, JSON, CSV, Markdown, YAML}
+}
+
+// ParseFormat parses a format name (case-insensitive); "md" and "yml" are accepted as aliases
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "text", "txt":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	case "csv":
+		return CSV, nil
+	case "markdown", "md":
+		return Markdown, nil
+	case "yaml", "yml":
+		return YAML, nil
+	}
+	var names []string
+	for _, format := range Formats() {
+		names = append(names, string(format))
+	}
+	return "", fmt.Errorf("unknown format %q; expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Write writes the build orders of every player in the replay in the given format.
+// JSON and YAML contain the full vault.ReplayData; the other formats contain each
+// player's BuildCommands.
+func Write(w io.Writer, format Format, data *vault.ReplayData) error {
+	switch format {
+	case Text:
+		return WriteText(w, data)
+	case JSON:
+		return WriteJSON(w, data)
+	case CSV:
+		return WriteCSV(w, data)
+	case Markdown:
+		return WriteMarkdown(w, data)
+	case YAML:
+		return WriteYAML(w, data)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// WriteText writes the numbered build order layout used by the CLI
+func WriteText(w io.Writer, data *vault.ReplayData) error {
+	var buf bytes.Buffer
+	for i, player := range data.Players {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "=== Player %d: %s ===\n", player.PlayerID, player.PlayerName)
+		buf.WriteString("Build Order:\n")
+		if len(player.BuildCommands) == 0 {
+			buf.WriteString("  (no commands)\n")
+			continue
+		}
+		for j, cmd := range player.BuildCommands {
+			fmt.Fprintf(&buf, "%3d. [%s] %s: %s\n", j+1, formatTimestamp(cmd.Timestamp), cmd.CommandType, commandName(cmd))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteJSON writes the replay as indented JSON in the vault.ReplayData schema
+func WriteJSON(w io.Writer, data *vault.ReplayData) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// WriteYAML writes the replay as YAML using the same field names and order as WriteJSON
+func WriteYAML(w io.Writer, data *vault.ReplayData) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so decoding it into a node keeps the JSON field names and order
+	var node yaml.Node
+	if err := yaml.Unmarshal(jsonData, &node); err != nil {
+		return err
+	}
+	resetStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// resetStyle switches a node decoded from JSON to block style with plain scalars where possible
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// csvHeader lists the CSV columns, one row per command
+var csvHeader = []string{"player_id", "player_name", "faction", "team_id", "time", "timestamp_ms", "command_type", "name", "pbgid"}
+
+// WriteCSV writes one row per build command with the player, faction, time and resolved name
+func WriteCSV(w io.Writer, data *vault.ReplayData) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	if err := writeCSVRecords(writer, data); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeCSVRecords writes one row per build command, each prefixed with the given columns
+func writeCSVRecords(writer *csv.Writer, data *vault.ReplayData, prefix ...string) error {
+	for _, player := range data.Players {
+		for _, cmd := range player.BuildCommands {
+			record := append(append([]string(nil), prefix...),
+				strconv.FormatUint(uint64(player.PlayerID), 10),
+				player.PlayerName,
+				stringValue(player.Faction),
+				strconv.FormatUint(uint64(player.TeamID), 10),
+				formatTimestamp(cmd.Timestamp),
+				strconv.FormatUint(uint64(cmd.Timestamp), 10),
+				cmd.CommandType,
+				commandName(cmd),
+				stringValue(cmd.PBGID),
+			)
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown writes a heading and a table per player
+func WriteMarkdown(w io.Writer, data *vault.ReplayData) error {
+	var buf bytes.Buffer
+	for i, player := range data.Players {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "## Player %d: %s", player.PlayerID, escapeMarkdown(player.PlayerName))
+		if player.Faction != nil {
+			fmt.Fprintf(&buf, " (%s)", escapeMarkdown(*player.Faction))
+		}
+		buf.WriteString("\n\n")
+		if len(player.BuildCommands) == 0 {
+			buf.WriteString("_No commands._\n")
+			continue
+		}
+		buf.WriteString("| # | Time | Type | Name |\n")
+		buf.WriteString("|--:|------|------|------|\n")
+		for j, cmd := range player.BuildCommands {
+			fmt.Fprintf(&buf, "| %d | %s | %s | %s |\n", j+1, formatTimestamp(cmd.Timestamp),
+				escapeMarkdown(cmd.CommandType), escapeMarkdown(commandName(cmd)))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+
+// escapeMarkdown escapes characters that would break a table cell
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// commandName returns the resolved unit or building name of a command, or its type
+func commandName(cmd vault.Command) string {
+	if cmd.UnitName != nil {
+		return *cmd.UnitName
+	}
+	if cmd.BuildingName != nil {
+		return *cmd.BuildingName
+	}
+	return cmd.CommandType
+}
+
+func formatTimestamp(ms uint32) string {
+	seconds := ms / 1000
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func strPtr(s string) *string { return &s }
+
+func testReplay() *vault.ReplayData {
+	gameVersion := uint16(8369)
+	winningTeam := uint32(1)
+	return &vault.ReplayData{
+		Success:         true,
+		MapName:         "data:scenarios\\multiplayer\\rails_and_sand_4p\\rails_and_sand_4p",
+		MapFilename:     "rails_and_sand_4p",
+		DurationSeconds: 2307,
+		DurationTicks:   18456,
+		GameVersion:     &gameVersion,
+		WinningTeam:     &winningTeam,
+		Teams: []vault.Team{
+			{TeamID: 1, Players: []vault.PlayerInfo{{PlayerID: 0, PlayerName: "Tomsch", Faction: strPtr("Wehrmacht"), IsHuman: true}}},
+			{TeamID: 2, Players: []vault.PlayerInfo{{PlayerID: 1, PlayerName: "Ted 'Seaman' Silk, Jr | II", Faction: strPtr("Americans"), IsHuman: true}}},
+		},
+		Players: []vault.Player{
+			{
+				PlayerID:   0,
+				PlayerName: "Tomsch",
+				TeamID:     1,
+				Faction:    strPtr("Wehrmacht"),
+				IsHuman:    true,
+				BuildCommands: []vault.Command{
+					{Timestamp: 4000, CommandType: "build_squad", Details: "BuildSquad", PBGID: strPtr("2072012"), UnitName: strPtr("Pioneer Squad")},
+					{Timestamp: 61500, CommandType: "construct_entity", Details: "ConstructEntity", PBGID: strPtr("2072360"), BuildingName: strPtr("Infanterie Kompanie")},
+					{Timestamp: 204000, CommandType: "select_battlegroup", Details: "SelectBattlegroup", PBGID: strPtr("2075402")},
+				},
+			},
+			{
+				PlayerID:   1,
+				PlayerName: "Ted 'Seaman' Silk, Jr | II",
+				TeamID:     2,
+				Faction:    strPtr("Americans"),
+				IsHuman:    true,
+				BuildCommands: []vault.Command{
+					{Timestamp: 14000, CommandType: "build_squad", Details: "BuildSquad", PBGID: strPtr("2073200"), UnitName: strPtr("Engineer \"Pioneer\" Squad")},
+				},
+			},
+		},
+		Messages: []vault.GameMessage{},
+	}
+}
+
+func TestWriteGolden(t *testing.T) {
+	extensions := map[Format]string{
+		Text:     "txt",
+		JSON:     "json",
+		CSV:      "csv",
+		Markdown: "md",
+		YAML:     "yaml",
+	}
+
+	for _, format := range Formats() {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, format, testReplay()); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "build_order."+extensions[format])
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s output does not match %s\ngot:\n%s\nwant:\n%s", format, golden, buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{
+		"":         Text,
+		"TEXT":     Text,
+		"json":     JSON,
+		"csv":      CSV,
+		"md":       Markdown,
+		"markdown": Markdown,
+		"yml":      YAML,
+	}
+	for name, want := range tests {
+		got, err := ParseFormat(name)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) succeeded, want error")
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	results := []vault.ParseResult{
+		{Path: "a.rec", Data: testReplay()},
+		{Path: "b.rec", Err: errors.New("not a replay")},
+	}
+
+	var jsonl bytes.Buffer
+	writer, err := NewBatchWriter(&jsonl, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if err := writer.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSONL lines, got %d:\n%s", len(lines), jsonl.String())
+	}
+	if !strings.HasPrefix(lines[0], `{"file":"a.rec","replay":{`) || lines[1] != `{"file":"b.rec","error":"not a replay"}` {
+		t.Errorf("Unexpected JSONL output:\n%s", jsonl.String())
+	}
+
+	var csvOut bytes.Buffer
+	writer, err = NewBatchWriter(&csvOut, CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if err := writer.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(rows) != 5 || !strings.HasPrefix(rows[0], "file,player_id,") || !strings.HasPrefix(rows[1], "a.rec,0,Tomsch,") {
+		t.Errorf("Unexpected CSV output:\n%s", csvOut.String())
+	}
+
+	if _, err := NewBatchWriter(&csvOut, Markdown); err == nil {
+		t.Error("Expected error for markdown batch output")
+	}
+}
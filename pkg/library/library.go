@@ -0,0 +1,482 @@
+// Package library is a persistent local store of parsed replays.
+//
+// Each replay is stored as a JSON file under replays/, and index.json holds the
+// searchable metadata of every replay so listing and searching never reads the
+// replays themselves. The index can always be rebuilt from the replay files.
+//
+// Several processes may share a library, such as the web server and the CLI
+// watching for new replays: writers hold index.lock while they update the
+// index, and every process reloads the index when it changes on disk.
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// LibraryDirEnv overrides the directory the library is stored in
+const LibraryDirEnv = "COH3_LIBRARY_DIR"
+
+// ErrNotFound is returned when a replay is not in the library
+var ErrNotFound = errors.New("replay not found in library")
+
+// Entry describes a stored replay. Entries are what the index holds.
+type Entry struct {
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`       // File name the replay was imported from
+	ContentHash     string        `json:"content_hash"` // SHA-256 of the replay file
+	AddedAt         time.Time     `json:"added_at"`
+	PlayedAt        *time.Time    `json:"played_at,omitempty"` // Nil if the replay timestamp could not be read
+	MatchHistoryID  string        `json:"matchhistory_id,omitempty"`
+	MapName         string        `json:"map_name"`
+	DurationSeconds uint32        `json:"duration_seconds"`
+	GameVersion     uint16        `json:"game_version,omitempty"`
+	GameType        string        `json:"game_type,omitempty"`
+	WinningTeam     *uint32       `json:"winning_team,omitempty"`
+	Players         []EntryPlayer `json:"players"`
+}
+
+// EntryPlayer summarises a player in a stored replay
+type EntryPlayer struct {
+	PlayerID   uint32 `json:"player_id"`
+	PlayerName string `json:"player_name"`
+	TeamID     uint32 `json:"team_id"`
+	Faction    string `json:"faction,omitempty"`
+	ProfileID  string `json:"profile_id,omitempty"`
+	SteamID    string `json:"steam_id,omitempty"`
+}
+
+// Date returns when the game was played, or when it was added if that is unknown
+func (e Entry) Date() time.Time {
+	if e.PlayedAt != nil {
+		return *e.PlayedAt
+	}
+	return e.AddedAt
+}
+
+// record is the on-disk format of a stored replay
+type record struct {
+	Entry  Entry             `json:"entry"`
+	Replay *vault.ReplayData `json:"replay"`
+}
+
+// Library stores one JSON file per replay in a directory plus an index.
+// It is safe for concurrent use, also by several processes.
+type Library struct {
+	dir string
+
+	mu        sync.Mutex
+	entries   map[string]Entry
+	indexMod  time.Time // Modification time and size of index.json when it was
+	indexSize int64     // last loaded or saved, to notice changes by other processes
+}
+
+// Lock timing of the index: writers wait up to lockTimeout for another
+// process's lock, and break locks older than lockStale, which were left
+// behind by a process that crashed
+const (
+	lockTimeout = 10 * time.Second
+	lockStale   = 30 * time.Second
+)
+
+// DefaultDir returns the directory the library is stored in: $COH3_LIBRARY_DIR
+// if set, otherwise coh3-replay-analyser/library in the user config directory
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(LibraryDirEnv); dir != "" {
+		return dir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "coh3-replay-analyser", "library"), nil
+}
+
+// Open opens the library in dir, creating the directory if needed. A missing
+// or unreadable index is rebuilt from the stored replays.
+func Open(dir string) (*Library, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "replays"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create library directory: %w", err)
+	}
+
+	l := &Library{dir: dir}
+	if err := l.loadIndex(); err != nil {
+		if err := l.Reindex(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Dir returns the directory the library is stored in
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Add stores a parsed replay imported from replayPath. Replays are keyed by
+// their match history ID, so the same match imported by several players is
+// stored once, and by the content hash of the file when there is no match ID.
+// If the replay is already stored, the existing entry is returned with added
+// set to false.
+func (l *Library) Add(replayPath string, data *vault.ReplayData) (entry Entry, added bool, err error) {
+	hash, err := hashFile(replayPath)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	entry = newEntry(hash, filepath.Base(replayPath), data)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := l.lockIndex()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer unlock()
+	// Merge replays another process added since the index was loaded
+	if err := l.refresh(); err != nil {
+		return Entry{}, false, err
+	}
+
+	if existing, ok := l.entries[entry.ID]; ok {
+		return existing, false, nil
+	}
+	for _, existing := range l.entries {
+		if existing.ContentHash == hash {
+			return existing, false, nil
+		}
+	}
+
+	if err := writeFileAtomic(l.path(entry.ID), record{Entry: entry, Replay: data}); err != nil {
+		return Entry{}, false, err
+	}
+	l.entries[entry.ID] = entry
+	if err := l.saveIndex(); err != nil {
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// Get returns a stored replay and its entry
+func (l *Library) Get(id string) (Entry, *vault.ReplayData, error) {
+	rec, err := l.read(id)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	return rec.Entry, rec.Replay, nil
+}
+
+// List returns all stored replays, most recently played first
+func (l *Library) List() ([]Entry, error) {
+	return l.Search(Query{})
+}
+
+// Search returns the stored replays matching the query, most recently played first
+func (l *Library) Search(q Query) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.refresh(); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, entry := range l.entries {
+		if q.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Date().Equal(entries[j].Date()) {
+			return entries[i].Date().After(entries[j].Date())
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// Reindex rebuilds the index from the stored replay files
+func (l *Library) Reindex() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := l.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	files, err := os.ReadDir(filepath.Join(l.dir, "replays"))
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]Entry)
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || file.IsDir() || !validID(id) {
+			continue
+		}
+		rec, err := l.read(id)
+		if err != nil {
+			return err
+		}
+		entries[rec.Entry.ID] = rec.Entry
+	}
+
+	l.entries = entries
+	return l.saveIndex()
+}
+
+// refresh reloads the index if another process changed it since it was last
+// loaded or saved; the caller must hold l.mu
+func (l *Library) refresh() error {
+	info, err := os.Stat(l.indexPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(l.indexMod) && info.Size() == l.indexSize {
+		return nil
+	}
+	return l.loadIndex()
+}
+
+// lockIndex takes the lock other processes respect while updating the index
+func (l *Library) lockIndex() (unlock func(), err error) {
+	path := filepath.Join(l.dir, "index.lock")
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock library index: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("library index is locked by another process; remove %s if none is running", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (l *Library) indexPath() string {
+	return filepath.Join(l.dir, "index.json")
+}
+
+// loadIndex reads the index; the caller must hold l.mu unless the library is
+// not shared yet
+func (l *Library) loadIndex() error {
+	info, err := os.Stat(l.indexPath())
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(l.indexPath())
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	l.entries = make(map[string]Entry, len(entries))
+	for _, entry := range entries {
+		l.entries[entry.ID] = entry
+	}
+	l.indexMod, l.indexSize = info.ModTime(), info.Size()
+	return nil
+}
+
+// saveIndex writes the index; the caller must hold l.mu and the index lock
+func (l *Library) saveIndex() error {
+	entries := make([]Entry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	if err := writeFileAtomic(l.indexPath(), entries); err != nil {
+		return err
+	}
+	info, err := os.Stat(l.indexPath())
+	if err != nil {
+		return err
+	}
+	l.indexMod, l.indexSize = info.ModTime(), info.Size()
+	return nil
+}
+
+func newEntry(hash, source string, data *vault.ReplayData) Entry {
+	entry := Entry{
+		ID:              "h-" + hash[:16],
+		Source:          source,
+		ContentHash:     hash,
+		AddedAt:         time.Now().UTC(),
+		MapName:         data.MapName,
+		DurationSeconds: data.DurationSeconds,
+		WinningTeam:     data.WinningTeam,
+	}
+	if data.MatchHistoryID != nil && *data.MatchHistoryID != "" {
+		entry.MatchHistoryID = *data.MatchHistoryID
+		entry.ID = "m-" + sanitizeID(*data.MatchHistoryID)
+	}
+	if data.GameVersion != nil {
+		entry.GameVersion = *data.GameVersion
+	}
+	if data.GameType != nil {
+		entry.GameType = *data.GameType
+	}
+	if data.Timestamp != nil {
+		if playedAt, ok := parseReplayTime(*data.Timestamp); ok {
+			entry.PlayedAt = &playedAt
+		}
+	}
+
+	for _, player := range data.Players {
+		entry.Players = append(entry.Players, EntryPlayer{
+			PlayerID:   player.PlayerID,
+			PlayerName: player.PlayerName,
+			TeamID:     player.TeamID,
+			Faction:    stringValue(player.Faction),
+			ProfileID:  stringValue(player.ProfileID),
+			SteamID:    stringValue(player.SteamID),
+		})
+	}
+	return entry
+}
+
+// replayTimeLayouts are the date formats found in replay headers
+var replayTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"1/2/2006 3:04 PM",
+	"1/2/2006 15:04",
+	"02/01/2006 15:04",
+	"2006/01/02 15:04",
+}
+
+// parseReplayTime parses a replay timestamp in any of the known formats
+func parseReplayTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range replayTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (l *Library) path(id string) string {
+	return filepath.Join(l.dir, "replays", id+".json")
+}
+
+func (l *Library) read(id string) (*record, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(l.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("library entry %s is corrupt: %w", id, err)
+	}
+	return &rec, nil
+}
+
+// writeFileAtomic stores a value as JSON so a crash never leaves a partial file behind
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// validID reports whether id is safe to use as a file name
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeID lowercases s and replaces characters not allowed in IDs
+func sanitizeID(s string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(s) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' {
+			b.WriteRune(c)
+		} else {
+			b.WriteString(strconv.Itoa(int(c)))
+		}
+	}
+	return b.String()
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,239 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func strPtr(s string) *string { return &s }
+
+func testReplay() *vault.ReplayData {
+	return &vault.ReplayData{
+		Success:         true,
+		MapName:         "rails_and_sand_4p",
+		DurationSeconds: 2307,
+		Players: []vault.Player{
+			{PlayerID: 0, PlayerName: "Tomsch", TeamID: 1, Faction: strPtr("Wehrmacht")},
+			{PlayerID: 1, PlayerName: "Surgie", TeamID: 2, Faction: strPtr("Americans")},
+		},
+	}
+}
+
+func writeReplayFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAddDeduplicatesByContent(t *testing.T) {
+	lib, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+
+	entry, added, err := lib.Add(writeReplayFile(t, src, "a.rec", "replay one"), testReplay())
+	if err != nil || !added {
+		t.Fatalf("Add = %v, %v; want added", added, err)
+	}
+	if entry.Source != "a.rec" || len(entry.Players) != 2 || entry.Players[0].Faction != "Wehrmacht" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	// The same file uploaded under another name is stored once
+	again, added, err := lib.Add(writeReplayFile(t, src, "copy.rec", "replay one"), testReplay())
+	if err != nil || added || again.ID != entry.ID {
+		t.Fatalf("Add duplicate = %+v, %v, %v; want existing entry", again, added, err)
+	}
+
+	if _, added, _ := lib.Add(writeReplayFile(t, src, "b.rec", "replay two"), testReplay()); !added {
+		t.Error("Expected a different replay to be added")
+	}
+
+	entries, err := lib.List()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("List = %d entries, %v; want 2", len(entries), err)
+	}
+
+	got, data, err := lib.Get(entry.ID)
+	if err != nil || got.ID != entry.ID || data.MapName != "rails_and_sand_4p" {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+
+	if _, _, err := lib.Get("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get with invalid id = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAddDeduplicatesByMatchHistoryID(t *testing.T) {
+	dir := t.TempDir()
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+
+	// Each teammate's copy of a match is a different file with the same match ID
+	replay := testReplay()
+	replay.MatchHistoryID = strPtr("123456")
+	entry, added, err := lib.Add(writeReplayFile(t, src, "mine.rec", "tomsch's copy"), replay)
+	if err != nil || !added || entry.ID != "m-123456" {
+		t.Fatalf("Add = %+v, %v, %v", entry, added, err)
+	}
+	if _, added, _ := lib.Add(writeReplayFile(t, src, "theirs.rec", "surgie's copy"), replay); added {
+		t.Error("Expected the same match to be stored once")
+	}
+
+	// The index is rebuilt from the stored replays when it is lost
+	if err := os.Remove(filepath.Join(dir, "index.json")); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := reopened.List()
+	if err != nil || len(entries) != 1 || entries[0].ID != "m-123456" {
+		t.Errorf("List after reindex = %+v, %v", entries, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	lib, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+
+	short := testReplay()
+	short.DurationSeconds = 600
+	short.Players[0].ProfileID = strPtr("7001")
+	short.Timestamp = strPtr("2025-06-01 20:00")
+	if _, _, err := lib.Add(writeReplayFile(t, src, "short.rec", "short"), short); err != nil {
+		t.Fatal(err)
+	}
+
+	long := testReplay()
+	long.MapName = "villa_fiore_2p"
+	long.Players[1].Faction = strPtr("British")
+	long.Timestamp = strPtr("2025-06-29 22:49")
+	if _, _, err := lib.Add(writeReplayFile(t, src, "long.rec", "long"), long); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all, newest first", Query{}, []string{"villa_fiore_2p", "rails_and_sand_4p"}},
+		{"profile id", Query{Player: "7001"}, []string{"rails_and_sand_4p"}},
+		{"player name", Query{Player: "surgie"}, []string{"villa_fiore_2p", "rails_and_sand_4p"}},
+		{"faction", Query{Faction: "british"}, []string{"villa_fiore_2p"}},
+		{"map", Query{Map: "rails"}, []string{"rails_and_sand_4p"}},
+		{"text", Query{Text: "ameri"}, []string{"rails_and_sand_4p"}},
+		{"team size", Query{TeamSize: 1}, []string{"villa_fiore_2p", "rails_and_sand_4p"}},
+		{"no 2v2s", Query{TeamSize: 2}, nil},
+		{"min duration", Query{MinDuration: 20 * time.Minute}, []string{"villa_fiore_2p"}},
+		{"date range", Query{Since: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)}, []string{"rails_and_sand_4p"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := lib.Search(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var maps []string
+			for _, entry := range entries {
+				maps = append(maps, entry.MapName)
+			}
+			if !reflect.DeepEqual(maps, tt.want) {
+				t.Errorf("Search(%+v) = %v, want %v", tt.query, maps, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharedBetweenProcesses(t *testing.T) {
+	dir, src := t.TempDir(), t.TempDir()
+	// Two libraries on one directory stand in for two processes, such as the
+	// web server and the CLI watching for replays
+	server, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _, err := watcher.Add(writeReplayFile(t, src, "a.rec", "replay one"), testReplay())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := server.List(); len(entries) != 1 || entries[0].ID != first.ID {
+		t.Fatalf("Other library lists %+v, want the new replay", entries)
+	}
+
+	// Neither writer loses the other's replays, even when adding concurrently
+	var wg sync.WaitGroup
+	for i, lib := range []*Library{server, watcher, server, watcher} {
+		wg.Add(1)
+		go func(i int, lib *Library) {
+			defer wg.Done()
+			name := fmt.Sprintf("game%d.rec", i)
+			if _, _, err := lib.Add(writeReplayFile(t, src, name, "replay "+name), testReplay()); err != nil {
+				t.Error(err)
+			}
+		}(i, lib)
+	}
+	wg.Wait()
+
+	// The server also sees a duplicate the watcher stored
+	if _, added, err := server.Add(writeReplayFile(t, src, "copy.rec", "replay one"), testReplay()); err != nil || added {
+		t.Errorf("Add of a replay stored by the other library = %v, %v; want existing entry", added, err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lib := range []*Library{server, watcher, reopened} {
+		if entries, _ := lib.List(); len(entries) != 5 {
+			t.Errorf("Library lists %d replays, want 5", len(entries))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.lock")); !os.IsNotExist(err) {
+		t.Errorf("Index lock left behind: %v", err)
+	}
+}
+
+func TestStaleIndexLock(t *testing.T) {
+	dir := t.TempDir()
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := filepath.Join(dir, "index.lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, added, err := lib.Add(writeReplayFile(t, t.TempDir(), "a.rec", "replay"), testReplay()); err != nil || !added {
+		t.Errorf("Add with a stale lock = %v, %v; want added", added, err)
+	}
+}
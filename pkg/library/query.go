@@ -0,0 +1,175 @@
+package library
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query selects stored replays. Zero-valued fields match everything.
+type Query struct {
+	Text        string        // Case-insensitive substring of a player name, faction or map
+	Player      string        // Player name (case-insensitive), profile ID or Steam ID
+	Faction     string        // Faction played by any player (case-insensitive)
+	Map         string        // Case-insensitive substring of the map name
+	GameVersion uint16        // Exact game version
+	TeamSize    int           // Players per team, e.g. 2 for 2v2
+	MinDuration time.Duration // Games at least this long
+	MaxDuration time.Duration // Games at most this long
+	Since       time.Time     // Games played at or after this time
+	Until       time.Time     // Games played before this time
+}
+
+// Matches reports whether an entry satisfies the query
+func (q Query) Matches(e Entry) bool {
+	if q.Text != "" && !e.containsText(q.Text) {
+		return false
+	}
+	if q.Player != "" && e.findPlayer(q.Player) == nil {
+		return false
+	}
+	if q.Faction != "" && !e.hasFaction(q.Faction) {
+		return false
+	}
+	if q.Map != "" && !containsFold(e.MapName, q.Map) {
+		return false
+	}
+	if q.GameVersion != 0 && e.GameVersion != q.GameVersion {
+		return false
+	}
+	if q.TeamSize != 0 && e.TeamSize() != q.TeamSize {
+		return false
+	}
+
+	duration := time.Duration(e.DurationSeconds) * time.Second
+	if q.MinDuration > 0 && duration < q.MinDuration {
+		return false
+	}
+	if q.MaxDuration > 0 && duration > q.MaxDuration {
+		return false
+	}
+
+	if !q.Since.IsZero() && e.Date().Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Date().Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// findPlayer finds a player by name (case-insensitive), profile ID or Steam ID
+func (e Entry) findPlayer(ref string) *EntryPlayer {
+	for i := range e.Players {
+		player := &e.Players[i]
+		if strings.EqualFold(player.PlayerName, ref) ||
+			(player.ProfileID != "" && player.ProfileID == ref) ||
+			(player.SteamID != "" && player.SteamID == ref) {
+			return player
+		}
+	}
+	return nil
+}
+
+// TeamSize returns the number of players on the largest team
+func (e Entry) TeamSize() int {
+	sizes := make(map[uint32]int)
+	largest := 0
+	for _, player := range e.Players {
+		sizes[player.TeamID]++
+		if sizes[player.TeamID] > largest {
+			largest = sizes[player.TeamID]
+		}
+	}
+	return largest
+}
+
+func (e Entry) hasFaction(faction string) bool {
+	for _, player := range e.Players {
+		if strings.EqualFold(player.Faction, faction) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Entry) containsText(text string) bool {
+	if containsFold(e.MapName, text) {
+		return true
+	}
+	for _, player := range e.Players {
+		if containsFold(player.PlayerName, text) || containsFold(player.Faction, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// ParseDate parses a YYYY-MM-DD date or an RFC 3339 time
+func ParseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q; expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// QueryFromValues builds a query from URL query parameters: q, player, faction,
+// map, version, team_size (2 or 2v2), min_duration, max_duration (Go durations
+// such as 20m), since and until (YYYY-MM-DD)
+func QueryFromValues(values url.Values) (Query, error) {
+	q := Query{
+		Text:    values.Get("q"),
+		Player:  values.Get("player"),
+		Faction: values.Get("faction"),
+		Map:     values.Get("map"),
+	}
+
+	if v := values.Get("version"); v != "" {
+		version, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid version %q", v)
+		}
+		q.GameVersion = uint16(version)
+	}
+
+	if v := values.Get("team_size"); v != "" {
+		size, err := strconv.Atoi(strings.SplitN(strings.ToLower(v), "v", 2)[0])
+		if err != nil || size < 1 {
+			return Query{}, fmt.Errorf("invalid team_size %q; expected e.g. 2 or 2v2", v)
+		}
+		q.TeamSize = size
+	}
+
+	var err error
+	if v := values.Get("min_duration"); v != "" {
+		if q.MinDuration, err = time.ParseDuration(v); err != nil {
+			return Query{}, fmt.Errorf("invalid min_duration %q", v)
+		}
+	}
+	if v := values.Get("max_duration"); v != "" {
+		if q.MaxDuration, err = time.ParseDuration(v); err != nil {
+			return Query{}, fmt.Errorf("invalid max_duration %q", v)
+		}
+	}
+	if v := values.Get("since"); v != "" {
+		if q.Since, err = ParseDate(v); err != nil {
+			return Query{}, err
+		}
+	}
+	if v := values.Get("until"); v != "" {
+		if q.Until, err = ParseDate(v); err != nil {
+			return Query{}, err
+		}
+	}
+	return q, nil
+}
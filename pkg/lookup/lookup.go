@@ -9,7 +9,8 @@ import (
 	"strings"
 )
 
-// DataResolver handles PBGID to friendly name resolution using coh3-data files
+// DataResolver handles PBGID to friendly name resolution using coh3-data files.
+// It is read-only once created and safe for concurrent use.
 type DataResolver struct {
 	locstrings     map[string]string
 	sbpsData       map[string]interface{}
@@ -0,0 +1,27 @@
+package lookup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DataVersion returns the release tag of the coh3-data files in dataDir, as
+// recorded in metadata.json when the data was downloaded (e.g. "v2.1.1-1")
+func DataVersion(dataDir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dataDir, "metadata.json"))
+	if err != nil {
+		return "", err
+	}
+	var metadata struct {
+		Tag string `json:"tag"`
+	}
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return "", fmt.Errorf("invalid data metadata: %w", err)
+	}
+	if metadata.Tag == "" {
+		return "", fmt.Errorf("data metadata in %s has no tag", dataDir)
+	}
+	return metadata.Tag, nil
+}
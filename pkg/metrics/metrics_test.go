@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests served.", "code")
+	inFlight := r.NewGauge("in_flight", "Requests in flight.")
+	latency := r.NewHistogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "stage")
+
+	requests.Inc("200")
+	requests.Add(2, "500")
+	requests.Inc(`say "hi"`)
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "ffi")
+	latency.Observe(0.1, "ffi")
+	latency.Observe(0.5, "ffi")
+	latency.Observe(7, "ffi")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{code="200"} 1
+requests_total{code="500"} 2
+requests_total{code="say \"hi\""} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{stage="ffi",le="0.1"} 2
+latency_seconds_bucket{stage="ffi",le="1"} 3
+latency_seconds_bucket{stage="ffi",le="+Inf"} 4
+latency_seconds_sum{stage="ffi"} 7.65
+latency_seconds_count{stage="ffi"} 4
+`
+	if buf.String() != want {
+		t.Errorf("WriteText:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" || rec.Body.String() != want {
+		t.Errorf("ServeHTTP = %q: %s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounter("a_total", "A.", "kind")
+	for name, f := range map[string]func(){
+		"duplicate":       func() { r.NewGauge("a_total", "Again.") },
+		"missing label":   func() { counter.Inc() },
+		"negative add":    func() { counter.Add(-1, "x") },
+		"unsorted bucket": func() { r.NewHistogram("b", "B.", []float64{2, 1}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,334 @@
+package milestones
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Milestone identifies a key timing in a player's build order
+type Milestone string
+
+const (
+	FirstUnit               Milestone = "first_unit"
+	FirstBuilding           Milestone = "first_building"
+	FirstTech               Milestone = "first_tech"
+	BattlegroupSelection    Milestone = "battlegroup_selection"
+	FirstVehicle            Milestone = "first_vehicle"
+	FirstBattlegroupAbility Milestone = "first_battlegroup_ability"
+)
+
+// Milestones lists all milestones in display order
+var Milestones = []Milestone{
+	FirstUnit,
+	FirstBuilding,
+	FirstTech,
+	BattlegroupSelection,
+	FirstVehicle,
+	FirstBattlegroupAbility,
+}
+
+var milestoneLabels = map[Milestone]string{
+	FirstUnit:               "First Unit",
+	FirstBuilding:           "First Building",
+	FirstTech:               "First Tech",
+	BattlegroupSelection:    "Battlegroup",
+	FirstVehicle:            "First Vehicle",
+	FirstBattlegroupAbility: "First BG Ability",
+}
+
+// Label returns the human-readable name of a milestone
+func (m Milestone) Label() string {
+	if label, exists := milestoneLabels[m]; exists {
+		return label
+	}
+	return string(m)
+}
+
+// FactionConfig configures milestone detection for a single faction
+type FactionConfig struct {
+	// StartingUnits is the number of build_squad commands at the start of the
+	// game that belong to the opening queue and don't count as the first unit
+	StartingUnits int `json:"starting_units" yaml:"starting_units"`
+	// TechUpgrades lists the build_global_upgrade PBGIDs that count as a tech
+	// unlock (T1/T2), for factions that tech with global upgrades
+	TechUpgrades []uint32 `json:"tech_upgrades" yaml:"tech_upgrades"`
+	// TechBuildings lists the construct_entity PBGIDs of the tier buildings, for
+	// factions that tech by constructing buildings. When neither list is set,
+	// the first tech is not reported, since other global upgrades and buildings
+	// cannot be told apart from tech unlocks.
+	TechBuildings []uint32 `json:"tech_buildings" yaml:"tech_buildings"`
+}
+
+// Config holds per-faction milestone configuration
+type Config struct {
+	Default  FactionConfig            `json:"default" yaml:"default"`
+	Factions map[string]FactionConfig `json:"factions" yaml:"factions"`
+}
+
+// DefaultConfig returns the milestone configuration used for ladder games. The
+// Afrika Korps techs with unit unlock upgrades; the other factions tech by
+// building their tier buildings (see data/coh3-data/building_mappings.json).
+func DefaultConfig() Config {
+	return Config{
+		Factions: map[string]FactionConfig{
+			"afrikakorps": {
+				// T1 and T2 Unit Unlock
+				TechUpgrades: []uint32{2072101, 2072102},
+			},
+			"americans": {
+				// Barracks, Weapon Support Center, Motor Pool and Tank Depot
+				TechBuildings: []uint32{169963, 169964, 169965, 169966},
+			},
+			"british": {
+				// Section, Platoon and Company Command Posts, including the
+				// British Africa variants
+				TechBuildings: []uint32{197605, 197603, 197604, 203800, 203802, 203799},
+			},
+			"wehrmacht": {
+				// Infanterie, Panzergrenadier, Luftwaffe and Panzer Kompanie
+				TechBuildings: []uint32{170266, 170267, 170268, 170269},
+			},
+		},
+	}
+}
+
+// LoadConfig reads a milestone configuration from a JSON or YAML file (by
+// extension) on top of DefaultConfig. A faction listed in the file replaces
+// the default configuration of that faction.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config := DefaultConfig()
+	var file Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !isZero(file.Default) {
+		config.Default = file.Default
+	}
+	for faction, factionConfig := range file.Factions {
+		config.Factions[strings.ToLower(faction)] = factionConfig
+	}
+	return config, nil
+}
+
+func isZero(c FactionConfig) bool {
+	return c.StartingUnits == 0 && len(c.TechUpgrades) == 0 && len(c.TechBuildings) == 0
+}
+
+// ForFaction returns the configuration for a faction, falling back to the default
+func (c Config) ForFaction(faction string) FactionConfig {
+	if factionConfig, exists := c.Factions[strings.ToLower(faction)]; exists {
+		return factionConfig
+	}
+	return c.Default
+}
+
+// Timing records when a milestone was reached and what reached it
+type Timing struct {
+	Timestamp uint32 `json:"timestamp"`
+	Name      string `json:"name"`
+}
+
+// PlayerMilestones holds the milestone timings for a single player
+type PlayerMilestones struct {
+	PlayerID   uint32               `json:"player_id"`
+	PlayerName string               `json:"player_name"`
+	Faction    string               `json:"faction"`
+	Timings    map[Milestone]Timing `json:"timings"`
+}
+
+// Get returns the timing for a milestone and whether it was reached
+func (p PlayerMilestones) Get(m Milestone) (Timing, bool) {
+	timing, exists := p.Timings[m]
+	return timing, exists
+}
+
+// Extractor computes milestone timings from parsed replays
+type Extractor struct {
+	config   Config
+	resolver *lookup.DataResolver
+}
+
+// NewExtractor creates a milestone extractor. The resolver is used to detect
+// vehicles and may be nil, in which case the first vehicle is never reported.
+func NewExtractor(config Config, resolver *lookup.DataResolver) *Extractor {
+	return &Extractor{
+		config:   config,
+		resolver: resolver,
+	}
+}
+
+// Extract returns the milestones for every player in the replay
+func (e *Extractor) Extract(data *vault.ReplayData) []PlayerMilestones {
+	results := make([]PlayerMilestones, 0, len(data.Players))
+	for i := range data.Players {
+		results = append(results, e.ExtractPlayer(&data.Players[i]))
+	}
+	return results
+}
+
+// ExtractPlayer returns the milestones for a single player.
+// All of the player's commands are considered, not just the build commands.
+func (e *Extractor) ExtractPlayer(player *vault.Player) PlayerMilestones {
+	faction := ""
+	if player.Faction != nil {
+		faction = *player.Faction
+	}
+
+	result := PlayerMilestones{
+		PlayerID:   player.PlayerID,
+		PlayerName: player.PlayerName,
+		Faction:    faction,
+		Timings:    make(map[Milestone]Timing),
+	}
+
+	factionConfig := e.config.ForFaction(faction)
+	squadsSeen := 0
+
+	for _, cmd := range player.Commands {
+		switch cmd.CommandType {
+		case "build_squad":
+			squadsSeen++
+			if squadsSeen > factionConfig.StartingUnits {
+				result.record(FirstUnit, cmd)
+			}
+			if e.isVehicle(cmd) {
+				result.record(FirstVehicle, cmd)
+			}
+
+		case "construct_entity":
+			result.record(FirstBuilding, cmd)
+			if hasPBGID(cmd, factionConfig.TechBuildings) {
+				result.record(FirstTech, cmd)
+			}
+
+		case "build_global_upgrade":
+			if hasPBGID(cmd, factionConfig.TechUpgrades) {
+				result.record(FirstTech, cmd)
+			}
+
+		case "select_battlegroup":
+			result.record(BattlegroupSelection, cmd)
+
+		case "use_battlegroup_ability":
+			// Selecting an ability branch does not use it, so select_battlegroup_ability is not counted
+			result.record(FirstBattlegroupAbility, cmd)
+		}
+	}
+
+	return result
+}
+
+// record stores the command as the milestone timing unless an earlier one exists
+func (p *PlayerMilestones) record(m Milestone, cmd vault.Command) {
+	if existing, exists := p.Timings[m]; exists && existing.Timestamp <= cmd.Timestamp {
+		return
+	}
+	p.Timings[m] = Timing{
+		Timestamp: cmd.Timestamp,
+		Name:      commandName(cmd),
+	}
+}
+
+// isVehicle reports whether a build_squad command produces a vehicle
+func (e *Extractor) isVehicle(cmd vault.Command) bool {
+	if e.resolver == nil || cmd.PBGID == nil {
+		return false
+	}
+	pbgid, err := strconv.ParseUint(*cmd.PBGID, 10, 32)
+	if err != nil {
+		return false
+	}
+	unitInfo, err := e.resolver.ResolvePBGID(uint32(pbgid))
+	if err != nil {
+		return false
+	}
+	return unitInfo.Category == "Vehicle"
+}
+
+// hasPBGID reports whether a command references one of the PBGIDs, such as the
+// faction's tech unlocks
+func hasPBGID(cmd vault.Command, pbgids []uint32) bool {
+	if cmd.PBGID == nil {
+		return false
+	}
+	pbgid, err := strconv.ParseUint(*cmd.PBGID, 10, 32)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range pbgids {
+		if uint32(pbgid) == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// commandName returns the resolved name of a command, falling back to its type
+func commandName(cmd vault.Command) string {
+	if cmd.UnitName != nil {
+		return *cmd.UnitName
+	}
+	if cmd.BuildingName != nil {
+		return *cmd.BuildingName
+	}
+	return cmd.CommandType
+}
+
+// WriteTable writes the milestone timings as an aligned table, one row per player
+func WriteTable(w io.Writer, results []PlayerMilestones) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := []string{"ID", "Player", "Faction"}
+	for _, m := range Milestones {
+		header = append(header, m.Label())
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, result := range results {
+		row := []string{
+			strconv.FormatUint(uint64(result.PlayerID), 10),
+			result.PlayerName,
+			result.Faction,
+		}
+		for _, m := range Milestones {
+			if timing, exists := result.Get(m); exists {
+				row = append(row, formatTimestamp(timing.Timestamp))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func formatTimestamp(ms uint32) string {
+	seconds := ms / 1000
+	minutes := seconds / 60
+	seconds = seconds % 60
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}
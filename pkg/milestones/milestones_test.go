@@ -0,0 +1,181 @@
+package milestones
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func strPtr(s string) *string { return &s }
+
+func testPlayer() vault.Player {
+	return vault.Player{
+		PlayerID:   2,
+		PlayerName: "ftw",
+		Faction:    strPtr("AfrikaKorps"),
+		Commands: []vault.Command{
+			{Timestamp: 2000, CommandType: "build_squad", PBGID: strPtr("198355"), UnitName: strPtr("Kradschützen Motorcycle Team")},
+			{Timestamp: 21000, CommandType: "build_squad", PBGID: strPtr("198340"), UnitName: strPtr("Panzergrenadier Squad")},
+			{Timestamp: 50000, CommandType: "build_global_upgrade", PBGID: strPtr("2084214")},
+			{Timestamp: 106000, CommandType: "select_battlegroup", PBGID: strPtr("2164378"), UnitName: strPtr("Unknown Afrika Korps BG")},
+			{Timestamp: 107000, CommandType: "build_global_upgrade", PBGID: strPtr("2072101"), UnitName: strPtr("T1 Unit Unlock (Afrika Korps)")},
+			{Timestamp: 148000, CommandType: "construct_entity", BuildingName: strPtr("AfrikaKorps Building (Structure #45)")},
+			{Timestamp: 300000, CommandType: "use_battlegroup_ability"},
+			{Timestamp: 290000, CommandType: "select_battlegroup_ability"},
+		},
+	}
+}
+
+func TestExtractPlayer(t *testing.T) {
+	player := testPlayer()
+	result := NewExtractor(DefaultConfig(), nil).ExtractPlayer(&player)
+
+	expected := map[Milestone]Timing{
+		FirstUnit:               {Timestamp: 2000, Name: "Kradschützen Motorcycle Team"},
+		FirstBuilding:           {Timestamp: 148000, Name: "AfrikaKorps Building (Structure #45)"},
+		FirstTech:               {Timestamp: 107000, Name: "T1 Unit Unlock (Afrika Korps)"},
+		BattlegroupSelection:    {Timestamp: 106000, Name: "Unknown Afrika Korps BG"},
+		// The ability branch selected at 290000 is not a use
+		FirstBattlegroupAbility: {Timestamp: 300000, Name: "use_battlegroup_ability"},
+	}
+
+	for m, want := range expected {
+		got, exists := result.Get(m)
+		if !exists {
+			t.Errorf("%s: milestone not reached", m)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", m, want, got)
+		}
+	}
+
+	// Without a resolver vehicles cannot be detected
+	if _, exists := result.Get(FirstVehicle); exists {
+		t.Errorf("expected no vehicle milestone without a resolver")
+	}
+}
+
+func TestExtractPlayer_StartingUnits(t *testing.T) {
+	player := testPlayer()
+	config := Config{
+		Factions: map[string]FactionConfig{
+			"afrikakorps": {StartingUnits: 1},
+		},
+	}
+	result := NewExtractor(config, nil).ExtractPlayer(&player)
+
+	got, exists := result.Get(FirstUnit)
+	if !exists || got.Timestamp != 21000 {
+		t.Errorf("expected first unit at 21000 after skipping the starting unit, got %+v", got)
+	}
+
+	// With no tech upgrades configured other global upgrades are not mistaken for tech
+	if got, exists := result.Get(FirstTech); exists {
+		t.Errorf("expected no first tech without configured tech upgrades, got %+v", got)
+	}
+}
+
+func TestExtractPlayer_TechBuildings(t *testing.T) {
+	for _, tt := range []struct {
+		faction string
+		pbgid   string
+	}{
+		{"Americans", "169964"}, // Weapon Support Center
+		{"British", "197603"},   // Platoon Command Post
+		{"Wehrmacht", "170268"}, // Luftwaffe Kompanie
+	} {
+		player := vault.Player{
+			Faction: strPtr(tt.faction),
+			Commands: []vault.Command{
+				{Timestamp: 30000, CommandType: "construct_entity", PBGID: strPtr("1")},
+				{Timestamp: 50000, CommandType: "build_global_upgrade", PBGID: strPtr("2072101")},
+				{Timestamp: 180000, CommandType: "construct_entity", PBGID: strPtr(tt.pbgid), BuildingName: strPtr("Tier Building")},
+			},
+		}
+		result := NewExtractor(DefaultConfig(), nil).ExtractPlayer(&player)
+
+		if got, exists := result.Get(FirstTech); !exists || got != (Timing{Timestamp: 180000, Name: "Tier Building"}) {
+			t.Errorf("%s: expected first tech at the tier building, got %+v", tt.faction, got)
+		}
+		if got, _ := result.Get(FirstBuilding); got.Timestamp != 30000 {
+			t.Errorf("%s: expected first building at 30000, got %+v", tt.faction, got)
+		}
+	}
+}
+
+func TestExtractPlayer_UnconfiguredFaction(t *testing.T) {
+	player := testPlayer()
+	player.Faction = strPtr("Partisans")
+	result := NewExtractor(DefaultConfig(), nil).ExtractPlayer(&player)
+
+	if got, exists := result.Get(FirstTech); exists {
+		t.Errorf("expected no first tech for a faction without tech unlocks, got %+v", got)
+	}
+	if _, exists := result.Get(FirstBuilding); !exists {
+		t.Errorf("expected the other milestones to still be reported")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"milestones.yaml": "factions:\n  Americans:\n    starting_units: 2\n    tech_buildings: [169963]\n",
+		"milestones.json": `{"factions": {"Americans": {"starting_units": 2, "tech_buildings": [169963]}}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// A faction in the file replaces its default; the others are kept
+		americans := config.ForFaction("americans")
+		if americans.StartingUnits != 2 || !reflect.DeepEqual(americans.TechBuildings, []uint32{169963}) {
+			t.Errorf("%s: unexpected americans config %+v", name, americans)
+		}
+		if got := config.ForFaction("AfrikaKorps"); !reflect.DeepEqual(got, DefaultConfig().Factions["afrikakorps"]) {
+			t.Errorf("%s: default afrikakorps config not kept: %+v", name, got)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"factions": [1]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(bad); err == nil || !strings.Contains(err.Error(), "bad.json") {
+		t.Errorf("LoadConfig of an invalid file = %v, want an error naming the file", err)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	data := &vault.ReplayData{Players: []vault.Player{testPlayer()}}
+	results := NewExtractor(DefaultConfig(), nil).Extract(data)
+
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, results); err != nil {
+		t.Fatalf("WriteTable failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[0], "First Unit") {
+		t.Errorf("unexpected header: %s", lines[0])
+	}
+	for _, expected := range []string{"ftw", "AfrikaKorps", "00:02", "02:28", "01:47", "01:46", "05:00", "-"} {
+		if !strings.Contains(lines[1], expected) {
+			t.Errorf("expected row to contain %q: %s", expected, lines[1])
+		}
+	}
+}
@@ -0,0 +1,356 @@
+// Package share keeps uploaded replays so they can be shared by link.
+//
+// Each upload is stored in its own directory holding the original replay file
+// and its parse result. Uploads are addressed by an ID derived from the file's
+// content, so the same replay always gets the same link. Uploads are removed
+// once they are older than the retention period, and the oldest uploads are
+// evicted when the stored replays exceed the size quota.
+package share
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// ShareDirEnv overrides the directory shared uploads are stored in
+const ShareDirEnv = "COH3_SHARE_DIR"
+
+// File names within an upload's directory
+const (
+	uploadFile = "upload.json"
+	replayFile = "replay.json"
+	sourceFile = "replay.rec"
+)
+
+var (
+	// ErrNotFound is returned for unknown or expired uploads
+	ErrNotFound = errors.New("shared replay not found")
+	// ErrTooLarge is returned when a replay exceeds Options.MaxFileSize
+	ErrTooLarge = errors.New("replay exceeds the maximum shared upload size")
+)
+
+// Options configures a Store
+type Options struct {
+	// Retention is how long an upload is kept after it was last uploaded
+	// (0 keeps uploads forever)
+	Retention time.Duration
+	// MaxFileSize is the largest replay file accepted in bytes (0 for no limit)
+	MaxFileSize int64
+	// MaxTotalSize is the quota for all stored replay files in bytes; the
+	// oldest uploads are evicted to stay within it (0 for no limit)
+	MaxTotalSize int64
+}
+
+// Upload describes a shared replay
+type Upload struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"` // File name the replay was uploaded as
+	Size       int64     `json:"size"` // Size of the replay file in bytes
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// Store keeps shared uploads in a directory. It is safe for concurrent use
+// within a process.
+type Store struct {
+	dir  string
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	uploads map[string]Upload
+}
+
+// DefaultDir returns the directory shared uploads are stored in: $COH3_SHARE_DIR
+// if set, otherwise coh3-replay-analyser/shared in the user config directory
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(ShareDirEnv); dir != "" {
+		return dir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "coh3-replay-analyser", "shared"), nil
+}
+
+// Open opens the store in dir, creating the directory if needed, and removes
+// uploads that have expired or exceed the quota
+func Open(dir string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create share directory: %w", err)
+	}
+
+	s := &Store{dir: dir, opts: opts, now: time.Now, uploads: make(map[string]Upload)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validID(entry.Name()) {
+			continue
+		}
+		upload, err := readUpload(filepath.Join(dir, entry.Name(), uploadFile))
+		if err != nil {
+			// An interrupted save leaves an incomplete directory behind
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		s.uploads[upload.ID] = upload
+	}
+
+	if err := s.Prune(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save stores the replay file at replayPath, uploaded as name, together with
+// its parse result. Saving a replay that is already stored keeps its ID and
+// restarts its retention period.
+func (s *Store) Save(replayPath, name string, data *vault.ReplayData) (Upload, error) {
+	info, err := os.Stat(replayPath)
+	if err != nil {
+		return Upload{}, err
+	}
+	if s.opts.MaxFileSize > 0 && info.Size() > s.opts.MaxFileSize {
+		return Upload{}, ErrTooLarge
+	}
+	hash, err := hashFile(replayPath)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	upload := Upload{
+		ID:         hash[:12],
+		Name:       filepath.Base(name),
+		Size:       info.Size(),
+		UploadedAt: s.now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.uploads[upload.ID]; ok {
+		existing.UploadedAt = upload.UploadedAt
+		if err := writeJSON(filepath.Join(s.path(existing.ID), uploadFile), existing); err != nil {
+			return Upload{}, err
+		}
+		s.uploads[existing.ID] = existing
+		return existing, nil
+	}
+
+	// Assemble the upload in a temporary directory so it appears complete or not at all
+	tmp, err := os.MkdirTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return Upload{}, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := copyFile(replayPath, filepath.Join(tmp, sourceFile)); err != nil {
+		return Upload{}, err
+	}
+	if err := writeJSON(filepath.Join(tmp, replayFile), data); err != nil {
+		return Upload{}, err
+	}
+	if err := writeJSON(filepath.Join(tmp, uploadFile), upload); err != nil {
+		return Upload{}, err
+	}
+	if err := os.Rename(tmp, s.path(upload.ID)); err != nil {
+		return Upload{}, err
+	}
+
+	s.uploads[upload.ID] = upload
+	return upload, s.prune(upload.ID)
+}
+
+// Get returns a shared upload and its parse result
+func (s *Store) Get(id string) (Upload, *vault.ReplayData, error) {
+	upload, err := s.lookup(id)
+	if err != nil {
+		return Upload{}, nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.path(id), replayFile))
+	if os.IsNotExist(err) {
+		return Upload{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return Upload{}, nil, err
+	}
+	var data vault.ReplayData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return Upload{}, nil, fmt.Errorf("shared replay %s is corrupt: %w", id, err)
+	}
+	return upload, &data, nil
+}
+
+// OpenReplay opens the original replay file of a shared upload. The caller
+// must close the file.
+func (s *Store) OpenReplay(id string) (*os.File, Upload, error) {
+	upload, err := s.lookup(id)
+	if err != nil {
+		return nil, Upload{}, err
+	}
+	file, err := os.Open(filepath.Join(s.path(id), sourceFile))
+	if os.IsNotExist(err) {
+		return nil, Upload{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Upload{}, err
+	}
+	return file, upload, nil
+}
+
+// Prune removes expired uploads and evicts the oldest uploads until the store
+// is within its quota
+func (s *Store) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prune("")
+}
+
+// prune implements Prune; keep is never evicted for the quota, so a newly saved
+// upload survives. The caller must hold the lock.
+func (s *Store) prune(keep string) error {
+	uploads := make([]Upload, 0, len(s.uploads))
+	var total int64
+	for _, upload := range s.uploads {
+		uploads = append(uploads, upload)
+		total += upload.Size
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if !uploads[i].UploadedAt.Equal(uploads[j].UploadedAt) {
+			return uploads[i].UploadedAt.Before(uploads[j].UploadedAt)
+		}
+		return uploads[i].ID < uploads[j].ID
+	})
+
+	for _, upload := range uploads {
+		expired := s.expired(upload)
+		overQuota := s.opts.MaxTotalSize > 0 && total > s.opts.MaxTotalSize && upload.ID != keep
+		if !expired && !overQuota {
+			continue
+		}
+		if err := os.RemoveAll(s.path(upload.ID)); err != nil {
+			return fmt.Errorf("failed to remove shared replay %s: %w", upload.ID, err)
+		}
+		delete(s.uploads, upload.ID)
+		total -= upload.Size
+	}
+	return nil
+}
+
+// lookup returns the upload with id unless it is unknown or expired
+func (s *Store) lookup(id string) (Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok || s.expired(upload) {
+		return Upload{}, ErrNotFound
+	}
+	return upload, nil
+}
+
+func (s *Store) expired(upload Upload) bool {
+	return s.opts.Retention > 0 && s.now().Sub(upload.UploadedAt) > s.opts.Retention
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func readUpload(path string) (Upload, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Upload{}, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(content, &upload); err != nil {
+		return Upload{}, err
+	}
+	if !validID(upload.ID) {
+		return Upload{}, fmt.Errorf("invalid upload id %q", upload.ID)
+	}
+	return upload, nil
+}
+
+// writeJSON stores a value as JSON via a temporary file so a crash never
+// leaves a partial file behind
+func writeJSON(path string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// validID reports whether id is an upload ID: 12 lowercase hex digits
+func validID(id string) bool {
+	if len(id) != 12 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package share
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func testReplay() *vault.ReplayData {
+	return &vault.ReplayData{
+		Success:         true,
+		MapName:         "rails_and_sand_4p",
+		DurationSeconds: 2307,
+		Players:         []vault.Player{{PlayerID: 0, PlayerName: "Tomsch", TeamID: 1}},
+	}
+}
+
+func writeReplayFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openAt opens a store whose clock is controlled by the returned pointer
+func openAt(t *testing.T, dir string, opts Options) (*Store, *time.Time) {
+	t.Helper()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestSaveAndGet(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := openAt(t, dir, Options{})
+	src := t.TempDir()
+
+	upload, err := s.Save(writeReplayFile(t, src, "temp_123.rec", "replay one"), "Game 1.rec", testReplay())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upload.ID) != 12 || upload.Name != "Game 1.rec" || upload.Size != 10 {
+		t.Errorf("Unexpected upload: %+v", upload)
+	}
+
+	// The same content gets the same ID
+	again, err := s.Save(writeReplayFile(t, src, "other.rec", "replay one"), "copy.rec", testReplay())
+	if err != nil || again.ID != upload.ID || again.Name != "Game 1.rec" {
+		t.Errorf("Save duplicate = %+v, %v; want the existing upload", again, err)
+	}
+
+	got, data, err := s.Get(upload.ID)
+	if err != nil || got.ID != upload.ID || data.MapName != "rails_and_sand_4p" || data.Players[0].PlayerName != "Tomsch" {
+		t.Errorf("Get = %+v, %+v, %v", got, data, err)
+	}
+
+	file, _, err := s.OpenReplay(upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	if string(content) != "replay one" {
+		t.Errorf("OpenReplay content = %q, want the original file", content)
+	}
+
+	// Uploads survive reopening the store
+	reopened, _ := openAt(t, dir, Options{})
+	if _, _, err := reopened.Get(upload.ID); err != nil {
+		t.Errorf("Get after reopening: %v", err)
+	}
+
+	for _, id := range []string{"000000000000", "../shared", ""} {
+		if _, _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s, now := openAt(t, t.TempDir(), Options{Retention: 24 * time.Hour})
+	src := t.TempDir()
+
+	old, _ := s.Save(writeReplayFile(t, src, "a.rec", "replay one"), "a.rec", testReplay())
+	*now = now.Add(20 * time.Hour)
+	recent, _ := s.Save(writeReplayFile(t, src, "b.rec", "replay two"), "b.rec", testReplay())
+	*now = now.Add(5 * time.Hour)
+
+	if _, _, err := s.Get(old.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get expired upload = %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.Get(recent.ID); err != nil {
+		t.Errorf("Get recent upload: %v", err)
+	}
+
+	if err := s.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.path(old.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expired upload was not removed from disk: %v", err)
+	}
+
+	// Uploading a replay again restarts its retention period
+	*now = now.Add(10 * time.Hour)
+	s.Save(writeReplayFile(t, src, "b.rec", "replay two"), "b.rec", testReplay())
+	*now = now.Add(20 * time.Hour)
+	if _, _, err := s.Get(recent.ID); err != nil {
+		t.Errorf("Get re-uploaded replay: %v", err)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	s, now := openAt(t, t.TempDir(), Options{MaxFileSize: 10, MaxTotalSize: 25})
+	src := t.TempDir()
+
+	if _, err := s.Save(writeReplayFile(t, src, "big.rec", "a very large replay"), "big.rec", testReplay()); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Save over MaxFileSize = %v, want ErrTooLarge", err)
+	}
+
+	var ids []string
+	for _, content := range []string{"replay one", "replay two", "replay 3"} {
+		upload, err := s.Save(writeReplayFile(t, src, "r.rec", content), "r.rec", testReplay())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, upload.ID)
+		*now = now.Add(time.Minute)
+	}
+
+	// 28 bytes exceed the quota, so the oldest upload is evicted
+	if _, _, err := s.Get(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get oldest upload = %v, want ErrNotFound", err)
+	}
+	for _, id := range ids[1:] {
+		if _, _, err := s.Get(id); err != nil {
+			t.Errorf("Get %s: %v", id, err)
+		}
+	}
+}
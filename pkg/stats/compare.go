@@ -0,0 +1,95 @@
+package stats
+
+import "github.com/scharissis/coh3-replay-analyser/vault"
+
+// Alignment describes how a command of a compared build order relates to the
+// reference build order
+type Alignment struct {
+	// Common is set when the command appears in the reference build order and,
+	// for the reference itself, in every other build order
+	Common bool
+	// Delta is how much later (positive) or earlier than the matching reference
+	// command the command was issued, in milliseconds; zero for the reference
+	// and for commands that are not common
+	Delta int64
+}
+
+// CompareBuildOrders aligns the build orders (BuildCommands) of players from
+// any number of games against the first player's, the reference. Commands are
+// matched by type and resolved name, in order, using the longest common
+// subsequence, so an extra unit early on does not misalign the rest of the
+// build. The result holds one alignment per build command of each player.
+func CompareBuildOrders(players []*vault.Player) [][]Alignment {
+	result := make([][]Alignment, len(players))
+	if len(players) == 0 {
+		return result
+	}
+
+	reference := players[0].BuildCommands
+	matchedByAll := make([]int, len(reference)) // Number of other players matching each reference command
+	for i, player := range players[1:] {
+		alignments := make([]Alignment, len(player.BuildCommands))
+		for refIndex, index := range matchBuildOrders(reference, player.BuildCommands) {
+			if index < 0 {
+				continue
+			}
+			matchedByAll[refIndex]++
+			alignments[index] = Alignment{
+				Common: true,
+				Delta:  int64(player.BuildCommands[index].Timestamp) - int64(reference[refIndex].Timestamp),
+			}
+		}
+		result[i+1] = alignments
+	}
+
+	result[0] = make([]Alignment, len(reference))
+	for i := range reference {
+		result[0][i].Common = len(players) > 1 && matchedByAll[i] == len(players)-1
+	}
+	return result
+}
+
+// matchBuildOrders returns, for each command of a, the index of the matching
+// command of b in their longest common subsequence, or -1
+func matchBuildOrders(a, b []vault.Command) []int {
+	// lengths[i][j] is the length of the LCS of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case sameBuildStep(a[i], b[j]):
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case sameBuildStep(a[i], b[j]):
+			matches[i] = j
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+// sameBuildStep reports whether two commands build the same thing
+func sameBuildStep(a, b vault.Command) bool {
+	return a.CommandType == b.CommandType && buildName(a) == buildName(b)
+}
@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func TestCompareBuildOrders(t *testing.T) {
+	building := func(ms uint32, name string) vault.Command {
+		return vault.Command{Timestamp: ms, CommandType: "construct_entity", BuildingName: strPtr(name)}
+	}
+	reference := &vault.Player{BuildCommands: []vault.Command{
+		squad(2000, "Grenadier Squad"), squad(30000, "Grenadier Squad"), building(60000, "Kampfgruppe HQ"), squad(90000, "MG 42"),
+	}}
+	// An extra scout early on must not misalign the rest of the build
+	extra := &vault.Player{BuildCommands: []vault.Command{
+		squad(2000, "Grenadier Squad"), squad(10000, "Kettenkrad"), squad(35000, "Grenadier Squad"), building(50000, "Kampfgruppe HQ"), squad(95000, "MG 42"),
+	}}
+	// Skips the MG and builds a different unit instead
+	different := &vault.Player{BuildCommands: []vault.Command{
+		squad(3000, "Grenadier Squad"), squad(28000, "Grenadier Squad"), building(60000, "Kampfgruppe HQ"), squad(80000, "Panzergrenadier Squad"),
+	}}
+
+	got := CompareBuildOrders([]*vault.Player{reference, extra, different})
+	want := [][]Alignment{
+		{{Common: true}, {Common: true}, {Common: true}, {}},
+		{{Common: true}, {}, {Common: true, Delta: 5000}, {Common: true, Delta: -10000}, {Common: true, Delta: 5000}},
+		{{Common: true, Delta: 1000}, {Common: true, Delta: -2000}, {Common: true}, {}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareBuildOrders =\n%v\nwant\n%v", got, want)
+	}
+
+	// A single build order has nothing in common with anything
+	if got := CompareBuildOrders([]*vault.Player{reference}); len(got) != 1 || got[0][0].Common {
+		t.Errorf("Single build order = %v", got)
+	}
+}
@@ -0,0 +1,208 @@
+// Package stats aggregates parsed replays into player profiles and meta reports.
+package stats
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Game is a stored replay together with its library entry
+type Game struct {
+	Entry  library.Entry
+	Replay *vault.ReplayData
+}
+
+// LoadGames loads the library replays matching the query, oldest first
+func LoadGames(lib *library.Library, q library.Query) ([]Game, error) {
+	entries, err := lib.Search(q)
+	if err != nil {
+		return nil, err
+	}
+
+	games := make([]Game, 0, len(entries))
+	for _, entry := range entries {
+		_, replay, err := lib.Get(entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, Game{Entry: entry, Replay: replay})
+	}
+
+	sort.SliceStable(games, func(i, j int) bool {
+		return games[i].Entry.Date().Before(games[j].Entry.Date())
+	})
+	return games, nil
+}
+
+// Outcome is the result of a game for one player or team
+type Outcome int
+
+const (
+	Undecided Outcome = iota // The replay does not record a winner
+	Win
+	Loss
+)
+
+// outcome returns the result of the game for a team
+func (g Game) outcome(teamID uint32) Outcome {
+	if g.Replay.WinningTeam == nil {
+		return Undecided
+	}
+	if *g.Replay.WinningTeam == teamID {
+		return Win
+	}
+	return Loss
+}
+
+// teamFactions returns the sorted factions of a team, joined with "+"
+func (g Game) teamFactions(teamID uint32) string {
+	var factions []string
+	for _, player := range g.Replay.Players {
+		if player.TeamID == teamID {
+			factions = append(factions, factionName(player.Faction))
+		}
+	}
+	sort.Strings(factions)
+	return strings.Join(factions, "+")
+}
+
+// matchup returns the matchup from a team's point of view, e.g. "Wehrmacht vs Americans"
+func (g Game) matchup(teamID uint32) string {
+	opponents := make(map[uint32]bool)
+	for _, player := range g.Replay.Players {
+		if player.TeamID != teamID {
+			opponents[player.TeamID] = true
+		}
+	}
+
+	var opposing []string
+	for team := range opponents {
+		opposing = append(opposing, g.teamFactions(team))
+	}
+	sort.Strings(opposing)
+	return strings.Join(append([]string{g.teamFactions(teamID)}, opposing...), " vs ")
+}
+
+func factionName(faction *string) string {
+	if faction == nil || *faction == "" {
+		return "Unknown"
+	}
+	return *faction
+}
+
+// Record counts games and results for a group such as a faction or map
+type Record struct {
+	Key    string `json:"key"`
+	Games  int    `json:"games"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+}
+
+// Decided reports whether any of the games has a known result. Replays only
+// record a winner when the parser can detect one, which it does not do yet.
+func (r Record) Decided() bool {
+	return r.Wins+r.Losses > 0
+}
+
+// WinRate returns the share of decided games that were won, between 0 and 1.
+// It is 0 when no game was decided; check Decided before showing it.
+func (r Record) WinRate() float64 {
+	if !r.Decided() {
+		return 0
+	}
+	return float64(r.Wins) / float64(r.Wins+r.Losses)
+}
+
+func (r *Record) add(outcome Outcome) {
+	r.Games++
+	switch outcome {
+	case Win:
+		r.Wins++
+	case Loss:
+		r.Losses++
+	}
+}
+
+// recordSet accumulates records by key
+type recordSet map[string]*Record
+
+func (s recordSet) add(key string, outcome Outcome) {
+	record, exists := s[key]
+	if !exists {
+		record = &Record{Key: key}
+		s[key] = record
+	}
+	record.add(outcome)
+}
+
+// sorted returns the records with the most games first
+func (s recordSet) sorted() []Record {
+	records := make([]Record, 0, len(s))
+	for _, record := range s {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Games != records[j].Games {
+			return records[i].Games > records[j].Games
+		}
+		return records[i].Key < records[j].Key
+	})
+	return records
+}
+
+// Count is the number of times something was picked or built
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// countSet accumulates counts by name
+type countSet map[string]int
+
+// top returns up to n counts, most frequent first; n <= 0 returns all
+func (s countSet) top(n int) []Count {
+	counts := make([]Count, 0, len(s))
+	for name, count := range s {
+		counts = append(counts, Count{Name: name, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// Battlegroup returns the name of the first battlegroup a player selected
+func Battlegroup(player *vault.Player) (string, bool) {
+	for _, cmd := range player.Commands {
+		if cmd.CommandType != "select_battlegroup" {
+			continue
+		}
+		if cmd.UnitName != nil {
+			return *cmd.UnitName, true
+		}
+		if cmd.PBGID != nil {
+			return "Battlegroup " + *cmd.PBGID, true
+		}
+	}
+	return "", false
+}
+
+// builtUnits returns the resolved names of the squads a player built
+func builtUnits(player *vault.Player) []string {
+	var units []string
+	for _, cmd := range player.Commands {
+		if cmd.CommandType == "build_squad" && cmd.UnitName != nil {
+			units = append(units, *cmd.UnitName)
+		}
+	}
+	return units
+}
@@ -0,0 +1,342 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// DefaultOpeningLength is the number of build commands that make up an opening
+const DefaultOpeningLength = 4
+
+// MetaOptions configures a meta report
+type MetaOptions struct {
+	OpeningLength int // Build commands per opening; defaults to DefaultOpeningLength
+	TopOpenings   int // Openings listed per matchup and faction; 0 lists all
+	TopUnits      int // Units listed per game version; 0 lists all
+}
+
+// MetaReport aggregates results and picks across many games
+type MetaReport struct {
+	Games        int                 `json:"games"`
+	Factions     []Record            `json:"factions"` // Results per faction over all player games
+	Matchups     []Record            `json:"matchups"` // Results per team composition, from each team's side
+	Battlegroups []BattlegroupRecord `json:"battlegroups"`
+	Openings     []OpeningRecord     `json:"openings"`
+	Units        []UnitUsage         `json:"units"`
+}
+
+// BattlegroupRecord is how often a faction picked a battlegroup and how it fared
+type BattlegroupRecord struct {
+	Faction string `json:"faction"`
+	Record
+	PickRate float64 `json:"pick_rate"` // Share of the faction's player games with this pick
+}
+
+// OpeningRecord is how often a faction opened with the same build commands in a matchup
+type OpeningRecord struct {
+	Matchup string   `json:"matchup"`
+	Faction string   `json:"faction"`
+	Opening []string `json:"opening"`
+	Record
+	Share float64 `json:"share"` // Share of the faction's player games in the matchup
+}
+
+// UnitUsage is how popular a unit was in one game version
+type UnitUsage struct {
+	GameVersion uint16  `json:"game_version"`
+	Unit        string  `json:"unit"`
+	Built       int     `json:"built"` // Squads built in total
+	Games       int     `json:"games"` // Player games in which the unit was built
+	Share       float64 `json:"share"` // Share of the version's player games that built the unit
+}
+
+// BuildMetaReport aggregates faction, matchup, battlegroup, opening and unit
+// statistics over the games
+func BuildMetaReport(games []Game, opts MetaOptions) *MetaReport {
+	if opts.OpeningLength <= 0 {
+		opts.OpeningLength = DefaultOpeningLength
+	}
+
+	report := &MetaReport{Games: len(games)}
+	factions, matchups := recordSet{}, recordSet{}
+	battlegroups := make(map[string]recordSet) // Faction to battlegroup records
+	openings := make(map[[2]string]recordSet)  // Matchup and faction to opening records
+	openingGames := make(map[[2]string]int)
+	units := make(map[uint16]map[string]*UnitUsage)
+	versionGames := make(map[uint16]int)
+
+	for _, game := range games {
+		for team := range game.teams() {
+			matchups.add(game.matchup(team), game.outcome(team))
+		}
+
+		version := game.Entry.GameVersion
+		for i := range game.Replay.Players {
+			player := &game.Replay.Players[i]
+			faction := factionName(player.Faction)
+			outcome := game.outcome(player.TeamID)
+			factions.add(faction, outcome)
+
+			if name, ok := Battlegroup(player); ok {
+				if battlegroups[faction] == nil {
+					battlegroups[faction] = recordSet{}
+				}
+				battlegroups[faction].add(name, outcome)
+			}
+
+			if opening := playerOpening(player, opts.OpeningLength); len(opening) > 0 {
+				key := [2]string{game.matchup(player.TeamID), faction}
+				if openings[key] == nil {
+					openings[key] = recordSet{}
+				}
+				openings[key].add(strings.Join(opening, openingSeparator), outcome)
+				openingGames[key]++
+			}
+
+			versionGames[version]++
+			if units[version] == nil {
+				units[version] = make(map[string]*UnitUsage)
+			}
+			seen := make(map[string]bool)
+			for _, unit := range builtUnits(player) {
+				usage, exists := units[version][unit]
+				if !exists {
+					usage = &UnitUsage{GameVersion: version, Unit: unit}
+					units[version][unit] = usage
+				}
+				usage.Built++
+				if !seen[unit] {
+					seen[unit] = true
+					usage.Games++
+				}
+			}
+		}
+	}
+
+	report.Factions = factions.sorted()
+	report.Matchups = matchups.sorted()
+	factionGames := make(map[string]int)
+	for _, record := range report.Factions {
+		factionGames[record.Key] = record.Games
+	}
+
+	for _, faction := range sortedKeys(battlegroups) {
+		for _, record := range battlegroups[faction].sorted() {
+			report.Battlegroups = append(report.Battlegroups, BattlegroupRecord{
+				Faction:  faction,
+				Record:   record,
+				PickRate: share(record.Games, factionGames[faction]),
+			})
+		}
+	}
+
+	openingKeys := make([][2]string, 0, len(openings))
+	for key := range openings {
+		openingKeys = append(openingKeys, key)
+	}
+	sort.Slice(openingKeys, func(i, j int) bool {
+		if openingKeys[i][0] != openingKeys[j][0] {
+			return openingKeys[i][0] < openingKeys[j][0]
+		}
+		return openingKeys[i][1] < openingKeys[j][1]
+	})
+	for _, key := range openingKeys {
+		records := openings[key].sorted()
+		if opts.TopOpenings > 0 && len(records) > opts.TopOpenings {
+			records = records[:opts.TopOpenings]
+		}
+		for _, record := range records {
+			report.Openings = append(report.Openings, OpeningRecord{
+				Matchup: key[0],
+				Faction: key[1],
+				Opening: strings.Split(record.Key, openingSeparator),
+				Record:  record,
+				Share:   share(record.Games, openingGames[key]),
+			})
+		}
+	}
+
+	versions := make([]uint16, 0, len(units))
+	for version := range units {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	for _, version := range versions {
+		usages := make([]UnitUsage, 0, len(units[version]))
+		for _, usage := range units[version] {
+			usage.Share = share(usage.Games, versionGames[version])
+			usages = append(usages, *usage)
+		}
+		sort.Slice(usages, func(i, j int) bool {
+			if usages[i].Games != usages[j].Games {
+				return usages[i].Games > usages[j].Games
+			}
+			return usages[i].Unit < usages[j].Unit
+		})
+		if opts.TopUnits > 0 && len(usages) > opts.TopUnits {
+			usages = usages[:opts.TopUnits]
+		}
+		report.Units = append(report.Units, usages...)
+	}
+
+	return report
+}
+
+// openingSeparator joins opening steps into a record key and separates them in text output
+const openingSeparator = " > "
+
+// teams returns the IDs of the teams in the game
+func (g Game) teams() map[uint32]bool {
+	teams := make(map[uint32]bool)
+	for _, player := range g.Replay.Players {
+		teams[player.TeamID] = true
+	}
+	return teams
+}
+
+// playerOpening returns the names of a player's first build commands, in order
+func playerOpening(player *vault.Player, length int) []string {
+	var opening []string
+	for _, cmd := range player.Commands {
+		if len(opening) == length {
+			break
+		}
+		switch cmd.CommandType {
+		case "build_squad", "construct_entity", "build_global_upgrade":
+			opening = append(opening, buildName(cmd))
+		}
+	}
+	return opening
+}
+
+// buildName returns the resolved name of a build command, falling back to its type
+func buildName(cmd vault.Command) string {
+	if cmd.UnitName != nil {
+		return *cmd.UnitName
+	}
+	if cmd.BuildingName != nil {
+		return *cmd.BuildingName
+	}
+	if cmd.PBGID != nil {
+		return cmd.CommandType + " " + *cmd.PBGID
+	}
+	return cmd.CommandType
+}
+
+func sortedKeys(m map[string]recordSet) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func share(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
+
+// WriteMetaReport writes a meta report as a text report
+func WriteMetaReport(w io.Writer, report *MetaReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "=== Meta Report (%d games) ===\n", report.Games)
+	writeRecords(tw, "Factions", "Faction", report.Factions)
+	writeRecords(tw, "Matchups", "Matchup", report.Matchups)
+
+	fmt.Fprintln(tw, "\n=== Battlegroups ===")
+	fmt.Fprintln(tw, "Faction\tBattlegroup\tPicks\tPick Rate\tWins\tLosses\tWin Rate")
+	for _, bg := range report.Battlegroups {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.0f%%\t%d\t%d\t%s\n", bg.Faction, bg.Key, bg.Games, 100*bg.PickRate, bg.Wins, bg.Losses, formatWinRate(bg.Record))
+	}
+
+	fmt.Fprintln(tw, "\n=== Openings ===")
+	fmt.Fprintln(tw, "Matchup\tFaction\tGames\tShare\tWin Rate\tOpening")
+	for _, o := range report.Openings {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.0f%%\t%s\t%s\n", o.Matchup, o.Faction, o.Games, 100*o.Share, formatWinRate(o.Record), strings.Join(o.Opening, openingSeparator))
+	}
+
+	fmt.Fprintln(tw, "\n=== Unit Popularity ===")
+	fmt.Fprintln(tw, "Version\tUnit\tBuilt\tGames\tShare")
+	for _, u := range report.Units {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.0f%%\n", formatVersion(u.GameVersion), u.Unit, u.Built, u.Games, 100*u.Share)
+	}
+
+	return tw.Flush()
+}
+
+// metaCSVHeader is shared by all sections of the CSV export so it loads as one sheet
+var metaCSVHeader = []string{"section", "game_version", "matchup", "faction", "name", "games", "wins", "losses", "win_rate", "count", "share"}
+
+// WriteMetaCSV writes a meta report as a single CSV table. The section column
+// names the report a row belongs to: faction, matchup, battlegroup, opening or
+// unit. For battlegroups, share is the pick rate; for units, count is the number
+// of squads built and games the number of player games that built one. The
+// win rate is empty when none of a record's games has a known result.
+func WriteMetaCSV(w io.Writer, report *MetaReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(metaCSVHeader); err != nil {
+		return err
+	}
+
+	// row writes a faction, matchup, battlegroup or opening record; share may be empty
+	row := func(section, matchup, faction, name string, r Record, share string) error {
+		winRate := ""
+		if r.Decided() {
+			winRate = formatRate(r.WinRate())
+		}
+		return writer.Write([]string{section, "", matchup, faction, name,
+			strconv.Itoa(r.Games), strconv.Itoa(r.Wins), strconv.Itoa(r.Losses), winRate, "", share})
+	}
+
+	for _, r := range report.Factions {
+		if err := row("faction", "", r.Key, "", r, ""); err != nil {
+			return err
+		}
+	}
+	for _, r := range report.Matchups {
+		if err := row("matchup", r.Key, "", "", r, ""); err != nil {
+			return err
+		}
+	}
+	for _, bg := range report.Battlegroups {
+		if err := row("battlegroup", "", bg.Faction, bg.Key, bg.Record, formatRate(bg.PickRate)); err != nil {
+			return err
+		}
+	}
+	for _, o := range report.Openings {
+		if err := row("opening", o.Matchup, o.Faction, strings.Join(o.Opening, openingSeparator), o.Record, formatRate(o.Share)); err != nil {
+			return err
+		}
+	}
+	for _, u := range report.Units {
+		if err := writer.Write([]string{"unit", formatVersion(u.GameVersion), "", "", u.Unit,
+			strconv.Itoa(u.Games), "", "", "", strconv.Itoa(u.Built), formatRate(u.Share)}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', 3, 64)
+}
+
+func formatVersion(version uint16) string {
+	if version == 0 {
+		return "unknown"
+	}
+	return strconv.Itoa(int(version))
+}
@@ -0,0 +1,134 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildMetaReport(t *testing.T) {
+	games := testGames()
+	games[2].Entry.GameVersion = 21000
+
+	report := BuildMetaReport(games, MetaOptions{OpeningLength: 2})
+
+	if report.Games != 3 {
+		t.Errorf("Expected 3 games, got %d", report.Games)
+	}
+	if got := report.Factions[0]; got != (Record{Key: "Wehrmacht", Games: 3, Wins: 2, Losses: 1}) {
+		t.Errorf("Unexpected faction record: %+v", got)
+	}
+
+	// Matchups are counted from both sides
+	matchups := make(map[string]Record)
+	for _, r := range report.Matchups {
+		matchups[r.Key] = r
+	}
+	if got := matchups["Americans vs Wehrmacht"]; got.Games != 2 || got.Losses != 2 {
+		t.Errorf("Unexpected Americans vs Wehrmacht record: %+v", got)
+	}
+	if got := matchups["Wehrmacht vs British"]; got.Games != 1 || got.Losses != 1 {
+		t.Errorf("Unexpected Wehrmacht vs British record: %+v", got)
+	}
+
+	if len(report.Battlegroups) != 2 {
+		t.Fatalf("Expected 2 battlegroup records, got %+v", report.Battlegroups)
+	}
+	if bg := report.Battlegroups[0]; bg.Faction != "Wehrmacht" || bg.Key != "Mechanized" || bg.Games != 2 || bg.Wins != 1 || bg.PickRate != 2.0/3 {
+		t.Errorf("Unexpected battlegroup record: %+v", bg)
+	}
+
+	var opening *OpeningRecord
+	for i := range report.Openings {
+		if report.Openings[i].Matchup == "Wehrmacht vs Americans" {
+			opening = &report.Openings[i]
+		}
+	}
+	if opening == nil || !reflect.DeepEqual(opening.Opening, []string{"Grenadier Squad", "Grenadier Squad"}) || opening.Games != 2 || opening.Share != 1 {
+		t.Errorf("Unexpected Wehrmacht vs Americans opening: %+v", opening)
+	}
+
+	// Newest version first; the opponents built nothing but still count as player games
+	if len(report.Units) != 3 {
+		t.Fatalf("Expected 3 unit usages, got %+v", report.Units)
+	}
+	if u := report.Units[0]; u != (UnitUsage{GameVersion: 21000, Unit: "Grenadier Squad", Built: 2, Games: 1, Share: 0.5}) {
+		t.Errorf("Unexpected unit usage: %+v", u)
+	}
+}
+
+func TestWriteMetaCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMetaCSV(&buf, BuildMetaReport(testGames(), MetaOptions{})); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records[0], metaCSVHeader) {
+		t.Errorf("Unexpected header: %v", records[0])
+	}
+
+	sections := make(map[string]int)
+	for _, record := range records[1:] {
+		sections[record[0]]++
+	}
+	want := map[string]int{"faction": 3, "matchup": 4, "battlegroup": 2, "opening": 2, "unit": 2}
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("Unexpected rows per section: %v, want %v", sections, want)
+	}
+	if got := records[1]; !reflect.DeepEqual(got, []string{"faction", "", "", "Wehrmacht", "", "3", "2", "1", "0.667", "", ""}) {
+		t.Errorf("Unexpected faction row: %v", got)
+	}
+}
+
+func TestWriteMetaReportWinRates(t *testing.T) {
+	// Wehrmacht won 2 of 3 games, both with Mechanized and an opening of two Grenadiers against the Americans
+	var out bytes.Buffer
+	if err := WriteMetaReport(&out, BuildMetaReport(testGames(), MetaOptions{OpeningLength: 2})); err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Join(strings.Fields(out.String()), " ")
+	for _, want := range []string{
+		"Wehrmacht 3 2 1 67%",
+		"Wehrmacht Mechanized 2 67% 1 1 50%",
+		"Wehrmacht Luftwaffe 1 33% 1 0 100%",
+		"Wehrmacht vs Americans Wehrmacht 2 100% 100% Grenadier Squad",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Report missing %q:\n%s", want, out.String())
+		}
+	}
+
+	// Without known results the win rates are left out rather than shown as 0%
+	games := testGames()
+	for _, game := range games {
+		game.Replay.WinningTeam = nil
+	}
+	report := BuildMetaReport(games, MetaOptions{})
+	out.Reset()
+	if err := WriteMetaReport(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), " 0%") {
+		t.Errorf("Report shows win rates without decided games:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := WriteMetaCSV(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records[1:] {
+		if record[0] != "unit" && record[8] != "" {
+			t.Errorf("Unexpected win rate without decided games: %v", record)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/milestones"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// ErrPlayerNotFound is returned when no game includes the requested player
+var ErrPlayerNotFound = errors.New("player not found in any replay")
+
+// Profile aggregates a player's results and habits across many replays
+type Profile struct {
+	ProfileID    string             `json:"profile_id,omitempty"`
+	Names        []string           `json:"names"` // Names seen for the player, most recent first
+	Record       Record             `json:"record"`
+	ByFaction    []Record           `json:"by_faction"`
+	ByMap        []Record           `json:"by_map"`
+	ByMatchup    []Record           `json:"by_matchup"`
+	Milestones   []MilestoneAverage `json:"milestones"`
+	Battlegroups []Count            `json:"battlegroups"`
+	Units        []Count            `json:"units"`
+	Trend        []TrendPoint       `json:"trend"`
+}
+
+// MilestoneAverage is the average time a milestone was reached
+type MilestoneAverage struct {
+	Milestone milestones.Milestone `json:"milestone"`
+	Label     string               `json:"label"`
+	Average   uint32               `json:"average"` // Milliseconds from the start of the game
+	Samples   int                  `json:"samples"` // Games in which the milestone was reached
+}
+
+// TrendPoint summarises the games played in one month
+type TrendPoint struct {
+	Period     string             `json:"period"` // YYYY-MM
+	Record     Record             `json:"record"`
+	Milestones []MilestoneAverage `json:"milestones"`
+}
+
+// milestoneSum accumulates the timings of one milestone for averaging
+type milestoneSum struct {
+	total   uint64
+	samples int
+}
+
+// milestoneSums accumulates milestone timings for averaging
+type milestoneSums map[milestones.Milestone]*milestoneSum
+
+func (s milestoneSums) add(result milestones.PlayerMilestones) {
+	for _, m := range milestones.Milestones {
+		timing, ok := result.Get(m)
+		if !ok {
+			continue
+		}
+		sum, exists := s[m]
+		if !exists {
+			sum = &milestoneSum{}
+			s[m] = sum
+		}
+		sum.total += uint64(timing.Timestamp)
+		sum.samples++
+	}
+}
+
+func (s milestoneSums) averages() []MilestoneAverage {
+	var averages []MilestoneAverage
+	for _, m := range milestones.Milestones {
+		if sum, exists := s[m]; exists {
+			averages = append(averages, MilestoneAverage{
+				Milestone: m,
+				Label:     m.Label(),
+				Average:   uint32(sum.total / uint64(sum.samples)),
+				Samples:   sum.samples,
+			})
+		}
+	}
+	return averages
+}
+
+// findPlayer finds a player in a game by profile ID or Steam ID, or by name
+// (case-insensitive) if byName is set
+func findPlayer(game Game, ref string, byName bool) *vault.Player {
+	for i := range game.Replay.Players {
+		player := &game.Replay.Players[i]
+		if (player.ProfileID != nil && *player.ProfileID == ref) ||
+			(player.SteamID != nil && *player.SteamID == ref) ||
+			(byName && strings.EqualFold(player.PlayerName, ref)) {
+			return player
+		}
+	}
+	return nil
+}
+
+// profilePlayer finds the player of a profile in a game: by profile ID when
+// the profile has one, and otherwise by name (case-insensitive)
+func profilePlayer(game Game, profileID, name string) *vault.Player {
+	for i := range game.Replay.Players {
+		player := &game.Replay.Players[i]
+		if profileID != "" {
+			if player.ProfileID != nil && *player.ProfileID == profileID {
+				return player
+			}
+		} else if strings.EqualFold(player.PlayerName, name) {
+			return player
+		}
+	}
+	return nil
+}
+
+// resolvePlayer finds the most recent game appearance of a player reference,
+// preferring profile and Steam IDs over names. Profiles are keyed by that
+// appearance's profile ID, so a player is still found after changing their name.
+func resolvePlayer(games []Game, ref string) *vault.Player {
+	for _, byName := range []bool{false, true} {
+		for i := len(games) - 1; i >= 0; i-- {
+			if player := findPlayer(games[i], ref, byName); player != nil {
+				return player
+			}
+		}
+	}
+	return nil
+}
+
+// BuildProfile aggregates the games of the player referenced by profile ID,
+// Steam ID or name. Games must be ordered oldest first (see LoadGames). The
+// extractor computes milestone timings.
+func BuildProfile(games []Game, ref string, extractor *milestones.Extractor) (*Profile, error) {
+	latest := resolvePlayer(games, ref)
+	if latest == nil {
+		return nil, fmt.Errorf("%s: %w", ref, ErrPlayerNotFound)
+	}
+
+	// Players without a profile ID are matched by name
+	key := latest.PlayerName
+	profile := &Profile{}
+	if latest.ProfileID != nil && *latest.ProfileID != "" {
+		key = *latest.ProfileID
+		profile.ProfileID = key
+	}
+	profile.Record.Key = key
+	find := func(game Game) *vault.Player {
+		return profilePlayer(game, profile.ProfileID, latest.PlayerName)
+	}
+
+	byFaction, byMap, byMatchup := recordSet{}, recordSet{}, recordSet{}
+	battlegroups, units := countSet{}, countSet{}
+	overall := milestoneSums{}
+	seenNames := make(map[string]bool)
+
+	var (
+		period       string
+		periodRecord Record
+		periodSums   milestoneSums
+	)
+	flushPeriod := func() {
+		if period != "" {
+			profile.Trend = append(profile.Trend, TrendPoint{Period: period, Record: periodRecord, Milestones: periodSums.averages()})
+		}
+	}
+
+	for i := len(games) - 1; i >= 0; i-- {
+		if player := find(games[i]); player != nil && !seenNames[player.PlayerName] {
+			seenNames[player.PlayerName] = true
+			profile.Names = append(profile.Names, player.PlayerName)
+		}
+	}
+
+	for _, game := range games {
+		player := find(game)
+		if player == nil {
+			continue
+		}
+		outcome := game.outcome(player.TeamID)
+		result := extractor.ExtractPlayer(player)
+
+		profile.Record.add(outcome)
+		byFaction.add(factionName(player.Faction), outcome)
+		byMap.add(game.Replay.MapName, outcome)
+		byMatchup.add(game.matchup(player.TeamID), outcome)
+		overall.add(result)
+
+		if name, ok := Battlegroup(player); ok {
+			battlegroups[name]++
+		}
+		for _, unit := range builtUnits(player) {
+			units[unit]++
+		}
+
+		if month := game.Entry.Date().Format("2006-01"); month != period {
+			flushPeriod()
+			period, periodRecord, periodSums = month, Record{Key: month}, milestoneSums{}
+		}
+		periodRecord.add(outcome)
+		periodSums.add(result)
+	}
+	flushPeriod()
+
+	profile.ByFaction = byFaction.sorted()
+	profile.ByMap = byMap.sorted()
+	profile.ByMatchup = byMatchup.sorted()
+	profile.Milestones = overall.averages()
+	profile.Battlegroups = battlegroups.top(0)
+	profile.Units = units.top(10)
+	return profile, nil
+}
+
+// WriteProfile writes a profile as a text report
+func WriteProfile(w io.Writer, p *Profile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "=== Player Profile: %s ===\n", strings.Join(p.Names, " / "))
+	if p.ProfileID != "" {
+		fmt.Fprintf(tw, "Profile ID: %s\n", p.ProfileID)
+	}
+	fmt.Fprintf(tw, "Games: %d (%d wins, %d losses, %s win rate)\n", p.Record.Games, p.Record.Wins, p.Record.Losses, formatWinRate(p.Record))
+
+	writeRecords(tw, "By Faction", "Faction", p.ByFaction)
+	writeRecords(tw, "By Map", "Map", p.ByMap)
+	writeRecords(tw, "By Matchup", "Matchup", p.ByMatchup)
+
+	fmt.Fprintln(tw, "\n=== Average Milestones ===")
+	fmt.Fprintln(tw, "Milestone\tAverage\tGames")
+	for _, m := range p.Milestones {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", m.Label, formatTimestamp(m.Average), m.Samples)
+	}
+
+	writeCounts(tw, "Favourite Battlegroups", "Battlegroup", p.Battlegroups)
+	writeCounts(tw, "Most Built Units", "Unit", p.Units)
+
+	fmt.Fprintln(tw, "\n=== Trend ===")
+	fmt.Fprint(tw, "Month\tGames\tWin Rate")
+	for _, m := range milestones.Milestones {
+		fmt.Fprintf(tw, "\t%s", m.Label())
+	}
+	fmt.Fprintln(tw)
+	for _, point := range p.Trend {
+		fmt.Fprintf(tw, "%s\t%d\t%s", point.Period, point.Record.Games, winRateBar(point.Record))
+		for _, m := range milestones.Milestones {
+			fmt.Fprintf(tw, "\t%s", averageFor(point.Milestones, m))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+func writeRecords(w io.Writer, title, keyLabel string, records []Record) {
+	fmt.Fprintf(w, "\n=== %s ===\n", title)
+	fmt.Fprintf(w, "%s\tGames\tWins\tLosses\tWin Rate\n", keyLabel)
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", r.Key, r.Games, r.Wins, r.Losses, formatWinRate(r))
+	}
+}
+
+func writeCounts(w io.Writer, title, nameLabel string, counts []Count) {
+	fmt.Fprintf(w, "\n=== %s ===\n", title)
+	fmt.Fprintf(w, "%s\tCount\n", nameLabel)
+	for _, c := range counts {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Count)
+	}
+}
+
+// formatWinRate renders a win rate as a percentage, or "-" when no game was decided
+func formatWinRate(r Record) string {
+	if !r.Decided() {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*r.WinRate())
+}
+
+// winRateBar renders a win rate as a percentage and a ten-step bar
+func winRateBar(r Record) string {
+	if !r.Decided() {
+		return "-"
+	}
+	filled := int(r.WinRate()*10 + 0.5)
+	return fmt.Sprintf("%3.0f%% %s%s", 100*r.WinRate(), strings.Repeat("█", filled), strings.Repeat("░", 10-filled))
+}
+
+func averageFor(averages []MilestoneAverage, m milestones.Milestone) string {
+	for _, average := range averages {
+		if average.Milestone == m {
+			return formatTimestamp(average.Average)
+		}
+	}
+	return "-"
+}
+
+func formatTimestamp(ms uint32) string {
+	seconds := ms / 1000
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
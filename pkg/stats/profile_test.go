@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/library"
+	"github.com/scharissis/coh3-replay-analyser/pkg/milestones"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+func strPtr(s string) *string { return &s }
+
+func u32Ptr(n uint32) *uint32 { return &n }
+
+// testGame builds a 1v1 between a Wehrmacht player (profile 111) and an opponent
+func testGame(played string, name, opponentFaction, mapName string, winner uint32, commands ...vault.Command) Game {
+	playedAt, _ := time.Parse("2006-01-02", played)
+	return Game{
+		Entry: library.Entry{ID: "m-" + played + "-" + mapName, PlayedAt: &playedAt},
+		Replay: &vault.ReplayData{
+			MapName:     mapName,
+			WinningTeam: u32Ptr(winner),
+			Players: []vault.Player{
+				{PlayerID: 0, PlayerName: name, TeamID: 1, Faction: strPtr("Wehrmacht"), ProfileID: strPtr("111"), Commands: commands},
+				{PlayerID: 1, PlayerName: "Opponent", TeamID: 2, Faction: strPtr(opponentFaction), ProfileID: strPtr("222")},
+			},
+		},
+	}
+}
+
+func squad(ms uint32, name string) vault.Command {
+	return vault.Command{Timestamp: ms, CommandType: "build_squad", UnitName: strPtr(name)}
+}
+
+func selectBattlegroup(ms uint32, name string) vault.Command {
+	return vault.Command{Timestamp: ms, CommandType: "select_battlegroup", UnitName: strPtr(name)}
+}
+
+func testGames() []Game {
+	return []Game{
+		testGame("2025-05-03", "OldName", "Americans", "rails_and_sand", 1,
+			squad(2000, "Grenadier Squad"), squad(60000, "Grenadier Squad"), selectBattlegroup(100000, "Mechanized")),
+		testGame("2025-05-20", "OldName", "British", "rails_and_sand", 2,
+			squad(2000, "Grenadier Squad"), squad(80000, "Panzergrenadier Squad"), selectBattlegroup(140000, "Mechanized")),
+		testGame("2025-06-01", "Tomsch", "Americans", "twin_beaches", 1,
+			squad(2000, "Grenadier Squad"), squad(40000, "Grenadier Squad"), selectBattlegroup(120000, "Luftwaffe")),
+	}
+}
+
+func TestBuildProfile(t *testing.T) {
+	extractor := milestones.NewExtractor(milestones.DefaultConfig(), nil)
+
+	// The current name, the old name and the profile ID all find the same player
+	for _, ref := range []string{"tomsch", "OldName", "111"} {
+		profile, err := BuildProfile(testGames(), ref, extractor)
+		if err != nil {
+			t.Fatalf("%s: %v", ref, err)
+		}
+
+		if profile.ProfileID != "111" || strings.Join(profile.Names, ",") != "Tomsch,OldName" {
+			t.Errorf("%s: unexpected identity %q %v", ref, profile.ProfileID, profile.Names)
+		}
+		if r := profile.Record; r.Games != 3 || r.Wins != 2 || r.Losses != 1 {
+			t.Errorf("%s: unexpected record %+v", ref, r)
+		}
+	}
+
+	profile, _ := BuildProfile(testGames(), "Tomsch", extractor)
+
+	if got := profile.ByMap; len(got) != 2 || got[0] != (Record{Key: "rails_and_sand", Games: 2, Wins: 1, Losses: 1}) {
+		t.Errorf("Unexpected map records: %+v", got)
+	}
+	if got := profile.ByMatchup; len(got) != 2 || got[0] != (Record{Key: "Wehrmacht vs Americans", Games: 2, Wins: 2}) {
+		t.Errorf("Unexpected matchup records: %+v", got)
+	}
+	if got := profile.Battlegroups; len(got) != 2 || got[0] != (Count{Name: "Mechanized", Count: 2}) {
+		t.Errorf("Unexpected battlegroups: %+v", got)
+	}
+	if got := profile.Units; len(got) != 2 || got[0] != (Count{Name: "Grenadier Squad", Count: 5}) {
+		t.Errorf("Unexpected units: %+v", got)
+	}
+
+	// Battlegroups were selected at 1:40, 2:20 and 2:00
+	var selection *MilestoneAverage
+	for i := range profile.Milestones {
+		if profile.Milestones[i].Milestone == milestones.BattlegroupSelection {
+			selection = &profile.Milestones[i]
+		}
+	}
+	if selection == nil || selection.Average != 120000 || selection.Samples != 3 {
+		t.Errorf("Unexpected battlegroup selection average: %+v", selection)
+	}
+
+	if len(profile.Trend) != 2 || profile.Trend[0].Period != "2025-05" || profile.Trend[0].Record.Games != 2 || profile.Trend[1].Period != "2025-06" {
+		t.Errorf("Unexpected trend: %+v", profile.Trend)
+	}
+
+	var out bytes.Buffer
+	if err := WriteProfile(&out, profile); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"=== Player Profile: Tomsch / OldName ===", "Games: 3 (2 wins, 1 losses, 67% win rate)", "Wehrmacht vs British", "2025-06"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBuildProfileMatchesByProfileID(t *testing.T) {
+	games := testGames()
+	// Another player named Tomsch, and one named like the profile ID
+	impostor := testGame("2025-06-10", "tomsch", "British", "twin_beaches", 2)
+	impostor.Replay.Players[0].ProfileID = strPtr("333")
+	numeric := testGame("2025-06-11", "Someone", "British", "twin_beaches", 2)
+	numeric.Replay.Players[0].ProfileID = strPtr("444")
+	numeric.Replay.Players[1].PlayerName = "111"
+	games = append(games, impostor, numeric)
+
+	profile, err := BuildProfile(games, "111", milestones.NewExtractor(milestones.DefaultConfig(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := profile.Record; r.Games != 3 || r.Wins != 2 || r.Losses != 1 {
+		t.Errorf("Unexpected record %+v, want only the games of profile 111", r)
+	}
+	if strings.Join(profile.Names, ",") != "Tomsch,OldName" {
+		t.Errorf("Unexpected names %v", profile.Names)
+	}
+
+	// Without profile IDs players are matched by name
+	for _, game := range games {
+		for i := range game.Replay.Players {
+			game.Replay.Players[i].ProfileID = nil
+		}
+	}
+	profile, err = BuildProfile(games, "Tomsch", milestones.NewExtractor(milestones.DefaultConfig(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ProfileID != "" || profile.Record.Games != 2 {
+		t.Errorf("Unexpected name-matched profile %q with %+v", profile.ProfileID, profile.Record)
+	}
+}
+
+func TestWriteProfileUndecidedGames(t *testing.T) {
+	games := testGames()
+	for _, game := range games {
+		game.Replay.WinningTeam = nil
+	}
+	profile, err := BuildProfile(games, "Tomsch", milestones.NewExtractor(milestones.DefaultConfig(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := WriteProfile(&out, profile); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "0%") {
+		t.Errorf("Report shows a win rate without decided games:\n%s", out.String())
+	}
+	for _, want := range []string{"Games: 3 (0 wins, 0 losses, - win rate)", "Wehrmacht\t3\t0\t0\t-"} {
+		if !strings.Contains(strings.Join(strings.Fields(out.String()), "\t"), strings.Join(strings.Fields(want), "\t")) {
+			t.Errorf("Report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBuildProfileUnknownPlayer(t *testing.T) {
+	_, err := BuildProfile(testGames(), "nobody", milestones.NewExtractor(milestones.DefaultConfig(), nil))
+	if !errors.Is(err, ErrPlayerNotFound) {
+		t.Errorf("Expected ErrPlayerNotFound, got %v", err)
+	}
+}
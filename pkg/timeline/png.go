@@ -0,0 +1,69 @@
+package timeline
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// WritePNG writes the timeline as a PNG image. The bitmap font only covers
+// ASCII, so command icons are left out and other characters are replaced.
+func WritePNG(w io.Writer, data *vault.ReplayData, opts Options) error {
+	l, err := newLayout(data, opts)
+	if err != nil {
+		return err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	fillRect(img, 0, 0, l.width, l.height, background)
+	drawText(img, margin, margin+16, textColor, l.title)
+
+	for _, h := range l.headers {
+		fillRect(img, h.x, h.y, h.w, h.h, h.color)
+		drawText(img, h.x+cellPadding, h.y+15, "#ffffff", h.name)
+		drawText(img, h.x+cellPadding, h.y+29, "#ffffff", h.faction)
+	}
+	for _, r := range l.rows {
+		fillRect(img, margin, r.y-1, l.width-2*margin, 1, gridColor)
+		drawText(img, margin, r.y+13, mutedColor, r.label)
+	}
+	for _, c := range l.cells {
+		fillRect(img, c.x, c.y, c.w, c.h, c.fill)
+		fillRect(img, c.x, c.y, 3, c.h, c.color)
+		drawText(img, c.x+cellPadding+2, c.y+13, textColor, c.text)
+	}
+
+	return png.Encode(w, img)
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, hex string) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), image.NewUniform(parseColor(hex)), image.Point{}, draw.Src)
+}
+
+// drawText draws text with its baseline at y
+func drawText(img *image.RGBA, x, y int, hex, text string) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(parseColor(hex)),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(asciiReplacer.Replace(text))
+}
+
+var asciiReplacer = strings.NewReplacer("…", "...", "·", "-", "–", "-")
+
+// parseColor parses a #rrggbb color
+func parseColor(hex string) color.RGBA {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
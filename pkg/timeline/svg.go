@@ -0,0 +1,50 @@
+package timeline
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// WriteSVG writes the timeline as a standalone SVG document
+func WriteSVG(w io.Writer, data *vault.ReplayData, opts Options) error {
+	l, err := newLayout(data, opts)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Segoe UI, Tahoma, Geneva, Verdana, sans-serif" font-size="12">`+"\n",
+		l.width, l.height, l.width, l.height)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`+"\n", l.width, l.height, background)
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" font-size="16" font-weight="bold" fill="%s">%s</text>`+"\n",
+		margin, margin+18, textColor, escape(l.title))
+
+	for _, h := range l.headers {
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="%s"/>`+"\n", h.x, h.y, h.w, h.h, h.color)
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" font-weight="bold" fill="#ffffff">%s</text>`+"\n", h.x+cellPadding, h.y+15, escape(h.name))
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" font-size="11" fill="#ffffff">%s</text>`+"\n", h.x+cellPadding, h.y+29, escape(h.faction))
+	}
+	for _, r := range l.rows {
+		fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>`+"\n", margin, r.y-1, l.width-margin, r.y-1, gridColor)
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n", margin, r.y+13, mutedColor, r.label)
+	}
+	for _, c := range l.cells {
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", c.x, c.y, c.w, c.h, c.fill)
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="3" height="%d" fill="%s"/>`+"\n", c.x, c.y, c.h, c.color)
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" fill="%s">%s %s</text>`+"\n", c.x+cellPadding+2, c.y+13, textColor, escape(c.icon), escape(c.text))
+	}
+	buf.WriteString("</svg>\n")
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func escape(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
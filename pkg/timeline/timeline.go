@@ -0,0 +1,215 @@
+// Package timeline renders multi-player build order timelines as SVG and PNG
+// images, for embedding build orders in forum posts, chat messages and slides.
+package timeline
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/commands"
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+// Colors are the colors of players, in player order, as in the web interface
+var Colors = []string{
+	"#e74c3c", "#3498db", "#2ecc71", "#f39c12",
+	"#9b59b6", "#1abc9c", "#e67e22", "#95a5a6",
+}
+
+// Options selects what a timeline shows. The commands drawn are each player's
+// BuildCommands, so filter presets and expressions are applied beforehand.
+type Options struct {
+	Title   string        // Heading above the timeline; the map and game length when empty
+	Players []string      // Player names (case-insensitive) or IDs to show; all players when empty
+	From    time.Duration // Start of the time range shown
+	To      time.Duration // End of the time range shown (exclusive); the end of the game when zero
+}
+
+// Layout dimensions in pixels
+const (
+	margin       = 12
+	titleHeight  = 28
+	headerHeight = 36
+	gutterWidth  = 52
+	columnWidth  = 260
+	columnGap    = 6
+	rowHeight    = 20
+	cellPadding  = 6
+	maxTextRunes = 36
+)
+
+// Fill colors of commands by category, matching the web timeline
+var categoryFills = map[commands.CommandCategory]string{
+	commands.CategoryCombat:  "#fff7ed",
+	commands.CategoryCancel:  "#f4f4f4",
+	commands.CategoryControl: "#eef4ff",
+	commands.CategoryOther:   "#eef4ff",
+}
+
+const (
+	background = "#ffffff"
+	textColor  = "#333333"
+	mutedColor = "#777777"
+	cellFill   = "#f8f9fa"
+	gridColor  = "#e9ecef"
+)
+
+// layout is a timeline positioned on the canvas, drawn the same way by the SVG and PNG writers
+type layout struct {
+	width, height int
+	title         string
+	headers       []header
+	rows          []row
+	cells         []cell
+}
+
+type header struct {
+	x, y, w, h    int
+	color         string
+	name, faction string
+}
+
+// row is a game time shared by every player's commands issued in that second
+type row struct {
+	y, h  int
+	label string
+}
+
+type cell struct {
+	x, y, w, h int
+	color      string // Player color, drawn as a bar on the left edge
+	fill       string
+	icon, text string
+}
+
+// newLayout selects the players and commands to draw and positions them. Rows
+// are shared by all players so that commands issued at the same time line up.
+func newLayout(data *vault.ReplayData, opts Options) (*layout, error) {
+	players, err := selectPlayers(data, opts.Players)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &layout{title: opts.Title}
+	if l.title == "" {
+		l.title = data.MapFilename + " · " + formatTime(time.Duration(data.DurationSeconds)*time.Second)
+	}
+	if opts.From > 0 || opts.To > 0 {
+		l.title += " (" + formatTime(opts.From) + "–"
+		if opts.To > 0 {
+			l.title += formatTime(opts.To)
+		}
+		l.title += ")"
+	}
+
+	type event struct {
+		column int
+		cmd    vault.Command
+	}
+	var events []event
+	top := margin + titleHeight
+	for column, i := range players {
+		player := data.Players[i]
+		faction := "Unknown"
+		if player.Faction != nil {
+			faction = *player.Faction
+		}
+		l.headers = append(l.headers, header{
+			x: columnX(column), y: top, w: columnWidth, h: headerHeight,
+			color: Colors[i%len(Colors)], name: player.PlayerName, faction: faction,
+		})
+		for _, cmd := range player.BuildCommands {
+			t := time.Duration(cmd.Timestamp) * time.Millisecond
+			if t < opts.From || (opts.To > 0 && t >= opts.To) {
+				continue
+			}
+			events = append(events, event{column, cmd})
+		}
+	}
+	sort.SliceStable(events, func(a, b int) bool {
+		return events[a].cmd.Timestamp/1000 < events[b].cmd.Timestamp/1000
+	})
+
+	y := top + headerHeight + columnGap
+	for start := 0; start < len(events); {
+		second := events[start].cmd.Timestamp / 1000
+		end := start
+		stacked := make(map[int]int)
+		height := 1
+		for ; end < len(events) && events[end].cmd.Timestamp/1000 == second; end++ {
+			e := events[end]
+			i := players[e.column]
+			icon, text, _ := strings.Cut(commands.Describe(e.cmd), " ")
+			l.cells = append(l.cells, cell{
+				x: columnX(e.column), y: y + stacked[e.column]*rowHeight, w: columnWidth, h: rowHeight - 2,
+				color: Colors[i%len(Colors)], fill: fill(e.cmd.CommandType), icon: icon, text: truncate(text),
+			})
+			stacked[e.column]++
+			if stacked[e.column] > height {
+				height = stacked[e.column]
+			}
+		}
+		l.rows = append(l.rows, row{y: y, h: height * rowHeight, label: formatTime(time.Duration(second) * time.Second)})
+		y += height * rowHeight
+		start = end
+	}
+
+	l.width = columnX(len(players)) - columnGap + margin
+	l.height = y + margin
+	return l, nil
+}
+
+// selectPlayers returns the indexes of the referenced players, in reference order
+func selectPlayers(data *vault.ReplayData, refs []string) ([]int, error) {
+	if len(refs) == 0 {
+		indexes := make([]int, len(data.Players))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	for _, ref := range refs {
+		index := -1
+		for i, player := range data.Players {
+			if strings.EqualFold(player.PlayerName, ref) || strconv.FormatUint(uint64(player.PlayerID), 10) == ref {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("player %q not found", ref)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+func columnX(column int) int {
+	return margin + gutterWidth + column*(columnWidth+columnGap)
+}
+
+func fill(commandType string) string {
+	if f, ok := categoryFills[commands.CommandDefinitions[commands.CommandType(commandType)].Category]; ok {
+		return f
+	}
+	return cellFill
+}
+
+// truncate shortens text that would overflow a cell
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxTextRunes {
+		return text
+	}
+	return string(runes[:maxTextRunes-1]) + "…"
+}
+
+func formatTime(t time.Duration) string {
+	seconds := int(t / time.Second)
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,111 @@
+package timeline
+
+import (
+	"bytes"
+	"flag"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/vault"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func strPtr(s string) *string { return &s }
+
+func testReplay() *vault.ReplayData {
+	return &vault.ReplayData{
+		Success:         true,
+		MapFilename:     "rails_and_sand_4p",
+		DurationSeconds: 600,
+		Players: []vault.Player{
+			{
+				PlayerID:   0,
+				PlayerName: "Tomsch",
+				Faction:    strPtr("Wehrmacht"),
+				BuildCommands: []vault.Command{
+					{Timestamp: 4000, CommandType: "build_squad", PBGID: strPtr("2072012"), UnitName: strPtr("Pioneer Squad")},
+					{Timestamp: 4500, CommandType: "build_squad", PBGID: strPtr("2072012"), UnitName: strPtr("Pioneer Squad")},
+					{Timestamp: 61500, CommandType: "construct_entity", PBGID: strPtr("2072360"), BuildingName: strPtr("Infanterie Kompanie")},
+					{Timestamp: 400000, CommandType: "use_ability", PBGID: strPtr("2090001")},
+				},
+			},
+			{
+				PlayerID:   1,
+				PlayerName: "Ted <Silk> & Co",
+				Faction:    strPtr("Americans"),
+				BuildCommands: []vault.Command{
+					{Timestamp: 4200, CommandType: "build_squad", PBGID: strPtr("2073200"), UnitName: strPtr("Engineer Squad with a name too long to fit the column")},
+					{Timestamp: 300000, CommandType: "cancel_production"},
+				},
+			},
+		},
+	}
+}
+
+func TestWriteSVGGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, testReplay(), Options{}); err != nil {
+		t.Fatalf("WriteSVG: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "timeline.svg")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("SVG output does not match %s\ngot:\n%s\nwant:\n%s", golden, buf.String(), want)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var buf bytes.Buffer
+	opts := Options{Title: "Mirror", Players: []string{"1", "tomsch"}, From: time.Minute, To: 6 * time.Minute}
+	if err := WriteSVG(&buf, testReplay(), opts); err != nil {
+		t.Fatalf("WriteSVG: %v", err)
+	}
+	svg := buf.String()
+
+	// Players are drawn in the order given, with commands in the time range only
+	if !strings.Contains(svg, "Mirror (01:00–06:00)") || strings.Index(svg, "Ted &lt;Silk&gt;") > strings.Index(svg, "Tomsch") {
+		t.Errorf("Unexpected title or player order:\n%s", svg)
+	}
+	if strings.Contains(svg, "Pioneer Squad") || !strings.Contains(svg, "Infanterie Kompanie") ||
+		!strings.Contains(svg, "Cancelled production") || strings.Contains(svg, "Used ability") {
+		t.Errorf("Unexpected commands in range:\n%s", svg)
+	}
+
+	if err := WriteSVG(&buf, testReplay(), Options{Players: []string{"Nobody"}}); err == nil {
+		t.Error("Expected an error for an unknown player")
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePNG(&buf, testReplay(), Options{}); err != nil {
+		t.Fatalf("WritePNG: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decoding PNG: %v", err)
+	}
+
+	l, _ := newLayout(testReplay(), Options{})
+	if bounds := img.Bounds(); bounds.Dx() != l.width || bounds.Dy() != l.height {
+		t.Errorf("PNG is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), l.width, l.height)
+	}
+	// Four rows: 00:04 (with two stacked commands), 01:01, 05:00 and 06:40
+	if len(l.rows) != 4 || l.rows[0].h != 2*rowHeight || len(l.cells) != 6 {
+		t.Errorf("Unexpected layout: %d rows, %d cells", len(l.rows), len(l.cells))
+	}
+}
@@ -0,0 +1,134 @@
+// Package watch detects new replay files in a directory, such as the CoH3
+// playback folder, once the game has finished writing them.
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options configures a Watcher
+type Options struct {
+	// Interval between directory scans (default 2s)
+	Interval time.Duration
+	// Settle is how long a file's size and modification time must stay unchanged
+	// before it is considered complete (default 5s). The game writes replays
+	// incrementally, so a file is only handed over once it stops changing.
+	Settle time.Duration
+	// IncludeExisting also reports files present when watching starts
+	IncludeExisting bool
+}
+
+// fileState is the last observed state of a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // When this state was first observed
+	done    bool      // Reported in this state
+}
+
+// Watcher polls a directory for new or rewritten .rec files
+type Watcher struct {
+	dir   string
+	opts  Options
+	files map[string]*fileState
+}
+
+// New creates a watcher for dir
+func New(dir string, opts Options) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 5 * time.Second
+	}
+	return &Watcher{dir: dir, opts: opts}
+}
+
+// DefaultPlaybackDir returns the folder CoH3 saves replays to
+func DefaultPlaybackDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Documents", "My Games", "Company of Heroes 3", "playback"), nil
+}
+
+// Run scans the directory until ctx is cancelled, calling handle with the path
+// of each completed replay file. Calls to handle happen on the Run goroutine.
+func (w *Watcher) Run(ctx context.Context, handle func(path string)) error {
+	if _, err := os.Stat(w.dir); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, path := range w.poll(time.Now()) {
+			handle(path)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll scans the directory once and returns the files that have settled since the last scan
+func (w *Watcher) poll(now time.Time) []string {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		// The directory may be temporarily unavailable; try again next scan
+		return nil
+	}
+
+	firstScan := w.files == nil
+	if firstScan {
+		w.files = make(map[string]*fileState)
+	}
+
+	present := make(map[string]bool)
+	var ready []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".rec") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(w.dir, entry.Name())
+		present[path] = true
+
+		state, known := w.files[path]
+		if !known || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+			w.files[path] = &fileState{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				since:   now,
+				done:    firstScan && !w.opts.IncludeExisting,
+			}
+			continue
+		}
+		if !state.done && now.Sub(state.since) >= w.opts.Settle {
+			state.done = true
+			ready = append(ready, path)
+		}
+	}
+
+	// Forget deleted files so a replay saved again under the same name is picked up
+	for path := range w.files {
+		if !present[path] {
+			delete(w.files, path)
+		}
+	}
+
+	sort.Strings(ready)
+	return ready
+}
@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollWaitsForFilesToSettle(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.rec")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(dir, Options{Settle: 5 * time.Second})
+	start := time.Now()
+	if ready := w.poll(start); len(ready) != 0 {
+		t.Fatalf("First scan reported %v; existing files should be skipped", ready)
+	}
+
+	replay := filepath.Join(dir, "new.rec")
+	if err := os.WriteFile(replay, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ready := w.poll(start.Add(1 * time.Second)); len(ready) != 0 {
+		t.Fatalf("Reported %v before the file settled", ready)
+	}
+
+	// The game is still writing: the size changes, so the settle timer restarts
+	if err := os.WriteFile(replay, []byte("partial, now complete"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ready := w.poll(start.Add(4 * time.Second)); len(ready) != 0 {
+		t.Fatalf("Reported %v while the file was still changing", ready)
+	}
+	if ready := w.poll(start.Add(8 * time.Second)); len(ready) != 0 {
+		t.Fatalf("Reported %v before the file settled", ready)
+	}
+
+	ready := w.poll(start.Add(10 * time.Second))
+	if !reflect.DeepEqual(ready, []string{replay}) {
+		t.Fatalf("Expected %s to be reported, got %v", replay, ready)
+	}
+	if ready := w.poll(start.Add(20 * time.Second)); len(ready) != 0 {
+		t.Fatalf("Reported %v again", ready)
+	}
+}
+
+func TestPollIncludeExisting(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.rec")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(dir, Options{Settle: time.Second, IncludeExisting: true})
+	start := time.Now()
+	w.poll(start)
+	ready := w.poll(start.Add(2 * time.Second))
+	if !reflect.DeepEqual(ready, []string{existing}) {
+		t.Fatalf("Expected %s to be reported, got %v", existing, ready)
+	}
+}
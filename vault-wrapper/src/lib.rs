@@ -1,8 +1,10 @@
 use libc::c_char;
 use serde::{Deserialize, Serialize};
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet};
 use std::ffi::{CStr, CString};
+use std::panic::{self, AssertUnwindSafe};
 use std::ptr;
+use std::sync::atomic::{AtomicI32, Ordering};
 
 const TICKS_PER_SECOND: u32 = 8;
 const MILLISECONDS_PER_TICK: u32 = 125;
@@ -40,6 +42,7 @@ pub struct PlayerInfo {
 pub struct ReplayData {
     pub success: bool,
     pub error_message: Option<String>,
+    pub error_code: Option<ErrorCode>,
     // Match Information
     pub map_name: String,
     pub map_filename: String,
@@ -81,207 +84,241 @@ pub struct GameMessage {
 }
 
 
+// Why a parse failed, so the Go side can map failures to sentinel errors.
+// Must agree with the error codes in vault/errors.go.
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, PartialEq)]
+#[serde(rename_all = "snake_case")]
+pub enum ErrorCode {
+    InvalidArgument,    // The caller passed a null or non-UTF-8 path
+    Io,                 // The file could not be read
+    NotAReplay,         // The file has no CoH3 replay header
+    UnsupportedVersion, // The replay was written by a game version vault cannot read
+    CorruptStream,      // The replay header is valid but the rest could not be parsed
+    InternalPanic,      // The wrapper or vault panicked
+    Cancelled,          // The caller set the cancel flag
+}
+
+// A parse failure with its error code
+#[derive(Debug)]
+pub struct ParseFailure {
+    pub code: ErrorCode,
+    pub message: String,
+}
+
+impl ParseFailure {
+    fn new(code: ErrorCode, message: impl Into<String>) -> Self {
+        ParseFailure { code, message: message.into() }
+    }
+}
+
 #[no_mangle]
 pub extern "C" fn parse_replay_full(file_path: *const c_char) -> *mut c_char {
-    if file_path.is_null() {
-        let error_result = ReplayData {
-            success: false,
-            error_message: Some("File path is null".to_string()),
-            map_name: String::new(),
-            map_filename: String::new(),
-            duration_seconds: 0,
-            duration_ticks: 0,
-            game_version: None,
-            timestamp: None,
-            game_type: None,
-            matchhistory_id: None,
-            teams: vec![],
-            winning_team: None,
-            players: vec![],
-            messages: vec![],
+    guard_parse(|| {
+        let file_path_str = path_argument(file_path)?;
+        parse_replay_full_internal(file_path_str)
+    })
+}
+
+#[no_mangle]
+pub extern "C" fn parse_replay_with_filter(file_path: *const c_char, command_types: *const c_char) -> *mut c_char {
+    parse_replay_cancellable(file_path, command_types, ptr::null())
+}
+
+// Like parse_replay_with_filter, but gives up with a cancelled error once the
+// caller sets *cancel to a non-zero value. The flag is checked between parsing
+// stages, so a parse stops soon after, but not during the call into vault.
+// cancel may be null, and must stay valid until the call returns.
+#[no_mangle]
+pub extern "C" fn parse_replay_cancellable(
+    file_path: *const c_char,
+    command_types: *const c_char,
+    cancel: *const i32,
+) -> *mut c_char {
+    guard_parse(|| {
+        let cancel = CancelFlag::new(cancel);
+        let file_path_str = path_argument(file_path)?;
+
+        let command_filter = if command_types.is_null() {
+            CommandFilter::default()
+        } else {
+            let types_str = unsafe { CStr::from_ptr(command_types) };
+            match types_str.to_str() {
+                Ok(s) => CommandFilter::from_spec(s),
+                Err(_) => CommandFilter::default(),
+            }
         };
-        return serialize_replay_data(&error_result);
+
+        parse_replay_with_filter_internal(file_path_str, &command_filter, &cancel)
+    })
+}
+
+#[no_mangle]
+pub extern "C" fn free_string(s: *mut c_char) {
+    if !s.is_null() {
+        let _ = catch_panic(|| unsafe {
+            let _ = CString::from_raw(s);
+        });
     }
+}
 
-    let c_str = unsafe { CStr::from_ptr(file_path) };
-    let file_path_str = match c_str.to_str() {
-        Ok(s) => s,
-        Err(_) => {
-            let error_result = ReplayData {
-                success: false,
-                error_message: Some("Invalid file path encoding".to_string()),
-                map_name: String::new(),
-                map_filename: String::new(),
-                duration_seconds: 0,
-                duration_ticks: 0,
-                game_version: None,
-                timestamp: None,
-                game_type: None,
-                matchhistory_id: None,
-                teams: vec![],
-                winning_team: None,
-                players: vec![],
-                messages: vec![],
-            };
-            return serialize_replay_data(&error_result);
+// Returns a JSON array of the command types that can be selected with a filter.
+// Must agree with the command-type registry in pkg/commands.
+#[no_mangle]
+pub extern "C" fn supported_command_types() -> *mut c_char {
+    catch_panic(|| {
+        let types: Vec<&str> = COMMAND_KINDS
+            .iter()
+            .filter(|kind| kind.filterable)
+            .map(|kind| kind.name)
+            .chain(std::iter::once(UNKNOWN_COMMAND))
+            .collect();
+
+        match serde_json::to_string(&types) {
+            Ok(json) => into_c_string(json),
+            Err(_) => ptr::null_mut(),
         }
-    };
+    })
+    .unwrap_or(ptr::null_mut())
+}
 
-    match parse_replay_full_internal(file_path_str) {
-        Ok(result) => serialize_replay_data(&result),
-        Err(e) => {
-            let error_result = ReplayData {
-                success: false,
-                error_message: Some(e),
-                map_name: String::new(),
-                map_filename: String::new(),
-                duration_seconds: 0,
-                duration_ticks: 0,
-                game_version: None,
-                timestamp: None,
-                game_type: None,
-                matchhistory_id: None,
-                teams: vec![],
-                winning_team: None,
-                players: vec![],
-                messages: vec![],
-            };
-            serialize_replay_data(&error_result)
+// Returns the wrapper version. Parse results cached by the Go side are keyed by it,
+// so bump the crate version whenever the parser output changes (including vault upgrades).
+#[no_mangle]
+pub extern "C" fn parser_version() -> *mut c_char {
+    catch_panic(|| into_c_string(env!("CARGO_PKG_VERSION").to_string())).unwrap_or(ptr::null_mut())
+}
+
+// Runs the body of an export, returning the panic message if it panics. A panic
+// must never unwind across extern "C": that is undefined behaviour and takes the
+// whole Go process down with it.
+fn catch_panic<T>(body: impl FnOnce() -> T) -> Result<T, String> {
+    panic::catch_unwind(AssertUnwindSafe(body)).map_err(|payload| {
+        if let Some(message) = payload.downcast_ref::<&str>() {
+            message.to_string()
+        } else if let Some(message) = payload.downcast_ref::<String>() {
+            message.clone()
+        } else {
+            "unknown panic".to_string()
         }
-    }
+    })
 }
 
+// Runs a parse export, serializing its result, its failure or its panic
+fn guard_parse(parse: impl FnOnce() -> Result<ReplayData, ParseFailure>) -> *mut c_char {
+    let result = match catch_panic(parse) {
+        Ok(Ok(result)) => result,
+        Ok(Err(failure)) => error_result(failure),
+        Err(message) => error_result(ParseFailure::new(
+            ErrorCode::InternalPanic,
+            format!("Parser panicked: {}", message),
+        )),
+    };
+    serialize_replay_data(&result)
+}
+
+// Reads the file path argument of a parse export
+fn path_argument<'a>(file_path: *const c_char) -> Result<&'a str, ParseFailure> {
+    if file_path.is_null() {
+        return Err(ParseFailure::new(ErrorCode::InvalidArgument, "File path is null"));
+    }
+    let c_str = unsafe { CStr::from_ptr(file_path) };
+    c_str
+        .to_str()
+        .map_err(|_| ParseFailure::new(ErrorCode::InvalidArgument, "Invalid file path encoding"))
+}
 
+fn error_result(failure: ParseFailure) -> ReplayData {
+    ReplayData {
+        success: false,
+        error_message: Some(failure.message),
+        error_code: Some(failure.code),
+        map_name: String::new(),
+        map_filename: String::new(),
+        duration_seconds: 0,
+        duration_ticks: 0,
+        game_version: None,
+        timestamp: None,
+        game_type: None,
+        matchhistory_id: None,
+        teams: vec![],
+        winning_team: None,
+        players: vec![],
+        messages: vec![],
+    }
+}
 
+// The game type a CoH3 replay declares in its header, right after the 2-byte
+// game version
+const REPLAY_MAGIC: &[u8] = b"COH3_REC";
 
-// C-compatible command filter structure
-#[repr(C)]
-#[derive(Debug, Clone)]
-pub struct CCommandFilter {
-    pub include_build_squad: bool,
-    pub include_construct_entity: bool,
-    pub include_build_global_upgrade: bool,
-    pub include_use_ability: bool,
-    pub include_use_battlegroup_ability: bool,
-    pub include_select_battlegroup: bool,
-    pub include_select_battlegroup_ability: bool,
-    pub include_cancel_construction: bool,
-    pub include_cancel_production: bool,
-    pub include_ai_takeover: bool,
-    pub include_unknown: bool,
-}
-
-impl From<CCommandFilter> for CommandFilter {
-    fn from(c_filter: CCommandFilter) -> Self {
-        Self {
-            include_build_squad: c_filter.include_build_squad,
-            include_construct_entity: c_filter.include_construct_entity,
-            include_build_global_upgrade: c_filter.include_build_global_upgrade,
-            include_use_ability: c_filter.include_use_ability,
-            include_use_battlegroup_ability: c_filter.include_use_battlegroup_ability,
-            include_select_battlegroup: c_filter.include_select_battlegroup,
-            include_select_battlegroup_ability: c_filter.include_select_battlegroup_ability,
-            include_cancel_construction: c_filter.include_cancel_construction,
-            include_cancel_production: c_filter.include_cancel_production,
-            include_ai_takeover: c_filter.include_ai_takeover,
-            include_unknown: c_filter.include_unknown,
-        }
+// Reads the replay header, returning the game version it was written by, or
+// None if the data is not a CoH3 replay
+fn replay_header_version(data: &[u8]) -> Option<u16> {
+    if data.len() < 2 + REPLAY_MAGIC.len() || &data[2..2 + REPLAY_MAGIC.len()] != REPLAY_MAGIC {
+        return None;
     }
+    Some(u16::from_le_bytes([data[0], data[1]]))
 }
 
-#[no_mangle]
-pub extern "C" fn parse_replay_with_filter(file_path: *const c_char, filter: *const CCommandFilter) -> *mut c_char {
-    if file_path.is_null() {
-        let error_result = ReplayData {
-            success: false,
-            error_message: Some("File path is null".to_string()),
-            map_name: String::new(),
-            map_filename: String::new(),
-            duration_seconds: 0,
-            duration_ticks: 0,
-            game_version: None,
-            timestamp: None,
-            game_type: None,
-            matchhistory_id: None,
-            teams: vec![],
-            winning_team: None,
-            players: vec![],
-            messages: vec![],
-        };
-        return serialize_replay_data(&error_result);
+// Classifies a failure of vault to parse a replay with a valid header. vault's
+// errors are opaque, so like the team and command extraction this relies on
+// their debug output.
+fn classify_parse_error(version: u16, error_debug: &str) -> ParseFailure {
+    if error_debug.to_lowercase().contains("version") {
+        return ParseFailure::new(
+            ErrorCode::UnsupportedVersion,
+            format!("Unsupported replay version {}: {}", version, error_debug),
+        );
     }
+    ParseFailure::new(ErrorCode::CorruptStream, format!("Failed to parse replay: {}", error_debug))
+}
 
-    let c_str = unsafe { CStr::from_ptr(file_path) };
-    let file_path_str = match c_str.to_str() {
-        Ok(s) => s,
-        Err(_) => {
-            let error_result = ReplayData {
-                success: false,
-                error_message: Some("Invalid file path encoding".to_string()),
-                map_name: String::new(),
-                map_filename: String::new(),
-                duration_seconds: 0,
-                duration_ticks: 0,
-                game_version: None,
-                timestamp: None,
-                game_type: None,
-                matchhistory_id: None,
-                teams: vec![],
-                winning_team: None,
-                players: vec![],
-                messages: vec![],
-            };
-            return serialize_replay_data(&error_result);
-        }
-    };
+// A cancel flag shared with the caller, which sets it from another thread
+struct CancelFlag<'a>(Option<&'a AtomicI32>);
 
-    let command_filter = if filter.is_null() {
-        CommandFilter::default()
-    } else {
-        let c_filter = unsafe { &*filter };
-        c_filter.clone().into()
-    };
+impl CancelFlag<'_> {
+    fn new(flag: *const i32) -> Self {
+        // AtomicI32 has the same layout as i32
+        CancelFlag(unsafe { (flag as *const AtomicI32).as_ref() })
+    }
 
-    match parse_replay_with_filter_internal(file_path_str, &command_filter) {
-        Ok(result) => serialize_replay_data(&result),
-        Err(e) => {
-            let error_result = ReplayData {
-                success: false,
-                error_message: Some(e),
-                map_name: String::new(),
-                map_filename: String::new(),
-                duration_seconds: 0,
-                duration_ticks: 0,
-                game_version: None,
-                timestamp: None,
-                game_type: None,
-                matchhistory_id: None,
-                teams: vec![],
-                winning_team: None,
-                players: vec![],
-                messages: vec![],
-            };
-            serialize_replay_data(&error_result)
+    fn none() -> Self {
+        CancelFlag(None)
+    }
+
+    fn check(&self) -> Result<(), ParseFailure> {
+        match self.0 {
+            Some(flag) if flag.load(Ordering::Relaxed) != 0 => {
+                Err(ParseFailure::new(ErrorCode::Cancelled, "Parsing was cancelled"))
+            }
+            _ => Ok(()),
         }
     }
 }
 
-#[no_mangle]
-pub extern "C" fn free_string(s: *mut c_char) {
-    if !s.is_null() {
-        unsafe {
-            let _ = CString::from_raw(s);
-        }
+fn into_c_string(s: String) -> *mut c_char {
+    match CString::new(s) {
+        Ok(c_string) => c_string.into_raw(),
+        Err(_) => ptr::null_mut(),
     }
 }
 
 
-fn parse_replay_with_filter_internal(file_path: &str, command_filter: &CommandFilter) -> Result<ReplayData, String> {
+fn parse_replay_with_filter_internal(
+    file_path: &str,
+    command_filter: &CommandFilter,
+    cancel: &CancelFlag,
+) -> Result<ReplayData, ParseFailure> {
+    cancel.check()?;
     let data = std::fs::read(file_path)
-        .map_err(|e| format!("Failed to read file: {}", e))?;
-    
+        .map_err(|e| ParseFailure::new(ErrorCode::Io, format!("Failed to read file: {}", e)))?;
+    cancel.check()?;
+
+    let version = replay_header_version(&data)
+        .ok_or_else(|| ParseFailure::new(ErrorCode::NotAReplay, "The file is not a CoH3 replay"))?;
     let replay = vault::Replay::from_bytes(&data)
-        .map_err(|e| format!("Failed to parse replay: {:?}", e))?;
+        .map_err(|e| classify_parse_error(version, &format!("{:?}", e)))?;
+    cancel.check()?;
 
     // Extract comprehensive match information
     let map = replay.map();
@@ -313,6 +350,8 @@ fn parse_replay_with_filter_internal(file_path: &str, command_filter: &CommandFi
     let mut team_map: HashMap<u32, Vec<PlayerInfo>> = HashMap::new();
     
     for (idx, player) in &players_list {
+        cancel.check()?;
+
         // Extract team ID (using debug output as vault library doesn't expose team ID directly)
         let team_debug = format!("{:?}", player.team());
         let team_id = extract_team_id_from_debug(&team_debug, *idx);
@@ -373,11 +412,13 @@ fn parse_replay_with_filter_internal(file_path: &str, command_filter: &CommandFi
     let winning_team = None; // TODO: Implement winning team detection
     
     // Extract global messages
+    cancel.check()?;
     let messages = extract_game_messages(&replay);
     
     Ok(ReplayData {
         success: true,
         error_message: None,
+        error_code: None,
         map_name,
         map_filename,
         duration_seconds,
@@ -393,10 +434,10 @@ fn parse_replay_with_filter_internal(file_path: &str, command_filter: &CommandFi
     })
 }
 
-fn parse_replay_full_internal(file_path: &str) -> Result<ReplayData, String> {
+fn parse_replay_full_internal(file_path: &str) -> Result<ReplayData, ParseFailure> {
     // Use default filter (build commands only) for backwards compatibility
     let default_filter = CommandFilter::default();
-    parse_replay_with_filter_internal(file_path, &default_filter)
+    parse_replay_with_filter_internal(file_path, &default_filter, &CancelFlag::none())
 }
 
 
@@ -511,48 +552,65 @@ fn extract_game_messages(replay: &vault::Replay) -> Vec<GameMessage> {
 
 
 
+// A command kind the parser can emit, identified by patterns in the command's debug output
+struct CommandKind {
+    name: &'static str,
+    patterns: &'static [&'static str],
+    filterable: bool, // false for internal kinds that are never included in build_commands
+}
+
+// Command kinds in classification order; the first kind with a matching pattern wins.
+// This is the parser half of the command-type registry in pkg/commands: adding a
+// kind here and a definition there is all a new command type needs.
+const COMMAND_KINDS: &[CommandKind] = &[
+    CommandKind { name: "build_squad", patterns: &["BuildSquad"], filterable: true },
+    CommandKind {
+        name: "construct_entity",
+        patterns: &["ConstructEntity", "PlaceAndConstructEntities", "PCMD_PlaceAndConstructEntities"],
+        filterable: true,
+    },
+    // Completion events are filtered out to avoid duplicating construct_entity
+    CommandKind {
+        name: "construct_entity_completion",
+        patterns: &["BuildStructure", "SCMD_BuildStructure"],
+        filterable: false,
+    },
+    CommandKind {
+        name: "build_global_upgrade",
+        patterns: &["BuildGlobalUpgrade", "TentativeUpgradePurchaseAll", "SCMD_Upgrade"],
+        filterable: true,
+    },
+    CommandKind { name: "use_ability", patterns: &["UseAbility", "SCMD_Ability"], filterable: true },
+    CommandKind { name: "use_battlegroup_ability", patterns: &["UseBattlegroupAbility"], filterable: true },
+    CommandKind { name: "select_battlegroup", patterns: &["SelectBattlegroup"], filterable: true },
+    CommandKind { name: "select_battlegroup_ability", patterns: &["SelectBattlegroupAbility"], filterable: true },
+    CommandKind { name: "cancel_construction", patterns: &["CancelConstruction"], filterable: true },
+    CommandKind {
+        name: "cancel_production",
+        patterns: &["CancelProduction", "SCMD_CancelProduction"],
+        filterable: true,
+    },
+    CommandKind { name: "ai_takeover", patterns: &["AITakeover"], filterable: true },
+];
+
+// Command type for anything no kind matches
+const UNKNOWN_COMMAND: &str = "unknown";
+
 // Simple command parsing that extracts command type and PBGID
 fn parse_command_simple(command_debug: &str) -> (String, String, Option<String>, Option<String>) {
-    let command_type;
     let details = command_debug.to_string();
     
-    
     // Extract PBGID and index
     let pbgid = extract_pbgid(command_debug);
     let index = extract_index(command_debug);
     
     // Determine command type from debug output
-    if command_debug.contains("BuildSquad") {
-        command_type = "build_squad".to_string();
-    } else if command_debug.contains("ConstructEntity") || 
-              command_debug.contains("PlaceAndConstructEntities") ||
-              command_debug.contains("PCMD_PlaceAndConstructEntities") {
-        command_type = "construct_entity".to_string();
-    } else if command_debug.contains("BuildStructure") ||
-              command_debug.contains("SCMD_BuildStructure") {
-        command_type = "construct_entity_completion".to_string();
-    } else if command_debug.contains("BuildGlobalUpgrade") ||
-              command_debug.contains("TentativeUpgradePurchaseAll") ||
-              command_debug.contains("SCMD_Upgrade") {
-        command_type = "build_global_upgrade".to_string();
-    } else if command_debug.contains("UseAbility") || command_debug.contains("SCMD_Ability") {
-        command_type = "use_ability".to_string();
-    } else if command_debug.contains("UseBattlegroupAbility") {
-        command_type = "use_battlegroup_ability".to_string();
-    } else if command_debug.contains("SelectBattlegroup") {
-        command_type = "select_battlegroup".to_string();
-    } else if command_debug.contains("SelectBattlegroupAbility") {
-        command_type = "select_battlegroup_ability".to_string();
-    } else if command_debug.contains("CancelConstruction") {
-        command_type = "cancel_construction".to_string();
-    } else if command_debug.contains("CancelProduction") || command_debug.contains("SCMD_CancelProduction") {
-        command_type = "cancel_production".to_string();
-    } else if command_debug.contains("AITakeover") {
-        command_type = "ai_takeover".to_string();
-    } else {
-        command_type = "unknown".to_string();
-    }
-    
+    let command_type = COMMAND_KINDS
+        .iter()
+        .find(|kind| kind.patterns.iter().any(|pattern| command_debug.contains(pattern)))
+        .map(|kind| kind.name)
+        .unwrap_or(UNKNOWN_COMMAND)
+        .to_string();
     
     (command_type, details, pbgid, index)
 }
@@ -611,37 +669,22 @@ fn extract_message_content(message_debug: &str) -> String {
     }
 }
 
-// Configuration for command filtering
+// Configuration for command filtering: the set of command types to include
+// in build_commands, or None to include every filterable type
 #[derive(Debug, Clone)]
 pub struct CommandFilter {
-    pub include_build_squad: bool,
-    pub include_construct_entity: bool,
-    pub include_build_global_upgrade: bool,
-    pub include_use_ability: bool,
-    pub include_use_battlegroup_ability: bool,
-    pub include_select_battlegroup: bool,
-    pub include_select_battlegroup_ability: bool,
-    pub include_cancel_construction: bool,
-    pub include_cancel_production: bool,
-    pub include_ai_takeover: bool,
-    pub include_unknown: bool,
+    pub include: Option<HashSet<String>>,
 }
 
 impl Default for CommandFilter {
     fn default() -> Self {
-        Self {
-            include_build_squad: true,
-            include_construct_entity: true,
-            include_build_global_upgrade: true,
-            include_use_ability: false,
-            include_use_battlegroup_ability: false,
-            include_select_battlegroup: true,
-            include_select_battlegroup_ability: true,
-            include_cancel_construction: false,
-            include_cancel_production: false,
-            include_ai_takeover: false,
-            include_unknown: false,
-        }
+        Self::from_types(&[
+            "build_squad",
+            "construct_entity",
+            "build_global_upgrade",
+            "select_battlegroup",
+            "select_battlegroup_ability",
+        ])
     }
 }
 
@@ -651,52 +694,44 @@ impl CommandFilter {
     }
     
     pub fn new_all_commands() -> Self {
-        Self {
-            include_build_squad: true,
-            include_construct_entity: true,
-            include_build_global_upgrade: true,
-            include_use_ability: true,
-            include_use_battlegroup_ability: true,
-            include_select_battlegroup: true,
-            include_select_battlegroup_ability: true,
-            include_cancel_construction: true,
-            include_cancel_production: true,
-            include_ai_takeover: true,
-            include_unknown: true,
-        }
+        Self { include: None }
     }
     
     pub fn new_combat_only() -> Self {
+        Self::from_types(&["use_ability", "use_battlegroup_ability"])
+    }
+
+    pub fn from_types(types: &[&str]) -> Self {
         Self {
-            include_build_squad: false,
-            include_construct_entity: false,
-            include_build_global_upgrade: false,
-            include_use_ability: true,
-            include_use_battlegroup_ability: true,
-            include_select_battlegroup: false,
-            include_select_battlegroup_ability: false,
-            include_cancel_construction: false,
-            include_cancel_production: false,
-            include_ai_takeover: false,
-            include_unknown: false,
+            include: Some(types.iter().map(|t| t.to_string()).collect()),
+        }
+    }
+
+    // Parses the FFI filter format: "*" for all types, otherwise a comma-separated list of types
+    pub fn from_spec(spec: &str) -> Self {
+        if spec.trim() == "*" {
+            return Self::new_all_commands();
+        }
+        Self {
+            include: Some(
+                spec.split(',')
+                    .map(|t| t.trim())
+                    .filter(|t| !t.is_empty())
+                    .map(|t| t.to_string())
+                    .collect(),
+            ),
         }
     }
     
     fn should_include_command(&self, command_type: &str) -> bool {
-        match command_type {
-            "build_squad" => self.include_build_squad,
-            "construct_entity" => self.include_construct_entity,
-            "construct_entity_completion" => false, // Filter out completion events to avoid duplicates
-            "build_global_upgrade" => self.include_build_global_upgrade,
-            "use_ability" => self.include_use_ability,
-            "use_battlegroup_ability" => self.include_use_battlegroup_ability,
-            "select_battlegroup" => self.include_select_battlegroup,
-            "select_battlegroup_ability" => self.include_select_battlegroup_ability,
-            "cancel_construction" => self.include_cancel_construction,
-            "cancel_production" => self.include_cancel_production,
-            "ai_takeover" => self.include_ai_takeover,
-            "unknown" => self.include_unknown,
-            _ => false,
+        let filterable = command_type == UNKNOWN_COMMAND
+            || COMMAND_KINDS.iter().any(|kind| kind.name == command_type && kind.filterable);
+        if !filterable {
+            return false;
+        }
+        match &self.include {
+            Some(types) => types.contains(command_type),
+            None => true,
         }
     }
 }
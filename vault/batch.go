@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+)
+
+// ParseOptions configures ParseReplays
+type ParseOptions struct {
+	// Filter selects the commands included in BuildCommands (default: build commands only)
+	Filter *CommandFilter
+	// Resolver enhances commands with friendly names. If nil, one is loaded from DataDir
+	// and shared by all workers; if that fails too, commands are not enhanced.
+	Resolver *lookup.DataResolver
+	DataDir  string
+	// Cache, if set, serves and stores enriched results; Resolver and DataDir are then unused
+	Cache *ParseCache
+	// Workers bounds the number of replays parsed concurrently (default: number of CPUs)
+	Workers int
+	// Progress, if set, is called after each replay is parsed. Calls are serialized.
+	Progress func(done, total int, result ParseResult)
+}
+
+// ParseResult is the outcome of parsing one replay in a batch
+type ParseResult struct {
+	Path string
+	Data *ReplayData
+	Err  error
+}
+
+// ParseReplays parses many replay files concurrently with a bounded worker pool.
+// Results are returned in the order of paths; a failure is reported in that file's
+// result without stopping the batch. Once ctx is cancelled no further files are
+// started, replays being parsed are stopped, and the remaining results carry ctx.Err().
+func ParseReplays(ctx context.Context, paths []string, opts ParseOptions) []ParseResult {
+	filter := NewBuildOnlyFilter()
+	if opts.Filter != nil {
+		filter = *opts.Filter
+	}
+
+	resolver := opts.Resolver
+	if resolver == nil && opts.DataDir != "" && opts.Cache == nil {
+		resolver, _ = lookup.NewDataResolver(opts.DataDir)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	results := make([]ParseResult, len(paths))
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		progress sync.Mutex
+		done     int
+	)
+
+	report := func(i int) {
+		if opts.Progress == nil {
+			return
+		}
+		progress.Lock()
+		defer progress.Unlock()
+		done++
+		opts.Progress(done, len(paths), results[i])
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var (
+					data *ReplayData
+					err  error
+				)
+				if opts.Cache != nil {
+					data, _, err = opts.Cache.ParseReplayContext(ctx, paths[i], filter)
+				} else {
+					data, err = ParseReplayContext(ctx, paths[i], resolver, filter)
+				}
+				results[i] = ParseResult{Path: paths[i], Data: data, Err: err}
+				report(i)
+			}
+		}()
+	}
+
+	next := 0
+dispatch:
+	for ; next < len(paths); next++ {
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := next; i < len(paths); i++ {
+		results[i] = ParseResult{Path: paths[i], Err: ctx.Err()}
+		report(i)
+	}
+
+	return results
+}
@@ -0,0 +1,259 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+)
+
+// CacheDirEnv overrides the default parse cache directory
+const CacheDirEnv = "COH3_CACHE_DIR"
+
+// cacheFormat is bumped whenever ReplayData or the Go-side enrichment changes,
+// so results cached by an older build are not reused
+const cacheFormat = 1
+
+// staleGenerationAge is how long a generation can go unused before it is
+// removed. Other generations are not removed straight away, since processes
+// using other game data can share the cache directory.
+const staleGenerationAge = 30 * 24 * time.Hour
+
+// ParseCache stores enriched parse results on disk, keyed by replay content and
+// command filter. Results live in a generation directory named after the parser
+// version, the game data version and the cache format, so results are
+// invalidated automatically when the wrapper or the game data changes. Opening
+// the cache removes generations that have not been used for a while. A
+// ParseCache is safe for concurrent use.
+type ParseCache struct {
+	// Worker, when set, parses the replays that are not cached in child
+	// processes (see ParseWorker)
+	Worker *ParseWorker
+
+	dir     string // Directory of the current generation
+	dataDir string
+
+	resolverOnce sync.Once
+	resolver     *lookup.DataResolver
+}
+
+// DefaultCacheDir returns the directory the parse cache is stored in: $COH3_CACHE_DIR
+// if set, otherwise coh3-replay-analyser/parse in the user cache directory
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "coh3-replay-analyser", "parse"), nil
+}
+
+// OpenParseCache opens the parse cache in dir for replays enriched with the game
+// data in dataDir, creating the directory if needed and removing results cached
+// for other parser or data versions that have not been used recently
+func OpenParseCache(dir, dataDir string) (*ParseCache, error) {
+	dataVersion, err := lookup.DataVersion(dataDir)
+	if err != nil {
+		// Results without usable game data are not enriched, so keep them apart
+		dataVersion = "none"
+	}
+	generation := sanitizeVersion(fmt.Sprintf("parser-%s_data-%s_v%d", ParserVersion(), dataVersion, cacheFormat))
+
+	if err := os.MkdirAll(filepath.Join(dir, generation), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create parse cache directory: %w", err)
+	}
+	// Mark the generation as used, so other processes keep it
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(dir, generation), now, now); err != nil {
+		return nil, fmt.Errorf("failed to update parse cache directory: %w", err)
+	}
+	if err := removeStaleGenerations(dir, generation, now.Add(-staleGenerationAge)); err != nil {
+		return nil, err
+	}
+	return &ParseCache{dir: filepath.Join(dir, generation), dataDir: dataDir}, nil
+}
+
+// ParseStats describes how a parse result was obtained
+type ParseStats struct {
+	Hit    bool          // The result was cached, so the replay was not parsed
+	Parse  time.Duration // Time spent in the Rust parser, including decoding its result
+	Enrich time.Duration // Time spent resolving names with the game data
+}
+
+// ParseReplayWithFilter behaves like the package-level ParseReplayWithFilter but
+// returns a cached result when the same replay was parsed with the same filter
+func (c *ParseCache) ParseReplayWithFilter(filePath string, filter CommandFilter) (*ReplayData, error) {
+	data, _, err := c.ParseReplayWithStats(filePath, filter)
+	return data, err
+}
+
+// ParseReplayWithStats behaves like ParseReplayWithFilter and also reports
+// whether the result was cached and how long parsing took
+func (c *ParseCache) ParseReplayWithStats(filePath string, filter CommandFilter) (*ReplayData, ParseStats, error) {
+	return c.ParseReplayContext(context.Background(), filePath, filter)
+}
+
+// ParseReplayContext behaves like ParseReplayWithStats but stops parsing once
+// ctx is done, as the package-level ParseReplayContext or the Worker does
+func (c *ParseCache) ParseReplayContext(ctx context.Context, filePath string, filter CommandFilter) (*ReplayData, ParseStats, error) {
+	var stats ParseStats
+	path, err := c.entryPath(filePath, filter)
+	if err != nil {
+		return nil, stats, err
+	}
+	if data, ok := c.load(path); ok {
+		stats.Hit = true
+		return data, stats, nil
+	}
+
+	start := time.Now()
+	var data *ReplayData
+	if c.Worker != nil {
+		data, err = c.Worker.parse(ctx, filePath, filter)
+	} else {
+		data, err = parseReplayContext(ctx, filePath, filter)
+	}
+	stats.Parse = time.Since(start)
+	if err != nil {
+		return nil, stats, err
+	}
+	if resolver := c.getResolver(); resolver != nil {
+		start = time.Now()
+		EnrichReplay(data, resolver)
+		stats.Enrich = time.Since(start)
+	}
+
+	// A failed write only costs a re-parse next time
+	_ = c.store(path, data)
+	return data, stats, nil
+}
+
+// Clear removes all cached results
+func (c *ParseCache) Clear() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getResolver loads the game data on first use, so cache hits never pay for it
+func (c *ParseCache) getResolver() *lookup.DataResolver {
+	c.resolverOnce.Do(func() {
+		c.resolver, _ = lookup.NewDataResolver(c.dataDir)
+	})
+	return c.resolver
+}
+
+// entryPath returns the cache file for a replay and filter: the SHA-256 of the
+// replay content followed by a hash of the filter's command types
+func (c *ParseCache) entryPath(filePath string, filter CommandFilter) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content := sha256.New()
+	if _, err := io.Copy(content, file); err != nil {
+		return "", err
+	}
+	filterHash := sha256.Sum256([]byte(filterKey(filter)))
+	name := hex.EncodeToString(content.Sum(nil)) + "-" + hex.EncodeToString(filterHash[:8]) + ".json"
+	return filepath.Join(c.dir, name), nil
+}
+
+func (c *ParseCache) load(path string) (*ReplayData, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var data ReplayData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, false
+	}
+	return &data, true
+}
+
+// store writes a result atomically so concurrent readers never see a partial file
+func (c *ParseCache) store(path string, data *ReplayData) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// filterKey encodes a filter independently of the order of its types
+func filterKey(filter CommandFilter) string {
+	if filter.All {
+		return "*"
+	}
+	types := append([]string(nil), filter.Types...)
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+// removeStaleGenerations deletes the cached results of other parser and data
+// versions last used before cutoff
+func removeStaleGenerations(dir, current string, cutoff time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == current || !strings.HasPrefix(entry.Name(), "parser-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed by another process
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove stale parse cache: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// sanitizeVersion makes a version string safe to use as a directory name
+func sanitizeVersion(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"context"
+	"errors"
+)
+
+// Errors the parser reports, for use with errors.Is. Parse errors carry the
+// parser's own message and match one of these.
+var (
+	ErrInvalidArgument    = errors.New("invalid parser argument")
+	ErrIO                 = errors.New("replay file could not be read")
+	ErrNotReplay          = errors.New("not a CoH3 replay")
+	ErrUnsupportedVersion = errors.New("unsupported replay version")
+	ErrCorruptReplay      = errors.New("corrupt replay")
+	ErrParserPanic        = errors.New("internal parser error")
+)
+
+// errorCodes maps the error codes of the Rust parser (ErrorCode in
+// vault-wrapper/src/lib.rs) to sentinel errors
+var errorCodes = map[string]error{
+	"invalid_argument":    ErrInvalidArgument,
+	"io":                  ErrIO,
+	"not_a_replay":        ErrNotReplay,
+	"unsupported_version": ErrUnsupportedVersion,
+	"corrupt_stream":      ErrCorruptReplay,
+	"internal_panic":      ErrParserPanic,
+	"cancelled":           context.Canceled,
+}
+
+// ParseError is a failure reported by the parser
+type ParseError struct {
+	Code    string // Parser error code, such as not_a_replay; empty if unknown
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel error of the error code, if any
+func (e *ParseError) Unwrap() error {
+	return errorCodes[e.Code]
+}
+
+// resultError returns the error of a failed parse result
+func resultError(result *ReplayData) error {
+	message := "failed to parse replay: unknown error"
+	if result.ErrorMessage != nil {
+		message = *result.ErrorMessage
+	}
+	var code string
+	if result.ErrorCode != nil {
+		code = *result.ErrorCode
+	}
+	return &ParseError{Code: code, Message: message}
+}
@@ -3,101 +3,81 @@ package vault
 /*
 #cgo LDFLAGS: -L./lib -lvault_wrapper -ldl -lm
 #include <stdlib.h>
-#include <stdbool.h>
-
-typedef struct {
-    bool include_build_squad;
-    bool include_construct_entity;
-    bool include_build_global_upgrade;
-    bool include_use_ability;
-    bool include_use_battlegroup_ability;
-    bool include_select_battlegroup;
-    bool include_select_battlegroup_ability;
-    bool include_cancel_construction;
-    bool include_cancel_production;
-    bool include_ai_takeover;
-    bool include_unknown;
-} CCommandFilter;
 
 char* parse_replay_full(const char* file_path);
-char* parse_replay_with_filter(const char* file_path, const CCommandFilter* filter);
+char* parse_replay_with_filter(const char* file_path, const char* command_types);
+char* parse_replay_cancellable(const char* file_path, const char* command_types, const int* cancel);
+char* supported_command_types(void);
+char* parser_version(void);
 void free_string(char* s);
 */
 import "C"
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/scharissis/coh3-replay-analyser/pkg/entity"
 	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
 )
 
-// CommandFilter represents configuration for filtering commands
+// CommandFilter selects the command types the parser includes in BuildCommands.
+// Types are the command type names emitted by the parser (see SupportedCommandTypes),
+// so new command kinds need no changes here.
 type CommandFilter struct {
-	IncludeBuildSquad              bool `json:"include_build_squad"`
-	IncludeConstructEntity         bool `json:"include_construct_entity"`
-	IncludeBuildGlobalUpgrade      bool `json:"include_build_global_upgrade"`
-	IncludeUseAbility              bool `json:"include_use_ability"`
-	IncludeUseBattlegroupAbility   bool `json:"include_use_battlegroup_ability"`
-	IncludeSelectBattlegroup       bool `json:"include_select_battlegroup"`
-	IncludeSelectBattlegroupAbility bool `json:"include_select_battlegroup_ability"`
-	IncludeCancelConstruction      bool `json:"include_cancel_construction"`
-	IncludeCancelProduction        bool `json:"include_cancel_production"`
-	IncludeAITakeover              bool `json:"include_ai_takeover"`
-	IncludeUnknown                 bool `json:"include_unknown"`
+	Types []string `json:"types"`
+	All   bool     `json:"all"` // Include every command type, ignoring Types
 }
 
-// NewBuildOnlyFilter creates a filter that only includes build-related commands
+// NewCommandFilter creates a filter including the given command types
+func NewCommandFilter(types ...string) CommandFilter {
+	return CommandFilter{Types: types}
+}
+
+// NewBuildOnlyFilter creates a filter that only includes build commands (default behavior)
 func NewBuildOnlyFilter() CommandFilter {
-	return CommandFilter{
-		IncludeBuildSquad:              true,
-		IncludeConstructEntity:         true,
-		IncludeBuildGlobalUpgrade:      true,
-		IncludeUseAbility:              false,
-		IncludeUseBattlegroupAbility:   false,
-		IncludeSelectBattlegroup:       true,
-		IncludeSelectBattlegroupAbility: true,
-		IncludeCancelConstruction:      false,
-		IncludeCancelProduction:        false,
-		IncludeAITakeover:              false,
-		IncludeUnknown:                 false,
-	}
+	return NewCommandFilter(
+		"build_squad",
+		"construct_entity",
+		"build_global_upgrade",
+		"select_battlegroup",
+		"select_battlegroup_ability",
+	)
 }
 
 // NewAllCommandsFilter creates a filter that includes all command types
 func NewAllCommandsFilter() CommandFilter {
-	return CommandFilter{
-		IncludeBuildSquad:              true,
-		IncludeConstructEntity:         true,
-		IncludeBuildGlobalUpgrade:      true,
-		IncludeUseAbility:              true,
-		IncludeUseBattlegroupAbility:   true,
-		IncludeSelectBattlegroup:       true,
-		IncludeSelectBattlegroupAbility: true,
-		IncludeCancelConstruction:      true,
-		IncludeCancelProduction:        true,
-		IncludeAITakeover:              true,
-		IncludeUnknown:                 true,
-	}
+	return CommandFilter{All: true}
 }
 
-// NewCombatOnlyFilter creates a filter that only includes combat-related commands
+// NewCombatOnlyFilter creates a filter for combat-related commands only
 func NewCombatOnlyFilter() CommandFilter {
-	return CommandFilter{
-		IncludeBuildSquad:              false,
-		IncludeConstructEntity:         false,
-		IncludeBuildGlobalUpgrade:      false,
-		IncludeUseAbility:              true,
-		IncludeUseBattlegroupAbility:   true,
-		IncludeSelectBattlegroup:       false,
-		IncludeSelectBattlegroupAbility: false,
-		IncludeCancelConstruction:      false,
-		IncludeCancelProduction:        false,
-		IncludeAITakeover:              false,
-		IncludeUnknown:                 false,
+	return NewCommandFilter("use_ability", "use_battlegroup_ability")
+}
+
+// Includes reports whether the filter includes the given command type
+func (f CommandFilter) Includes(commandType string) bool {
+	if f.All {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == commandType {
+			return true
+		}
+	}
+	return false
+}
+
+// spec encodes the filter in the form the parser expects: "*" or a comma-separated list
+func (f CommandFilter) spec() string {
+	if f.All {
+		return "*"
 	}
+	return strings.Join(f.Types, ",")
 }
 
 // Command represents a command with detailed information
@@ -131,6 +111,7 @@ type PlayerInfo struct {
 type ReplayData struct {
 	Success      bool    `json:"success"`
 	ErrorMessage *string `json:"error_message,omitempty"`
+	ErrorCode    *string `json:"error_code,omitempty"` // Why parsing failed; see ParseError
 	// Match Information
 	MapName         string  `json:"map_name"`
 	MapFilename     string  `json:"map_filename"`
@@ -190,16 +171,39 @@ func ParseReplayFull(filePath string) (*ReplayData, error) {
 		return nil, err
 	}
 
-	if !result.Success && result.ErrorMessage != nil {
-		return &result, errors.New(*result.ErrorMessage)
-	}
 	if !result.Success {
-		return nil, errors.New("failed to parse replay; got success=false")
+		return &result, resultError(&result)
 	}
 
 	return &result, nil
 }
 
+// SupportedCommandTypes returns the command types the parser can include in BuildCommands
+func SupportedCommandTypes() ([]string, error) {
+	cResult := C.supported_command_types()
+	if cResult == nil {
+		return nil, errors.New("failed to list supported command types")
+	}
+	defer C.free_string(cResult)
+
+	var types []string
+	if err := json.Unmarshal([]byte(C.GoString(cResult)), &types); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// ParserVersion returns the version of the Rust parser. It changes whenever the
+// parser output may change, so results cached across runs are keyed by it.
+func ParserVersion() string {
+	cResult := C.parser_version()
+	if cResult == nil {
+		return "unknown"
+	}
+	defer C.free_string(cResult)
+	return C.GoString(cResult)
+}
+
 // ParseReplayWithLookup parses a replay file and enhances commands with friendly names
 func ParseReplayWithLookup(filePath string, dataDir string) (*ReplayData, error) {
 	// Use default build-only filter for backwards compatibility
@@ -209,59 +213,134 @@ func ParseReplayWithLookup(filePath string, dataDir string) (*ReplayData, error)
 
 // ParseReplayWithFilter parses a replay file with a custom command filter and enhances commands with friendly names
 func ParseReplayWithFilter(filePath string, dataDir string, filter CommandFilter) (*ReplayData, error) {
-	// Convert Go filter to C filter
-	cFilter := C.CCommandFilter{
-		include_build_squad:               C.bool(filter.IncludeBuildSquad),
-		include_construct_entity:          C.bool(filter.IncludeConstructEntity),
-		include_build_global_upgrade:      C.bool(filter.IncludeBuildGlobalUpgrade),
-		include_use_ability:               C.bool(filter.IncludeUseAbility),
-		include_use_battlegroup_ability:   C.bool(filter.IncludeUseBattlegroupAbility),
-		include_select_battlegroup:        C.bool(filter.IncludeSelectBattlegroup),
-		include_select_battlegroup_ability: C.bool(filter.IncludeSelectBattlegroupAbility),
-		include_cancel_construction:       C.bool(filter.IncludeCancelConstruction),
-		include_cancel_production:         C.bool(filter.IncludeCancelProduction),
-		include_ai_takeover:               C.bool(filter.IncludeAITakeover),
-		include_unknown:                   C.bool(filter.IncludeUnknown),
+	replayData, err := parseReplayWithFilter(filePath, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	// Call the Rust function with filter
+	// Initialize the lookup resolver for enhancing command names
+	resolver, err := lookup.NewDataResolver(dataDir)
+	if err != nil {
+		// If lookup fails, just return the basic data without enhancement
+		return replayData, nil
+	}
+
+	EnrichReplay(replayData, resolver)
+	return replayData, nil
+}
+
+// ParseReplayWithResolver parses a replay file with a custom command filter and enhances
+// commands using an already-loaded resolver, so callers parsing many replays load the
+// game data once. A nil resolver skips enhancement.
+func ParseReplayWithResolver(filePath string, resolver *lookup.DataResolver, filter CommandFilter) (*ReplayData, error) {
+	return ParseReplayContext(context.Background(), filePath, resolver, filter)
+}
+
+// ParseReplayContext behaves like ParseReplayWithResolver but returns ctx.Err()
+// as soon as ctx is cancelled or its deadline passes. The parser is told to stop
+// and does so at its next checkpoint; a parse stuck inside vault itself keeps
+// running in the background until vault returns. Use a ParseWorker to parse
+// untrusted replays, whose parse can always be stopped.
+func ParseReplayContext(ctx context.Context, filePath string, resolver *lookup.DataResolver, filter CommandFilter) (*ReplayData, error) {
+	replayData, err := parseReplayContext(ctx, filePath, filter)
+	if err != nil {
+		return nil, err
+	}
+	if resolver != nil {
+		EnrichReplay(replayData, resolver)
+	}
+	return replayData, nil
+}
+
+// EnrichReplay enhances all player commands with friendly names
+func EnrichReplay(replayData *ReplayData, resolver *lookup.DataResolver) {
+	for i := range replayData.Players {
+		enhanceCommandsWithPlayerInfo(replayData.Players[i].Commands, resolver, &replayData.Players[i])
+		enhanceCommandsWithPlayerInfo(replayData.Players[i].BuildCommands, resolver, &replayData.Players[i])
+		
+		// Temporarily disable entity tracking to see raw structure numbers
+		// enhanceWithEntityTracking(&replayData.Players[i])
+	}
+}
+
+// parseReplayWithFilter calls the Rust parser with a command filter
+func parseReplayWithFilter(filePath string, filter CommandFilter) (*ReplayData, error) {
+	return parseReplayCancellable(filePath, filter, nil)
+}
+
+// parseReplayContext calls the Rust parser with a command filter, setting its
+// cancel flag once ctx is done
+func parseReplayContext(ctx context.Context, filePath string, filter CommandFilter) (*ReplayData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return parseReplayWithFilter(filePath, filter)
+	}
+
+	// The flag lives in C memory, as the parser reads it while Go writes it
+	cancel := (*C.int)(C.calloc(1, C.size_t(unsafe.Sizeof(C.int(0)))))
+	type result struct {
+		data *ReplayData
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		data, err := parseReplayCancellable(filePath, filter, cancel)
+		results <- result{data, err}
+	}()
+
+	select {
+	case r := <-results:
+		C.free(unsafe.Pointer(cancel))
+		return r.data, r.err
+	case <-ctx.Done():
+		atomic.StoreInt32((*int32)(unsafe.Pointer(cancel)), 1)
+		// Free the flag once the parser has stopped reading it
+		go func() {
+			<-results
+			C.free(unsafe.Pointer(cancel))
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// parseReplayCancellable calls the Rust parser, which gives up once *cancel is
+// set. cancel may be nil.
+func parseReplayCancellable(filePath string, filter CommandFilter, cancel *C.int) (*ReplayData, error) {
+	result, err := parseReplayResult(filePath, filter, cancel)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResult(result)
+}
+
+// parseReplayResult calls the Rust parser and returns its JSON result
+func parseReplayResult(filePath string, filter CommandFilter, cancel *C.int) ([]byte, error) {
 	cFilePath := C.CString(filePath)
 	defer C.free(unsafe.Pointer(cFilePath))
+	cTypes := C.CString(filter.spec())
+	defer C.free(unsafe.Pointer(cTypes))
 
-	cResult := C.parse_replay_with_filter(cFilePath, &cFilter)
+	cResult := C.parse_replay_cancellable(cFilePath, cTypes, cancel)
 	if cResult == nil {
 		return nil, errors.New("failed to parse replay: null result")
 	}
 	defer C.free_string(cResult)
 
-	result := C.GoString(cResult)
+	return []byte(C.GoString(cResult)), nil
+}
 
+// decodeResult decodes a JSON result of the Rust parser, returning the parse
+// error of a failed result
+func decodeResult(result []byte) (*ReplayData, error) {
 	var replayData ReplayData
-	if err := json.Unmarshal([]byte(result), &replayData); err != nil {
+	if err := json.Unmarshal(result, &replayData); err != nil {
 		return nil, err
 	}
 
 	if !replayData.Success {
-		if replayData.ErrorMessage != nil {
-			return nil, errors.New(*replayData.ErrorMessage)
-		}
-		return nil, errors.New("failed to parse replay: unknown error")
-	}
-
-	// Initialize the lookup resolver for enhancing command names
-	resolver, err := lookup.NewDataResolver(dataDir)
-	if err != nil {
-		// If lookup fails, just return the basic data without enhancement
-		return &replayData, nil
-	}
-
-	// Enhance all player commands with friendly names
-	for i := range replayData.Players {
-		enhanceCommandsWithPlayerInfo(replayData.Players[i].Commands, resolver, &replayData.Players[i])
-		enhanceCommandsWithPlayerInfo(replayData.Players[i].BuildCommands, resolver, &replayData.Players[i])
-		
-		// Temporarily disable entity tracking to see raw structure numbers
-		// enhanceWithEntityTracking(&replayData.Players[i])
+		return nil, resultError(&replayData)
 	}
 
 	return &replayData, nil
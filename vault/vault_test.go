@@ -1,7 +1,10 @@
 package vault
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 	"path/filepath"
 	"os"
 )
@@ -131,4 +134,280 @@ func TestParseReplayFull_ErrorHandling(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for empty filename, got nil")
 	}
-}
\ No newline at end of file
+}
+
+func TestParseReplayFull_ErrorCodes(t *testing.T) {
+	notReplay := filepath.Join(t.TempDir(), "notes.rec")
+	if err := os.WriteFile(notReplay, []byte("not a replay"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path string
+		want error
+	}{
+		{"/nonexistent/file.rec", ErrIO},
+		{notReplay, ErrNotReplay},
+	} {
+		_, err := ParseReplayFull(tt.path)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("ParseReplayFull(%s) = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+}
+
+func TestParseReplayContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	live, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"cancelled", cancelled, context.Canceled},
+		{"expired", expired, context.DeadlineExceeded},
+		{"live", live, ErrIO},
+		{"background", context.Background(), ErrIO},
+	} {
+		_, err := ParseReplayContext(tt.ctx, "/nonexistent/file.rec", nil, NewBuildOnlyFilter())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: ParseReplayContext = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// hangParseEnv makes the test binary, started as a parse worker, hang like a
+// parser stuck on a pathological replay
+const hangParseEnv = "COH3_TEST_HANG_PARSE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(ParseWorkerEnv) != "" && os.Getenv(hangParseEnv) != "" {
+		time.Sleep(time.Hour)
+	}
+	RunParseWorker()
+	os.Exit(m.Run())
+}
+
+func TestParseWorker(t *testing.T) {
+	notReplay := filepath.Join(t.TempDir(), "notes.rec")
+	if err := os.WriteFile(notReplay, []byte("not a replay"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	worker := &ParseWorker{}
+	for _, tt := range []struct {
+		path string
+		want error
+	}{
+		{"/nonexistent/file.rec", ErrIO},
+		{notReplay, ErrNotReplay},
+	} {
+		if _, err := worker.Parse(context.Background(), tt.path, nil, NewBuildOnlyFilter()); !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%s) = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+
+	if _, err := os.Stat(testReplayFile); err == nil {
+		data, err := worker.Parse(context.Background(), testReplayFile, nil, NewAllCommandsFilter())
+		if err != nil {
+			t.Fatalf("Parse(%s) = %v", testReplayFile, err)
+		}
+		if !data.Success || len(data.Players) == 0 {
+			t.Errorf("Parse(%s) returned no players", testReplayFile)
+		}
+	}
+
+	// A worker that dies without a result is reported as a parser failure
+	crashing := &ParseWorker{Executable: "/bin/false"}
+	if _, err := crashing.Parse(context.Background(), notReplay, nil, NewBuildOnlyFilter()); !errors.Is(err, ErrParserPanic) {
+		t.Errorf("Parse with a crashing worker = %v, want %v", err, ErrParserPanic)
+	}
+}
+
+func TestParseWorker_KillsHungParse(t *testing.T) {
+	t.Setenv(hangParseEnv, "1")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := (&ParseWorker{}).Parse(ctx, "/nonexistent/file.rec", nil, NewBuildOnlyFilter())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Parse of a hung replay = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Parse of a hung replay returned after %v", elapsed)
+	}
+}
+
+func TestResultError(t *testing.T) {
+	str := func(s string) *string { return &s }
+	for _, tt := range []struct {
+		result  ReplayData
+		want    error
+		message string
+	}{
+		{ReplayData{ErrorCode: str("unsupported_version"), ErrorMessage: str("Unsupported replay version 9")}, ErrUnsupportedVersion, "Unsupported replay version 9"},
+		{ReplayData{ErrorCode: str("corrupt_stream"), ErrorMessage: str("Failed to parse replay")}, ErrCorruptReplay, "Failed to parse replay"},
+		{ReplayData{ErrorCode: str("internal_panic"), ErrorMessage: str("Parser panicked: oops")}, ErrParserPanic, "Parser panicked: oops"},
+		{ReplayData{ErrorMessage: str("from an older parser")}, nil, "from an older parser"},
+		{ReplayData{}, nil, "failed to parse replay: unknown error"},
+	} {
+		err := resultError(&tt.result)
+		if err.Error() != tt.message {
+			t.Errorf("resultError() = %q, want %q", err, tt.message)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("resultError(%q) does not match %v", tt.message, tt.want)
+		}
+		if tt.want == nil && errors.Unwrap(err) != nil {
+			t.Errorf("resultError(%q) matches %v, want no sentinel", tt.message, errors.Unwrap(err))
+		}
+	}
+}
+func TestParseReplays_ReportsPerFileErrors(t *testing.T) {
+	paths := []string{"/nonexistent/a.rec", "/nonexistent/b.rec", "/nonexistent/c.rec"}
+
+	var calls int
+	results := ParseReplays(context.Background(), paths, ParseOptions{
+		Workers:  2,
+		Progress: func(done, total int, result ParseResult) {
+			calls++
+			if done != calls || total != len(paths) {
+				t.Errorf("Progress(%d, %d) on call %d", done, total, calls)
+			}
+		},
+	})
+
+	if len(results) != len(paths) {
+		t.Fatalf("Expected %d results, got %d", len(paths), len(results))
+	}
+	for i, result := range results {
+		if result.Path != paths[i] {
+			t.Errorf("Result %d is for %s, expected %s", i, result.Path, paths[i])
+		}
+		if result.Err == nil {
+			t.Errorf("Expected error for %s, got nil", result.Path)
+		}
+	}
+	if calls != len(paths) {
+		t.Errorf("Expected %d progress calls, got %d", len(paths), calls)
+	}
+}
+
+func TestParseReplays_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := ParseReplays(ctx, []string{"/nonexistent/a.rec", "/nonexistent/b.rec"}, ParseOptions{Workers: 1})
+	for _, result := range results {
+		if result.Err == nil {
+			t.Errorf("Expected error for %s, got nil", result.Path)
+		}
+	}
+}
+
+func TestParseCache_ReturnsCachedResult(t *testing.T) {
+	cache, err := OpenParseCache(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is not a valid replay, so a result can only come from the cache
+	replayFile := filepath.Join(t.TempDir(), "game.rec")
+	if err := os.WriteFile(replayFile, []byte("not a replay"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.ParseReplayWithFilter(replayFile, NewBuildOnlyFilter()); err == nil {
+		t.Fatal("Expected parse error before anything is cached")
+	}
+
+	path, err := cache.entryPath(replayFile, NewBuildOnlyFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.store(path, &ReplayData{Success: true, MapName: "cached_map"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The filter's type order does not matter
+	reordered := NewCommandFilter("select_battlegroup_ability", "select_battlegroup", "build_global_upgrade", "construct_entity", "build_squad")
+	data, err := cache.ParseReplayWithFilter(replayFile, reordered)
+	if err != nil || data.MapName != "cached_map" {
+		t.Fatalf("Expected cached result, got %+v, %v", data, err)
+	}
+
+	if _, stats, err := cache.ParseReplayWithStats(replayFile, NewBuildOnlyFilter()); err != nil || !stats.Hit || stats.Parse != 0 {
+		t.Errorf("Expected a hit without parsing, got %+v, %v", stats, err)
+	}
+
+	// Another filter is a different cache entry
+	if _, stats, err := cache.ParseReplayWithStats(replayFile, NewAllCommandsFilter()); err == nil || stats.Hit {
+		t.Errorf("Expected a miss for a different filter, got %+v", stats)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.ParseReplayWithFilter(replayFile, NewBuildOnlyFilter()); err == nil {
+		t.Error("Expected a miss after Clear")
+	}
+}
+
+func TestParseCache_InvalidatesOnDataVersion(t *testing.T) {
+	dir, dataDir := t.TempDir(), t.TempDir()
+	writeTag := func(tag string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dataDir, "metadata.json"), []byte(`{"tag": "`+tag+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTag("v2.1.1-1")
+	old, err := OpenParseCache(dir, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.store(filepath.Join(old.dir, "entry.json"), &ReplayData{Success: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTag("v2.2.0-1")
+	current, err := OpenParseCache(dir, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.dir == old.dir {
+		t.Fatalf("Expected a new cache generation for new game data, got %s", current.dir)
+	}
+
+	// Another process may still be using the old game data
+	if _, err := os.Stat(filepath.Join(old.dir, "entry.json")); err != nil {
+		t.Errorf("Expected recent results for the old game data to be kept, got %v", err)
+	}
+	if _, err := OpenParseCache(dir, dataDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(old.dir, "entry.json")); err != nil {
+		t.Errorf("Expected recent results for the old game data to be kept on reopen, got %v", err)
+	}
+
+	// Once unused for long enough the old generation is removed
+	unused := time.Now().Add(-2 * staleGenerationAge)
+	if err := os.Chtimes(old.dir, unused, unused); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenParseCache(dir, dataDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old.dir); !os.IsNotExist(err) {
+		t.Errorf("Expected unused results for the old game data to be removed, got %v", err)
+	}
+	if _, err := os.Stat(current.dir); err != nil {
+		t.Errorf("Expected the current generation to be kept, got %v", err)
+	}
+}
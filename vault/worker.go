@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/scharissis/coh3-replay-analyser/pkg/lookup"
+)
+
+// ParseWorkerEnv marks a process started by a ParseWorker. It holds the
+// command filter as JSON; the replay path is the only argument.
+const ParseWorkerEnv = "COH3_PARSE_WORKER"
+
+// ParseWorker parses replays in child processes, so a parse can always be
+// stopped: when its context is done the child is killed, even if the parser
+// is stuck inside vault on a pathological replay. Programs using a ParseWorker
+// must call RunParseWorker at the start of main.
+type ParseWorker struct {
+	// Executable is the program started for each parse; it defaults to the
+	// running executable
+	Executable string
+}
+
+// RunParseWorker parses a replay and exits if the process was started by a
+// ParseWorker, writing the parser's result to stdout. Otherwise it returns
+// right away.
+func RunParseWorker() {
+	spec, ok := os.LookupEnv(ParseWorkerEnv)
+	if !ok {
+		return
+	}
+	if err := runParseWorker(spec, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func runParseWorker(spec string, args []string) error {
+	var filter CommandFilter
+	if err := json.Unmarshal([]byte(spec), &filter); err != nil {
+		return fmt.Errorf("invalid command filter: %w", err)
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected a replay path, got %d arguments", len(args))
+	}
+	result, err := parseReplayResult(args[0], filter, nil)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(result)
+	return err
+}
+
+// Parse parses a replay in a child process and enriches it with resolver,
+// which may be nil. It returns ctx.Err() once ctx is done, after the child
+// has been killed. A child that crashes reports ErrParserPanic.
+func (w *ParseWorker) Parse(ctx context.Context, filePath string, resolver *lookup.DataResolver, filter CommandFilter) (*ReplayData, error) {
+	replayData, err := w.parse(ctx, filePath, filter)
+	if err != nil {
+		return nil, err
+	}
+	if resolver != nil {
+		EnrichReplay(replayData, resolver)
+	}
+	return replayData, nil
+}
+
+// parse runs the child process for a replay and decodes its result
+func (w *ParseWorker) parse(ctx context.Context, filePath string, filter CommandFilter) (*ReplayData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	executable := w.Executable
+	if executable == "" {
+		var err error
+		if executable, err = os.Executable(); err != nil {
+			return nil, fmt.Errorf("failed to start parse worker: %w", err)
+		}
+	}
+	spec, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, executable, filePath)
+	cmd.Env = append(os.Environ(), ParseWorkerEnv+"="+string(spec))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait on output held open by anything the child started
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to start parse worker: %w", err)
+		}
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = exitErr.Error()
+		}
+		return nil, &ParseError{Code: "internal_panic", Message: "parse worker failed: " + message}
+	}
+	return decodeResult(stdout.Bytes())
+}